@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andrewlader/go-copy/internal/copylib"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// configReloadDelay is how long the daemon waits for the config file to stop changing before reloading it,
+// as editors often write a file in several steps.
+const configReloadDelay = 500 * time.Millisecond
+
+// configMutex stops the daemon from reloading the config while an operation is being read from it.
+var configMutex sync.Mutex
+
+// runDaemonCommand handles the "daemon" command, which runs the operations that have a schedule whenever they
+// are due, until it is interrupted. The schedules are reloaded whenever the config file changes.
+func runDaemonCommand(ctx context.Context, args []string) int {
+	flagSet := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	err := flagSet.Parse(args)
+	if err != nil {
+		return exitConfigError
+	}
+
+	scheduler := copylib.NewScheduler(runScheduledOperation)
+	loadSchedules(scheduler)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error watching the config file for changes: %s", err))
+		return exitFailed
+	}
+	defer watcher.Close()
+
+	// watch the folder, as editors often replace the config file instead of writing to it
+	configFile := filepath.Clean(viper.ConfigFileUsed())
+	err = watcher.Add(filepath.Dir(configFile))
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error watching the config file for changes: %s", err))
+		return exitFailed
+	}
+	go watchConfigFile(ctx, watcher, configFile, scheduler)
+
+	copylib.PrintAlways(fmt.Sprintf("the daemon is running, and watching %s for changes; press Ctrl-C to stop it", configFile))
+	scheduler.Run(ctx)
+	copylib.PrintAlways("the daemon has stopped")
+
+	return exitSuccess
+}
+
+// loadSchedules gives the scheduler the schedules from the config, and displays when each operation runs next.
+// Operations that are not valid are reported, but do not stop the others from running.
+func loadSchedules(scheduler *copylib.Scheduler) {
+	configMutex.Lock()
+	schedules, err := copylib.OperationSchedules(os.Hostname)
+	configMutex.Unlock()
+
+	if err != nil {
+		copylib.PrintError(err.Error())
+	}
+	if len(schedules) == 0 {
+		copylib.PrintWarning("none of the operations have a schedule, so nothing will run until the config file is changed")
+	}
+
+	scheduler.SetSchedules(schedules)
+
+	nextRuns := scheduler.NextRuns()
+	keys := make([]string, 0, len(nextRuns))
+	for key := range nextRuns {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		copylib.PrintSimple(fmt.Sprintf("operation \"%s\" runs on the schedule \"%s\", next at %s",
+			key, schedules[key], nextRuns[key].Format(time.DateTime)))
+	}
+}
+
+// watchConfigFile reloads the config, and the schedules in it, once the config file has stopped changing.
+func watchConfigFile(ctx context.Context, watcher *fsnotify.Watcher, configFile string, scheduler *copylib.Scheduler) {
+	reloadTimer := time.NewTimer(configReloadDelay)
+	reloadTimer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			reloadTimer.Stop()
+			return
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == configFile && !event.Has(fsnotify.Chmod) {
+				reloadTimer.Reset(configReloadDelay)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			copylib.PrintWarning(fmt.Sprintf("error watching the config file for changes: %s", err))
+
+		case <-reloadTimer.C:
+			configMutex.Lock()
+			err := viper.ReadInConfig()
+			configMutex.Unlock()
+			if err != nil {
+				copylib.PrintError(fmt.Sprintf("the changed config file could not be read, so the previous schedules are kept: %s", err))
+				continue
+			}
+
+			copylib.PrintAlways(fmt.Sprintf("the config file %s changed, so it was reloaded", configFile))
+			loadSchedules(scheduler)
+		}
+	}
+}
+
+// runScheduledOperation runs an operation that has come due, logging when it started and how it went.
+func runScheduledOperation(ctx context.Context, key string) {
+	copylib.PrintAlways(fmt.Sprintf("starting the scheduled run of operation \"%s\" at %s", key, time.Now().Format(time.DateTime)), "operation", key)
+
+	startTime := time.Now()
+	// a scheduled run never waits for a lock, whatever --wait says, so runs cannot pile up behind a long manual one
+	runExitCode := runNamedOperation(ctx, key, lockSkip)
+
+	copylib.PrintAlways(fmt.Sprintf("the scheduled run of operation \"%s\" finished with exit code %d after %s",
+		key, runExitCode, time.Since(startTime).Round(time.Second)), "operation", key, "exit_code", runExitCode)
+}
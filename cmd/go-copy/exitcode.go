@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/andrewlader/go-copy/internal/copylib"
+)
+
+// The exit codes of go-copy, so scripts and schedulers can tell how a run went.
+const (
+	// exitSuccess means every file was copied or skipped, with no errors.
+	exitSuccess = 0
+	// exitFailed means nothing was copied, or go-copy stopped with an unexpected error.
+	exitFailed = 1
+	// exitConfigError means the config file, the operation or the command line is missing or invalid, so nothing was run.
+	exitConfigError = 2
+	// exitPartial means some files were copied or skipped, but others failed.
+	exitPartial = 3
+	// exitLocked means nothing was run, because another run was already using the operation or one of its destinations.
+	exitLocked = 4
+	// exitDrift means verify found destinations that are missing files, or have copies that differ from the source.
+	exitDrift = 5
+	// exitInterrupted means the run was stopped by Ctrl-C or SIGTERM; it is the code shells use for Ctrl-C.
+	exitInterrupted = 130
+)
+
+// exitCodeForStats returns the exit code for a single run with the given stats.
+func exitCodeForStats(runStats *copylib.Stats) int {
+	if runStats == nil {
+		return exitFailed
+	}
+
+	switch runStats.Outcome() {
+	case "success":
+		return exitSuccess
+	case "partial":
+		return exitPartial
+	case "interrupted":
+		return exitInterrupted
+	}
+
+	return exitFailed
+}
+
+// combineExitCodes returns the exit code for several operations run together: interrupted if any of them were,
+// success or failure when every operation agrees, and partial failure when some succeeded and others did not.
+func combineExitCodes(exitCodes []int) int {
+	combined := exitSuccess
+
+	for index, exitCode := range exitCodes {
+		if exitCode == exitConfigError || exitCode == exitLocked {
+			// an operation that could not be run has failed, even though the others may have been fine
+			exitCode = exitFailed
+		}
+
+		switch {
+		case exitCode == exitInterrupted || combined == exitInterrupted:
+			combined = exitInterrupted
+		case index == 0 || exitCode == combined:
+			combined = exitCode
+		default:
+			combined = exitPartial
+		}
+	}
+
+	return combined
+}
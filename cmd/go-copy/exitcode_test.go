@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/andrewlader/go-copy/internal/copylib"
+)
+
+func TestExitCodeForStatsSuccess(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		stats    *copylib.Stats
+		exitCode int
+	}{
+		{"no stats", nil, exitFailed},
+		{"nothing to copy", &copylib.Stats{}, exitSuccess},
+		{"everything copied", &copylib.Stats{TotalFilesCopied: 4, TotalFilesSkipped: 2}, exitSuccess},
+		{"warnings only", &copylib.Stats{TotalFilesCopied: 4, NumberOfWarnings: 1}, exitSuccess},
+		{"some files copied", &copylib.Stats{TotalFilesCopied: 4, TotalFilesFailed: 1, NumberOfErrors: 1}, exitPartial},
+		{"some files skipped", &copylib.Stats{TotalFilesSkipped: 4, TotalFilesFailed: 1, NumberOfErrors: 1}, exitPartial},
+		{"nothing copied", &copylib.Stats{TotalFilesFailed: 5, NumberOfErrors: 5}, exitFailed},
+		{"interrupted", &copylib.Stats{TotalFilesCopied: 4, Interrupted: true}, exitInterrupted},
+		{"interrupted with errors", &copylib.Stats{TotalFilesFailed: 1, NumberOfErrors: 1, Interrupted: true}, exitInterrupted},
+	}
+
+	for _, test := range tests {
+		exitCode := exitCodeForStats(test.stats)
+		if exitCode != test.exitCode {
+			t.Errorf("expected %s to exit with %d, but got %d", test.name, test.exitCode, exitCode)
+		}
+	}
+
+	if exitInterrupted != 130 {
+		t.Errorf("expected an interrupted run to exit with 130, as shells do for Ctrl-C, but got %d", exitInterrupted)
+	}
+}
+
+func TestCombineExitCodesSuccess(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		exitCodes []int
+		combined  int
+	}{
+		{[]int{}, exitSuccess},
+		{[]int{exitSuccess}, exitSuccess},
+		{[]int{exitSuccess, exitSuccess}, exitSuccess},
+		{[]int{exitFailed, exitFailed}, exitFailed},
+		{[]int{exitPartial, exitPartial}, exitPartial},
+		{[]int{exitSuccess, exitFailed}, exitPartial},
+		{[]int{exitFailed, exitSuccess}, exitPartial},
+		{[]int{exitSuccess, exitPartial}, exitPartial},
+		{[]int{exitFailed, exitPartial, exitFailed}, exitPartial},
+		// an operation that could not be run counts as failed
+		{[]int{exitConfigError}, exitFailed},
+		{[]int{exitLocked}, exitFailed},
+		{[]int{exitFailed, exitLocked, exitConfigError}, exitFailed},
+		{[]int{exitSuccess, exitLocked}, exitPartial},
+		{[]int{exitConfigError, exitSuccess}, exitPartial},
+		// an interruption wins over everything, wherever it comes
+		{[]int{exitInterrupted}, exitInterrupted},
+		{[]int{exitInterrupted, exitSuccess}, exitInterrupted},
+		{[]int{exitSuccess, exitFailed, exitInterrupted}, exitInterrupted},
+		{[]int{exitPartial, exitInterrupted, exitLocked}, exitInterrupted},
+	}
+
+	for _, test := range tests {
+		combined := combineExitCodes(test.exitCodes)
+		if combined != test.combined {
+			t.Errorf("expected %v to combine to %d, but got %d", test.exitCodes, test.combined, combined)
+		}
+	}
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path"
 	"runtime"
+	"strings"
+	"syscall"
 
 	"github.com/andrewlader/go-copy/internal/copylib"
 	"github.com/fatih/color"
 	"github.com/spf13/viper"
-	"golang.org/x/text/language"
-	"golang.org/x/text/message"
 )
 
 var loadedConfigs bool
@@ -19,9 +23,16 @@ var date string
 var commit string
 var displayBuildInformation bool
 var operation string
+var runAllOperations bool
 var listConfigs bool
+var listFormat string
+var reportFile string
+var waitForLocks bool
+var rescanManifests bool
+var reportResults []*copylib.Result
 var pauseAtEnd bool
 var finishedSuccessfully bool
+var exitCode int
 var logModeSilent bool
 var logModeSimple bool
 var logModeInfo bool
@@ -29,24 +40,57 @@ var logModeWarning bool
 var logModeDebug bool
 var logModeVerbose bool
 var logMode copylib.LogMode
+var logFormat string
+var logFile string
+var command string
+var commandArgs []string
 
-// init is called before the main function and is used to set up the configuration and handle any necessary initialization for the application.
-func init() {
-	defer handleExit()
+// stringListFlag is a flag that can be repeated on the command line, collecting each value in order.
+type stringListFlag []string
 
-	copylib.PrintBlankLine()
+func (list *stringListFlag) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *stringListFlag) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// commandFormat returns the --format given to the command, or table, without parsing the command's other flags,
+// as it is needed before the config file is loaded.
+func commandFormat(args []string) string {
+	for index, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "format" {
+			continue
+		} else if hasValue {
+			return value
+		} else if index+1 < len(args) {
+			return args[index+1]
+		}
+	}
 
+	return copylib.ListFormatTable
+}
+
+// setUp is called at the start of the main function and is used to set up the configuration and handle any necessary initialization for the application.
+// It is not an init function, so the tests of this package can run without parsing go-copy's flags.
+func setUp() {
 	finishedSuccessfully = false
 
 	parseArguments()
 
+	copylib.PrintBlankLine()
+
 	homeFolder, err := os.UserHomeDir()
 	if err != nil {
 		copylib.PrintError(fmt.Sprintf("error getting user home directory: %s", err))
 		homeFolder = ""
 	}
 
-	if !displayBuildInformation {
+	// an ad-hoc copy is defined entirely by its flags, and the history is kept outside of the config, so neither needs a config file
+	if !displayBuildInformation && command != "copy" && command != "history" {
 		viper.SetConfigName("go-copy-config")                // name of config file (without extension)
 		viper.SetConfigType("yml")                           // REQUIRED if the config file does not have the extension in the name
 		viper.SetConfigType("yaml")                          // REQUIRED if the config file does not have the extension in the name
@@ -66,63 +110,389 @@ func init() {
 			loadedConfigs = true
 		}
 	}
+
+	// a log file that cannot be written is not a reason to skip the copy, so go on without it, unless the
+	// log settings are an operation, which would otherwise be left out of every run
+	err = copylib.OpenLogFile(logFile)
+	if errors.Is(err, copylib.ErrLogSectionIsOperation) {
+		copylib.PrintError(err.Error())
+		os.Exit(exitConfigError)
+	} else if err != nil {
+		copylib.PrintWarning(fmt.Sprintf("the log will not be written to a file: %s", err))
+	}
 }
 
 // main is the entry point of the application. It handles command-line arguments and executes the appropriate actions based on those arguments.
 func main() {
+	defer func() { os.Exit(exitCode) }()
+	defer copylib.CloseLogFile()
 	defer handleExit()
 
+	setUp()
+
 	copylib.PrintBlankLine()
 
+	// Ctrl-C or a SIGTERM stops the copy cleanly, instead of leaving partially written files behind
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// only the first signal is caught, so a second Ctrl-C kills the process if a copy or hook does not stop
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	if displayBuildInformation {
 		copylib.PrintVersionInfo("build version: ", version)
 		copylib.PrintVersionInfo("build commit:  ", commit)
 		copylib.PrintVersionInfo("build date:    ", date)
+	} else if command == "copy" {
+		exitCode = runCopyCommand(ctx, commandArgs)
+		writeReport()
+
+		if pauseAtEnd {
+			pauseOutput()
+		}
+	} else if command == "history" {
+		exitCode = runHistoryCommand(commandArgs)
 	} else if loadedConfigs {
-		if listConfigs {
-			copylib.ListConfigurations()
-		} else {
-			// run the main operation of the program, which is copying files based on the configuration
-			finishedSuccessfully = runOperation()
+		switch command {
+		case "":
+			if listConfigs {
+				err := copylib.ListConfigurations(listFormat, os.Hostname)
+				if err != nil {
+					copylib.PrintError(fmt.Sprintf("error listing the operations: %s", err))
+					exitCode = exitConfigError
+				}
+			} else {
+				// run the main operation of the program, which is copying files based on the configuration
+				exitCode = runOperation(ctx)
+				writeReport()
+
+				if pauseAtEnd {
+					pauseOutput()
+				}
+			}
+		case "op":
+			exitCode = runOpCommand(commandArgs)
+		case "daemon":
+			exitCode = runDaemonCommand(ctx, commandArgs)
+		case "watch":
+			exitCode = runWatchCommand(ctx, commandArgs)
+		case "restore":
+			exitCode = runRestoreCommand(ctx, commandArgs)
+			writeReport()
+		case "verify":
+			exitCode = runVerifyCommand(ctx, commandArgs)
+		case "status":
+			exitCode = runStatusCommand(ctx, commandArgs)
+		default:
+			copylib.PrintError(fmt.Sprintf("unknown command \"%s\"", command))
+			exitCode = exitConfigError
 		}
+	} else {
+		exitCode = exitConfigError
+	}
+
+	finishedSuccessfully = exitCode == exitSuccess
+}
+
+// runCopyCommand handles the "copy" command, which copies files using only the settings given on the command line.
+func runCopyCommand(ctx context.Context, args []string) int {
+	var settings copylib.OperationSettings
+	var destinations stringListFlag
+
+	flagSet := flag.NewFlagSet("copy", flag.ContinueOnError)
+	flagSet.StringVar(&settings.Name, "name", "ad-hoc copy", "the display name of the copy (optional)")
+	flagSet.StringVar(&settings.Source, "source", "", "the folder to copy from (required)")
+	flagSet.Var(&destinations, "dest", "a folder to copy to; repeat for each destination (required)")
+	flagSet.StringVar(&settings.Replace, "replace", "skip", "how to handle existing files: never, skip or always (optional)")
+	flagSet.StringVar(&reportFile, "report", reportFile, "write what happened to every file to this JSON file (optional)")
+	flagSet.BoolVar(&waitForLocks, "wait", waitForLocks, "wait for other runs using the destinations to finish, instead of failing (optional)")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return exitConfigError
+	}
+	settings.Destinations = destinations
+
+	mode := commandLockMode()
+	options := []copylib.Option{copylib.WithEvents(printEvent)}
+	if mode == lockWait {
+		options = append(options, copylib.WithLockWait(ctx))
 	}
+
+	copyFileRunner, err := copylib.NewAdHocRunner(settings, options...)
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error initializing runner for the copy: %s", err))
+		return exitConfigError
+	}
+
+	lockExitCode := lockRun(ctx, copyFileRunner, "the copy", mode)
+	if lockExitCode != exitSuccess {
+		return lockExitCode
+	}
+
+	runExitCode := runCopy(ctx, copyFileRunner)
+	recordRun("", copyFileRunner, runExitCode)
+
+	return runExitCode
+}
+
+// runHistoryCommand handles the "history" command, which shows how previous runs went.
+func runHistoryCommand(args []string) int {
+	var operationKey string
+	var format string
+	var limit int
+
+	flagSet := flag.NewFlagSet("history", flag.ContinueOnError)
+	flagSet.StringVar(&operationKey, "operation", operation, "only show the runs of this operation (optional)")
+	flagSet.StringVar(&format, "format", copylib.ListFormatTable, "the format of the history: table or json (optional)")
+	flagSet.IntVar(&limit, "limit", 20, "how many of the most recent runs to show; 0 shows them all (optional)")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return exitConfigError
+	}
+
+	err = copylib.ListHistory(operationKey, format, limit)
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error showing the history: %s", err))
+		return exitConfigError
+	}
+
+	return exitSuccess
+}
+
+// runOpCommand handles the "op" command, which adds, edits or removes operations in the config file.
+func runOpCommand(args []string) int {
+	if len(args) < 2 {
+		copylib.PrintError("usage: go-copy op add|set|remove <operation> [options]")
+		return exitConfigError
+	}
+
+	subCommand := args[0]
+	key := args[1]
+	configFile := viper.ConfigFileUsed()
+
+	var settings copylib.OperationSettings
+	var destinations stringListFlag
+
+	flagSet := flag.NewFlagSet("op "+subCommand, flag.ContinueOnError)
+	flagSet.StringVar(&settings.Name, "name", "", "the display name of the operation")
+	flagSet.StringVar(&settings.Source, "source", "", "the folder to copy from")
+	flagSet.Var(&destinations, "dest", "a folder to copy to; repeat for each destination")
+	flagSet.StringVar(&settings.Replace, "replace", "", "how to handle existing files: never, skip or always")
+	flagSet.StringVar(&settings.Schedule, "schedule", "", "when the daemon runs the operation: an interval, such as 6h, or a cron expression")
+	err := flagSet.Parse(args[2:])
+	if err != nil {
+		return exitConfigError
+	}
+	settings.Destinations = destinations
+
+	switch subCommand {
+	case "add":
+		err = copylib.AddOperation(configFile, key, settings)
+	case "set":
+		err = copylib.SetOperation(configFile, key, settings)
+	case "remove":
+		err = copylib.RemoveOperation(configFile, key)
+	default:
+		err = fmt.Errorf("unknown op command \"%s\"; expected add, set or remove", subCommand)
+	}
+
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error updating operation \"%s\": %s", key, err))
+		return exitConfigError
+	}
+
+	copylib.PrintAlways(fmt.Sprintf("operation \"%s\" was %s %s", key, opCommandVerb(subCommand), configFile))
+
+	return exitSuccess
+}
+
+// opCommandVerb returns the past tense of the op command, for reporting what was done.
+func opCommandVerb(subCommand string) string {
+	switch subCommand {
+	case "add":
+		return "added to"
+	case "set":
+		return "updated in"
+	}
+
+	return "removed from"
 }
 
 // runOperation executes the file copy operation defined in the configuration.
-func runOperation() bool {
+// When --all is given, every operation that applies to this machine is run in turn, until one is interrupted.
+func runOperation(ctx context.Context) int {
+	var options []copylib.Option
+	if rescanManifests {
+		options = append(options, copylib.WithRescan())
+	}
+
+	if runAllOperations {
+		var exitCodes []int
+		for _, key := range copylib.ApplicableOperations(os.Hostname) {
+			if ctx.Err() != nil {
+				copylib.PrintWarning(fmt.Sprintf("operation \"%s\" was not started, because go-copy was interrupted", key), "operation", key)
+				exitCodes = append(exitCodes, exitInterrupted)
+				continue
+			}
+			exitCodes = append(exitCodes, runNamedOperation(ctx, key, commandLockMode(), options...))
+		}
+		return combineExitCodes(exitCodes)
+	}
+
 	if len(operation) < 1 {
-		panic("the operation flag is required; it defines which operation in the config to execute...")
+		copylib.PrintError("the operation flag is required; it defines which operation in the config to execute...")
+		return exitConfigError
+	}
+
+	return runNamedOperation(ctx, operation, commandLockMode(), options...)
+}
+
+// runNamedOperation executes a single operation from the configuration, and remembers how it went.
+// The mode says what happens if another run is using the operation or one of its destinations.
+func runNamedOperation(ctx context.Context, operationKey string, mode lockMode, options ...copylib.Option) int {
+	options = append(options, copylib.WithEvents(printEvent))
+	if mode == lockWait {
+		options = append(options, copylib.WithLockWait(ctx))
 	}
 
-	copyFileRunner, err := copylib.NewRunner(operation)
+	configMutex.Lock()
+	copyFileRunner, err := copylib.NewRunner(operationKey, options...)
+	configMutex.Unlock()
 	if err != nil {
-		copylib.PrintError(fmt.Sprintf("error initializing runner for operation \"%s\": %s", operation, err))
-		return false
+		copylib.PrintError(fmt.Sprintf("error initializing runner for operation \"%s\": %s", operationKey, err), "operation", operationKey, "error", err)
+		return exitConfigError
 	}
 
-	go copyFileRunner.Copy()
+	// the locks are taken once the config is no longer needed, so waiting for them never holds up the daemon
+	lockExitCode := lockRun(ctx, copyFileRunner, fmt.Sprintf("operation \"%s\"", operationKey), mode)
+	if lockExitCode != exitSuccess {
+		return lockExitCode
+	}
+
+	runExitCode := runCopy(ctx, copyFileRunner)
+	recordRun(operationKey, copyFileRunner, runExitCode)
+
+	return runExitCode
+}
+
+// recordRun adds the run to the history; a run that cannot be recorded has still happened, so it is only a warning.
+func recordRun(operationKey string, copyFileRunner *copylib.Runner, runExitCode int) {
+	err := copylib.RecordRun(operationKey, copyFileRunner, runExitCode)
+	if err != nil {
+		copylib.PrintWarning(fmt.Sprintf("unable to add the run to the history: %s", err))
+	}
+}
+
+// lockMode is what a run does when another run is using its operation or one of its destinations.
+type lockMode int
+
+const (
+	// lockFail stops the run straight away, suggesting --wait.
+	lockFail lockMode = iota
+	// lockWait waits for the other run to finish.
+	lockWait
+	// lockSkip stops the run straight away; it is for scheduled runs, which come due again later.
+	lockSkip
+)
+
+// commandLockMode returns the lock mode asked for with --wait.
+func commandLockMode() lockMode {
+	if waitForLocks {
+		return lockWait
+	}
+
+	return lockFail
+}
+
+// lockRun takes the locks of the run, and explains why it cannot start if another run holds one of them.
+// A run that was waiting for the locks when go-copy was interrupted was interrupted, rather than locked out.
+// It returns exitSuccess once the run holds its locks.
+func lockRun(ctx context.Context, copyFileRunner *copylib.Runner, runName string, mode lockMode) int {
+	err := copyFileRunner.Lock()
+	if err == nil {
+		return exitSuccess
+	} else if !errors.Is(err, copylib.ErrLocked) {
+		copylib.PrintError(fmt.Sprintf("%s was not started, as it could not be locked: %s", runName, err))
+		return exitFailed
+	} else if ctx.Err() != nil {
+		copylib.PrintWarning(fmt.Sprintf("%s was not started, because go-copy was interrupted while waiting for %s", runName, err))
+		return exitInterrupted
+	} else if mode == lockSkip {
+		copylib.PrintError(fmt.Sprintf("%s was skipped, as it is in use: %s", runName, err))
+		return exitLocked
+	}
+
+	copylib.PrintError(fmt.Sprintf("%s was not started: %s", runName, err))
+	copylib.PrintError("use --wait to wait for the other run to finish instead")
+
+	return exitLocked
+}
+
+// runCopy runs the copy and waits for it to finish; the progress and the stats are displayed by printEvent.
+// An interrupted copy is never a successful one, even when every file it reached was copied.
+func runCopy(ctx context.Context, copyFileRunner *copylib.Runner) int {
+	go copyFileRunner.Copy(ctx)
 
 	copyFileRunner.Waiter.Wait()
 
-	stats := color.New(color.FgBlue, color.Bold)
-	copylib.PrintColor(stats, "\nStats:")
-	copylib.PrintStats("    Total Files Copied: ", fmt.Sprintf("%d (%d)", copyFileRunner.Stats.TotalFilesCopied/2, copyFileRunner.Stats.TotalFilesCopied))
-	copylib.PrintStats("    Total Files Skipped: ", fmt.Sprintf("%d (%d)", copyFileRunner.Stats.TotalFilesSkipped/2, copyFileRunner.Stats.TotalFilesSkipped))
-	copylib.PrintStats("    Number of Source Files: ", fmt.Sprintf("%d", copyFileRunner.Stats.NumberOfSourceFiles))
-	copylib.PrintStats("    Number of Destinations: ", fmt.Sprintf("%d", copyFileRunner.Stats.NumberOfDestinations))
-	printer := message.NewPrinter(language.English)
-	copylib.PrintStats("    Bytes Copied: ", printer.Sprintf("%d", copyFileRunner.Stats.BytesCopied))
-	copylib.PrintStats("    Time to Copy: ", fmt.Sprintf("%f", copyFileRunner.Stats.TimeToCopy.Seconds()))
-	copylib.PrintStats("    Warnings: ", fmt.Sprintf("%d", copyFileRunner.Stats.NumberOfWarnings))
-	copylib.PrintStats("    Errors: ", fmt.Sprintf("%d", copyFileRunner.Stats.NumberOfErrors))
-	copylib.PrintStats("    Operation: ", operation)
-	color.White("\nAll done...\n\n")
+	// only keep the results when they are needed, as the daemon runs copies for as long as it is left running
+	if len(reportFile) > 0 {
+		reportResults = append(reportResults, copyFileRunner.Result)
+	}
 
-	if pauseAtEnd {
-		pauseOutput()
+	return exitCodeForStats(copyFileRunner.Stats)
+}
+
+// writeReport writes the results of the operations that were run to the --report file, if one was given.
+func writeReport() {
+	if len(reportFile) == 0 {
+		return
 	}
 
-	return copyFileRunner.Stats.NumberOfErrors == 0
+	err := copylib.WriteReport(reportFile, reportResults)
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error writing the report to %s: %s", reportFile, err))
+		if exitCode == exitSuccess {
+			exitCode = exitFailed
+		}
+		return
+	}
+
+	copylib.Print(fmt.Sprintf("the report was written to %s", reportFile))
+}
+
+// printEvent displays the progress of a run, what happens to each file and the final stats, from the events of the run.
+func printEvent(event copylib.Event) {
+	switch event.Type {
+	case copylib.EventFileCopied, copylib.EventFileSkipped, copylib.EventFileFailed, copylib.EventFileRetrying:
+		copylib.PrintFileEvent(event)
+	case copylib.EventOperationStarted:
+		copylib.PrintDebug(fmt.Sprintf("starting operation \"%s\"", event.Operation), "operation", event.Operation)
+	case copylib.EventDirectoryEntered:
+		copylib.PrintDebug(fmt.Sprintf("entering folder \"%s\"", path.Join(".", event.Path)), "operation", event.Operation, "file", event.Path)
+	case copylib.EventBytesProgress:
+		if event.Size > 0 && event.Bytes < event.Size {
+			copylib.PrintDebug(fmt.Sprintf("copying \"%s\" to %s: %d%%", event.Path, event.Destination, event.Bytes*100/event.Size),
+				"operation", event.Operation, "file", event.Path, "destination", event.Destination, "action", "copy", "bytes", event.Bytes)
+		}
+	case copylib.EventOperationFinished:
+		if event.Stats != nil {
+			printStats(event.Operation, event.Stats)
+		}
+	}
+}
+
+// printStats displays the stats of a run once it has finished.
+func printStats(operationName string, runStats *copylib.Stats) {
+	copylib.PrintRunStats(operationName, runStats)
+	if runStats.Interrupted {
+		copylib.PrintColor(color.New(color.FgWhite), "\nStopped...\n")
+		return
+	}
+	copylib.PrintColor(color.New(color.FgWhite), "\nAll done...\n")
 }
 
 // directUserToCreateConfigFile prompts the user to create an empty YAML config file in the appropriate location for the OS.
@@ -155,8 +525,13 @@ func directUserToCreateConfigFile() {
 // parseArguments processes the command-line arguments and sets the appropriate variables.
 func parseArguments() {
 	flag.BoolVar(&displayBuildInformation, "version", false, "display build & version information")
-	flag.StringVar(&operation, "operation", "", "defines the operation to execute (required)")
+	flag.StringVar(&operation, "operation", "", "defines the operation to execute (required, unless --all is used)")
+	flag.BoolVar(&runAllOperations, "all", false, "execute every operation that applies to this machine (optional)")
 	flag.BoolVar(&listConfigs, "list", false, "list all backup sets in the config")
+	flag.StringVar(&listFormat, "format", copylib.ListFormatTable, "the format used by --list: table, json or yaml (optional)")
+	flag.StringVar(&reportFile, "report", "", "write what happened to every file to this JSON file (optional)")
+	flag.BoolVar(&waitForLocks, "wait", false, "wait for other runs of the operation, or of its destinations, to finish, instead of failing (optional)")
+	flag.BoolVar(&rescanManifests, "rescan", false, "rebuild the manifest of each destination from the files in it (optional)")
 	flag.BoolVar(&pauseAtEnd, "pause", false, "determines if the app will pause before ending (optional)")
 	flag.BoolVar(&logModeSilent, "silent", false, "logging out put will be sparse (optional)")
 	flag.BoolVar(&logModeSimple, "simple", false, "logging out put will be normal (optional)")
@@ -164,9 +539,16 @@ func parseArguments() {
 	flag.BoolVar(&logModeInfo, "info", false, "logging out put will be at the info level (optional)")
 	flag.BoolVar(&logModeDebug, "debug", false, "logging out put will be at the debug level (optional)")
 	flag.BoolVar(&logModeVerbose, "verbose", false, "logging out put will be verbose (optional)")
+	flag.StringVar(&logFormat, "log-format", copylib.LogFormatText, "the format of the output: text, in color on a terminal, or json (optional)")
+	flag.StringVar(&logFile, "log-file", "", "also write the log to this file, in place of the file in the log section of the config (optional)")
 
 	flag.Parse()
 
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+		commandArgs = flag.Args()[1:]
+	}
+
 	if logModeSilent {
 		logMode = copylib.LogSilent
 	} else if logModeSimple {
@@ -183,7 +565,19 @@ func parseArguments() {
 		logMode = copylib.LogInfo
 	}
 
+	// keep the output of a machine readable list, history, verify or status free of anything else
+	if listConfigs && listFormat != copylib.ListFormatTable ||
+		(command == "history" || command == "verify" || command == "status") && commandFormat(commandArgs) != copylib.ListFormatTable {
+		logMode = copylib.LogSilent
+	}
+
 	copylib.SetLogMode(logMode)
+
+	err := copylib.SetLogFormat(logFormat)
+	if err != nil {
+		copylib.PrintError(err.Error())
+		os.Exit(exitConfigError)
+	}
 }
 
 // pauseOutput prompts the user to press enter before continuing, effectively pausing the output.
@@ -200,10 +594,12 @@ func handleExit() {
 		errOutput := fmt.Sprintf("panic occurred:\n    %v", recovery)
 		copylib.PrintError(errOutput)
 		copylib.PrintError("go-copy has stopped with an error")
-		os.Exit(1)
+		os.Exit(exitFailed)
 	} else if finishedSuccessfully {
-		if len(operation) > 0 {
-			copylib.PrintAlways(fmt.Sprintf("go-copy has completed operation \"%s\" successfully", operation))
+		if runAllOperations {
+			copylib.PrintAlways("go-copy has completed all operations successfully")
+		} else if len(operation) > 0 {
+			copylib.PrintAlways(fmt.Sprintf("go-copy has completed operation \"%s\" successfully", operation), "operation", operation)
 		}
 	}
 }
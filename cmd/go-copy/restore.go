@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/andrewlader/go-copy/internal/copylib"
+)
+
+// runRestoreCommand handles the "restore" command, which copies the files of an operation from one of its
+// destinations back to its source, or to another folder. Restores are not added to the history, as they are not
+// runs of the operation.
+func runRestoreCommand(ctx context.Context, args []string) int {
+	var operationKey string
+	var settings copylib.RestoreSettings
+	var paths stringListFlag
+
+	flagSet := flag.NewFlagSet("restore", flag.ContinueOnError)
+	flagSet.StringVar(&operationKey, "operation", operation, "the operation to restore (required)")
+	flagSet.StringVar(&settings.From, "from", "", "the label or path of the destination to restore from, or another folder holding a backup (optional)")
+	flagSet.StringVar(&settings.To, "to", "", "the folder to restore to, instead of the source (optional)")
+	flagSet.Var(&paths, "path", "a file or folder to restore, relative to the source; repeat for each one (optional)")
+	flagSet.StringVar(&settings.Replace, "replace", "skip", "how to handle files that already exist: never, skip or always (optional)")
+	flagSet.StringVar(&settings.SafetyFolder, "safety-folder", "", "where files are moved to before they are replaced (optional)")
+	flagSet.BoolVar(&settings.DryRun, "dry-run", false, "show what would be restored, without changing anything (optional)")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return exitConfigError
+	}
+	settings.Paths = paths
+
+	if len(operationKey) == 0 {
+		copylib.PrintError("the operation flag is required; it defines which operation to restore...")
+		return exitConfigError
+	}
+
+	mode := commandLockMode()
+	options := []copylib.Option{copylib.WithEvents(printEvent)}
+	if mode == lockWait {
+		options = append(options, copylib.WithLockWait(ctx))
+	}
+
+	configMutex.Lock()
+	restoreRunner, err := copylib.NewRestoreRunner(operationKey, settings, options...)
+	configMutex.Unlock()
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error initializing the restore of operation \"%s\": %s", operationKey, err), "operation", operationKey, "error", err)
+		return exitConfigError
+	}
+
+	lockExitCode := lockRun(ctx, restoreRunner, fmt.Sprintf("the restore of operation \"%s\"", operationKey), mode)
+	if lockExitCode != exitSuccess {
+		return lockExitCode
+	}
+
+	if settings.DryRun {
+		copylib.PrintAlways("this is a dry run, so nothing will be changed; the files copied are those that would be restored")
+	}
+
+	runExitCode := runCopy(ctx, restoreRunner)
+
+	replaced := 0
+	for _, file := range restoreRunner.Result.Files {
+		for _, dest := range file.Destinations {
+			if dest.Outcome == copylib.FileReplaced {
+				replaced++
+			}
+		}
+	}
+	if replaced > 0 && !settings.DryRun {
+		copylib.PrintAlways(fmt.Sprintf("the %d file(s) that were replaced have been moved to %s", replaced, restoreRunner.SafetyFolder()))
+	}
+
+	return runExitCode
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/andrewlader/go-copy/internal/copylib"
+)
+
+// runStatusCommand handles the "status" command, which shows how far behind each destination of an operation is,
+// by working out what the next copy would copy or replace, without copying anything.
+func runStatusCommand(ctx context.Context, args []string) int {
+	var operationKey string
+	var listPendingFiles bool
+	var format string
+
+	flagSet := flag.NewFlagSet("status", flag.ContinueOnError)
+	flagSet.StringVar(&operationKey, "operation", operation, "the operation to show the status of (required)")
+	flagSet.BoolVar(&listPendingFiles, "files", false, "list the files that would be copied or replaced at each destination (optional)")
+	flagSet.StringVar(&format, "format", copylib.ListFormatTable, "the format of the status: table or json (optional)")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return exitConfigError
+	}
+
+	if len(operationKey) == 0 {
+		copylib.PrintError("the operation flag is required; it defines which operation to show the status of...")
+		return exitConfigError
+	} else if format != copylib.ListFormatTable && format != copylib.ListFormatJSON {
+		copylib.PrintError(fmt.Sprintf("unknown status format \"%s\"; expected table or json", format))
+		return exitConfigError
+	}
+
+	// only the loading of the operation needs the config, so walking a large source does not hold up anything else using it
+	configMutex.Lock()
+	snapshot, err := copylib.LoadOperation(operationKey, os.Hostname)
+	configMutex.Unlock()
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error getting the status of operation \"%s\": %s", operationKey, err))
+		return exitConfigError
+	}
+
+	status, err := snapshot.Status(ctx)
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error getting the status of operation \"%s\": %s", operationKey, err))
+		return exitConfigError
+	}
+
+	err = status.Print(format, listPendingFiles)
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error showing the status: %s", err))
+		return exitFailed
+	}
+
+	if status.Interrupted {
+		copylib.PrintWarning("the status was interrupted, so not every file was looked at")
+		return exitInterrupted
+	}
+
+	return exitSuccess
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/andrewlader/go-copy/internal/copylib"
+)
+
+// runVerifyCommand handles the "verify" command, which compares each destination of an operation to its source
+// without copying anything, and fails with exitDrift if any of them are missing files or have copies that differ,
+// or with exitFailed if some of them could not be read.
+func runVerifyCommand(ctx context.Context, args []string) int {
+	var operationKey string
+	var checksum bool
+	var format string
+
+	flagSet := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flagSet.StringVar(&operationKey, "operation", operation, "the operation to verify (required)")
+	flagSet.BoolVar(&checksum, "checksum", false, "compare the contents of files that match in size and modified time, which reads every file (optional)")
+	flagSet.StringVar(&format, "format", copylib.ListFormatTable, "the format of the results: table or json (optional)")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return exitConfigError
+	}
+
+	if len(operationKey) == 0 {
+		copylib.PrintError("the operation flag is required; it defines which operation to verify...")
+		return exitConfigError
+	} else if format != copylib.ListFormatTable && format != copylib.ListFormatJSON {
+		copylib.PrintError(fmt.Sprintf("unknown verify format \"%s\"; expected table or json", format))
+		return exitConfigError
+	}
+
+	// only the loading of the operation needs the config, so a long verify does not hold up anything else using it
+	configMutex.Lock()
+	snapshot, err := copylib.LoadOperation(operationKey, os.Hostname)
+	configMutex.Unlock()
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error verifying operation \"%s\": %s", operationKey, err))
+		return exitConfigError
+	}
+
+	verification, err := snapshot.Verify(ctx, checksum)
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error verifying operation \"%s\": %s", operationKey, err))
+		return exitConfigError
+	}
+
+	err = verification.Print(format)
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error showing the results of the verify: %s", err))
+		return exitFailed
+	}
+
+	switch {
+	case verification.Interrupted:
+		copylib.PrintWarning("the verify was interrupted, so not every file was compared")
+		return exitInterrupted
+	case verification.HasErrors():
+		copylib.PrintError(fmt.Sprintf("operation \"%s\" could not be fully verified, as some destinations or files could not be read", operationKey))
+		return exitFailed
+	case verification.HasDrift():
+		copylib.PrintError(fmt.Sprintf("operation \"%s\" has drifted: some destinations are missing files or have copies that differ from the source", operationKey))
+		return exitDrift
+	}
+
+	copylib.PrintAlways(fmt.Sprintf("every destination of operation \"%s\" matches its source", operationKey))
+
+	return exitSuccess
+}
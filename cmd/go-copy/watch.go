@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/andrewlader/go-copy/internal/copylib"
+)
+
+// runWatchCommand handles the "watch" command, which copies the files of an operation that change soon after they
+// change, until it is interrupted. Only the changed files and folders are copied, using the operation's replace mode.
+func runWatchCommand(ctx context.Context, args []string) int {
+	var operationKey string
+	var delay time.Duration
+	var maxDelay time.Duration
+	var initialCopy bool
+
+	flagSet := flag.NewFlagSet("watch", flag.ContinueOnError)
+	flagSet.StringVar(&operationKey, "operation", operation, "the operation whose source is watched (required)")
+	flagSet.DurationVar(&delay, "delay", 2*time.Second, "how long the files must stop changing before they are copied (optional)")
+	flagSet.DurationVar(&maxDelay, "max-delay", time.Minute, "the longest time to wait for files that keep changing (optional)")
+	flagSet.BoolVar(&initialCopy, "initial", false, "copy the whole source before watching it (optional)")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return exitConfigError
+	}
+
+	if len(operationKey) == 0 {
+		copylib.PrintError("the operation flag is required; it defines which operation's source to watch...")
+		return exitConfigError
+	} else if delay <= 0 {
+		copylib.PrintError("the delay must be greater than zero")
+		return exitConfigError
+	}
+
+	source, err := copylib.OperationSource(operationKey, os.Hostname)
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error loading operation \"%s\": %s", operationKey, err), "operation", operationKey, "error", err)
+		return exitConfigError
+	}
+
+	watcher, err := copylib.NewSourceWatcher(source, delay, maxDelay)
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error watching %s: %s", source, err))
+		return exitFailed
+	}
+	defer watcher.Close()
+
+	// a batch waits for any other run of the operation to finish, instead of losing the changes
+	exitCodes := []int{}
+	if initialCopy {
+		exitCode := runNamedOperation(ctx, operationKey, lockWait)
+		if exitCode != exitSuccess {
+			copylib.PrintError(fmt.Sprintf("the initial copy with operation \"%s\" finished with exit code %d", operationKey, exitCode),
+				"operation", operationKey, "exit_code", exitCode)
+		}
+		exitCodes = append(exitCodes, exitCode)
+	}
+
+	copylib.PrintAlways(fmt.Sprintf("watching %s for changes to copy with operation \"%s\"; press Ctrl-C to stop", source, operationKey))
+	err = watcher.Run(ctx, func(ctx context.Context, paths []string) {
+		copylib.PrintAlways(fmt.Sprintf("copying %d changed path(s) with operation \"%s\" at %s", len(paths), operationKey, time.Now().Format(time.DateTime)))
+		for _, changedPath := range paths {
+			copylib.PrintDebug(fmt.Sprintf("changed: %s", changedPath))
+		}
+		exitCode := runNamedOperation(ctx, operationKey, lockWait, copylib.WithPaths(paths))
+		if exitCode != exitSuccess {
+			copylib.PrintError(fmt.Sprintf("copying %d changed path(s) with operation \"%s\" finished with exit code %d", len(paths), operationKey, exitCode),
+				"operation", operationKey, "exit_code", exitCode)
+		}
+		exitCodes = append(exitCodes, exitCode)
+	})
+	if err != nil {
+		copylib.PrintError(fmt.Sprintf("error watching %s: %s", source, err))
+		return exitFailed
+	}
+	copylib.PrintAlways("stopped watching for changes")
+
+	// like a run of several operations, watch exits with how its copies went together
+	return combineExitCodes(exitCodes)
+}
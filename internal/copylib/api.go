@@ -0,0 +1,326 @@
+package copylib
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReplaceMode decides what happens when a file already exists at a destination.
+type ReplaceMode string
+
+const (
+	// ReplaceNever copies new files, but never replaces existing ones.
+	ReplaceNever ReplaceMode = "never"
+	// ReplaceSkip replaces existing files, unless they match the date and size of the source file.
+	ReplaceSkip ReplaceMode = "skip"
+	// ReplaceAlways always replaces existing files.
+	ReplaceAlways ReplaceMode = "always"
+)
+
+// Operation describes a copy from a source folder to one or more destinations.
+// It holds the same settings as an operation in the config file.
+type Operation struct {
+	// Key identifies the operation; it is used for the {operation} placeholder in destination paths.
+	Key string
+	// Name is the display name of the operation; it defaults to the Key.
+	Name string
+	// Source is the folder to copy from.
+	Source string
+	// Destinations are the places to copy to; at least one must be enabled.
+	Destinations []Destination
+	// Replace is the replace mode for every destination without its own; it defaults to ReplaceSkip.
+	Replace ReplaceMode
+	// Pre and Post are commands run before and after the copy.
+	Pre  []Hook
+	Post []Hook
+	// HookTimeout is how long each hook without its own timeout may run; it defaults to five minutes.
+	HookTimeout time.Duration
+	// Retry decides which failed copies are tried again; the zero value never retries.
+	Retry Retry
+	// Manifest keeps a list of the files at each destination, so they do not need to be looked up; the zero value keeps none.
+	Manifest Manifest
+	// Schedule is when "go-copy daemon" runs the operation: an interval, such as "6h", or a cron expression,
+	// such as "0 3 * * *". Empty means it is only run when asked.
+	Schedule string
+	// Hosts and OperatingSystems limit the machines the operation runs on; empty means any.
+	Hosts            []string
+	OperatingSystems []string
+}
+
+// Destination is a single place an Operation copies to.
+type Destination struct {
+	// Path is the folder to copy to. It may contain the {date}, {date:<layout>}, {host} and {operation} placeholders.
+	Path string
+	// Label is a friendly name used in the output instead of the path.
+	Label string
+	// Replace is the replace mode for this destination only; empty means the operation's.
+	Replace ReplaceMode
+	// Disabled stops copying to the destination.
+	Disabled bool
+	// Optional destinations that are offline are skipped with a warning instead of an error.
+	Optional bool
+	// Exclude lists file patterns that are not copied to this destination.
+	Exclude []string
+}
+
+// Hook is a command run through the shell of the OS before or after an operation copies its files.
+type Hook struct {
+	Command string
+	// Timeout is how long the command may run; zero means the operation's HookTimeout.
+	Timeout time.Duration
+}
+
+// Retry decides which files that fail to copy to a destination are tried again, and when.
+type Retry struct {
+	// Count is how many times a failed copy is tried again before the file is reported as failed.
+	Count int
+	// Backoff is the wait before the first retry, which doubles after each retry up to MaxBackoff.
+	// They default to one second and one minute.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// On lists the classes of errors that are retried: "timeout", "network", "io", "busy", "no-space",
+	// "permission", "not-found", "other" or "all". It defaults to "timeout", "network", "io" and "busy".
+	On []string
+}
+
+// Manifest decides if each destination keeps a list of the files in it, used to decide which files to skip
+// without looking them up at the destination.
+type Manifest struct {
+	Enabled bool
+	// Hash adds the SHA-256 of each file copied to the list.
+	Hash bool
+}
+
+// Config holds the operations read from a go-copy config file, keyed by the lower case operation key.
+type Config struct {
+	Operations map[string]Operation
+}
+
+// LoadConfig reads and validates a go-copy config file, without using viper or any other global state.
+// The source and destinations of each operation are those for this OS.
+func LoadConfig(filename string) (*Config, error) {
+	var settings map[string]interface{}
+
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(contents, &settings)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", filename, err)
+	}
+
+	config := &Config{Operations: make(map[string]Operation, len(settings))}
+	for key, value := range settings {
+		key = strings.ToLower(key)
+		if isReservedKey(key) {
+			err = checkLogSection(value)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		operationSettings, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("the configuration for \"%s\" is not a mapping", key)
+		}
+
+		configObj, err := newConfiguration(lowerCaseKeys(operationSettings))
+		if err != nil {
+			return nil, fmt.Errorf("the configuration for \"%s\" is invalid: %s", key, err)
+		}
+		configObj.key = key
+
+		config.Operations[key] = configObj.operation()
+	}
+
+	return config, nil
+}
+
+// Keys returns the keys of the operations, sorted.
+func (config *Config) Keys() []string {
+	keys := make([]string, 0, len(config.Operations))
+	for key := range config.Operations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Operation returns the operation with the given key, ignoring case.
+func (config *Config) Operation(key string) (Operation, bool) {
+	operation, ok := config.Operations[strings.ToLower(key)]
+	return operation, ok
+}
+
+// configuration validates the operation and converts it into the form the copy engine uses.
+func (operation Operation) configuration() (*configuration, error) {
+	config, err := newConfiguration(operation.toMap())
+	if err != nil {
+		return nil, err
+	}
+	config.key = operation.Key
+
+	return config, nil
+}
+
+// toMap returns the operation in the same form viper provides for an operation in the config file.
+func (operation Operation) toMap() map[string]interface{} {
+	name := operation.Name
+	if len(name) == 0 {
+		name = operation.Key
+	}
+
+	replace := operation.Replace
+	if len(replace) == 0 {
+		replace = ReplaceSkip
+	}
+
+	destinations := make([]interface{}, 0, len(operation.Destinations))
+	for _, dest := range operation.Destinations {
+		destSettings := map[string]interface{}{
+			"path":     dest.Path,
+			"label":    dest.Label,
+			"enabled":  !dest.Disabled,
+			"required": !dest.Optional,
+			"exclude":  toInterfaceList(dest.Exclude),
+		}
+		if len(dest.Replace) > 0 {
+			destSettings["replace"] = string(dest.Replace)
+		}
+		destinations = append(destinations, destSettings)
+	}
+
+	settings := map[string]interface{}{
+		"name":         name,
+		"source":       operation.Source,
+		"destinations": destinations,
+		"replace":      string(replace),
+	}
+
+	if operation.HookTimeout > 0 {
+		settings["hook_timeout"] = operation.HookTimeout.String()
+	}
+	if len(operation.Pre) > 0 {
+		settings["pre"] = hooksToList(operation.Pre)
+	}
+	if len(operation.Post) > 0 {
+		settings["post"] = hooksToList(operation.Post)
+	}
+	if len(operation.Schedule) > 0 {
+		settings["schedule"] = operation.Schedule
+	}
+	if operation.Retry.Count > 0 {
+		settings["retry"] = operation.Retry.toMap()
+	}
+	if operation.Manifest.Enabled {
+		settings["manifest"] = map[string]interface{}{"hash": operation.Manifest.Hash}
+	}
+	if len(operation.Hosts) > 0 {
+		settings["hosts"] = toInterfaceList(operation.Hosts)
+	}
+	if len(operation.OperatingSystems) > 0 {
+		settings["os"] = toInterfaceList(operation.OperatingSystems)
+	}
+
+	return settings
+}
+
+// operation converts the configuration back into its public form.
+func (config *configuration) operation() Operation {
+	operation := Operation{
+		Key:              config.key,
+		Name:             config.name,
+		Source:           config.source,
+		Replace:          ReplaceMode(config.replace.String()),
+		Pre:              hooksToPublic(config.preHooks),
+		Post:             hooksToPublic(config.postHooks),
+		HookTimeout:      config.hookTimeout,
+		Manifest:         Manifest{Enabled: config.manifest.enabled, Hash: config.manifest.hash},
+		Hosts:            config.selector.hosts,
+		OperatingSystems: config.selector.operatingSystems,
+	}
+
+	if config.schedule != nil {
+		operation.Schedule = config.schedule.String()
+	}
+	if config.retry.count > 0 {
+		operation.Retry = Retry{
+			Count:      config.retry.count,
+			Backoff:    config.retry.backoff,
+			MaxBackoff: config.retry.maxBackoff,
+			On:         config.retry.classes,
+		}
+	}
+
+	for _, dest := range config.destinations {
+		operation.Destinations = append(operation.Destinations, Destination{
+			Path:     dest.path,
+			Label:    dest.label,
+			Replace:  ReplaceMode(dest.replace.String()),
+			Disabled: !dest.enabled,
+			Optional: !dest.required,
+			Exclude:  dest.exclude,
+		})
+	}
+
+	return operation
+}
+
+// toMap returns the retry settings in the same form as they are written in the config file.
+func (retry Retry) toMap() map[string]interface{} {
+	settings := map[string]interface{}{"count": retry.Count}
+	if retry.Backoff > 0 {
+		settings["backoff"] = retry.Backoff.String()
+	}
+	if retry.MaxBackoff > 0 {
+		settings["max_backoff"] = retry.MaxBackoff.String()
+	}
+	if len(retry.On) > 0 {
+		settings["on"] = toInterfaceList(retry.On)
+	}
+
+	return settings
+}
+
+// hooksToList returns the hooks in the same form as they are written in the config file.
+func hooksToList(hooks []Hook) []interface{} {
+	list := make([]interface{}, 0, len(hooks))
+	for _, hookObj := range hooks {
+		hookSettings := map[string]interface{}{"command": hookObj.Command}
+		if hookObj.Timeout > 0 {
+			hookSettings["timeout"] = hookObj.Timeout.String()
+		}
+		list = append(list, hookSettings)
+	}
+
+	return list
+}
+
+// hooksToPublic converts the hooks into their public form.
+func hooksToPublic(hooks []hook) []Hook {
+	var public []Hook
+	for _, hookObj := range hooks {
+		public = append(public, Hook{Command: hookObj.command, Timeout: hookObj.timeout})
+	}
+
+	return public
+}
+
+// toInterfaceList converts a slice of strings into the form viper provides for a list.
+func toInterfaceList(values []string) []interface{} {
+	list := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		list = append(list, value)
+	}
+
+	return list
+}
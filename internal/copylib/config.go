@@ -2,7 +2,9 @@ package copylib
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -16,77 +18,364 @@ const (
 )
 
 type configuration struct {
+	key          string
 	name         string
 	source       string
-	destinations []string
+	destinations []destination
 	replace      replaceMode
+	preHooks     []hook
+	postHooks    []hook
+	hookTimeout  time.Duration
+	selector     machineSelector
+	retry        retryPolicy
+	schedule     *Schedule
+	manifest     manifestSettings
 }
 
-// print displaysa text representation of the configuration.
-func (config *configuration) print() {
-	if config == nil {
-		return
-	}
-
-	// dests := strings.Join(config.destinations, ", ")
-	replaceStr := "unknown"
-	switch config.replace {
+// String returns the text form of the replace mode, as it is written in the config file.
+func (mode replaceMode) String() string {
+	switch mode {
 	case replaceNever:
-		replaceStr = "never"
+		return "never"
 	case replaceSkipIfSame:
-		replaceStr = "skip"
+		return "skip"
 	case replaceAlways:
-		replaceStr = "always"
+		return "always"
+	}
+
+	return "unknown"
+}
+
+// OperationSnapshot is an operation loaded from the config file, with its paths expanded, so it can be looked at
+// without holding on to the config file, which may be reloaded in the meantime.
+type OperationSnapshot struct {
+	key    string
+	config *configuration
+}
+
+// LoadOperation takes a snapshot of the operation with the given key in the loaded config file, making sure it applies
+// to this machine. The hostname function returns the name of this machine, which is usually os.Hostname.
+func LoadOperation(operationKey string, hostname func() (string, error)) (*OperationSnapshot, error) {
+	config, err := getConfiguration(operationKey, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.expandPathTemplates(time.Now(), hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OperationSnapshot{key: operationKey, config: config}, nil
+}
+
+// getConfiguration loads the operation with the given key, making sure it applies to the machine named by hostname.
+func getConfiguration(key string, hostname func() (string, error)) (*configuration, error) {
+	config, err := loadConfiguration(key)
+	if err != nil {
+		return nil, err
 	}
 
-	PrintKeyValue("Name: ", config.name)
-	PrintKeyValue("  Source: ", config.source)
-	PrintKeyValueArray("  Destinations: ", config.destinations)
-	PrintKeyValue("  Replace: ", replaceStr)
+	err = config.checkAppliesToThisMachine(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
 }
 
-// ListConfigurations displays the string representations for all configurations.
-func ListConfigurations() {
-	keys := viper.AllSettings()
-	for key := range keys {
-		cfg := getConfiguration(key)
-		if cfg != nil {
-			cfg.print()
+// checkAppliesToThisMachine fails if the operation loaded from the config file does not apply to the machine named by hostname.
+func (config *configuration) checkAppliesToThisMachine(hostname func() (string, error)) error {
+	applies, reason := config.selector.appliesToThisMachine(hostname)
+	if !applies {
+		return fmt.Errorf("the operation \"%s\" does not apply to this machine, as %s", config.key, reason)
+	}
+
+	return nil
+}
+
+// ApplicableOperations returns the keys, sorted, of the operations in the config that apply to the machine named by
+// hostname, which is usually os.Hostname. Operations that are not valid are included, so that trying to run them
+// reports what is wrong.
+func ApplicableOperations(hostname func() (string, error)) []string {
+	var applicable []string
+
+	for _, key := range operationKeys() {
+		config, err := loadConfiguration(key)
+		if err == nil {
+			if applies, _ := config.selector.appliesToThisMachine(hostname); !applies {
+				continue
+			}
 		}
+		applicable = append(applicable, key)
 	}
+
+	return applicable
 }
 
-func getConfiguration(key string) *configuration {
-	var destinations []string
+// operationKeys returns the keys of all the operations in the config, sorted, leaving out the log settings.
+func operationKeys() []string {
+	keys := make([]string, 0, len(viper.AllSettings()))
+	for key := range viper.AllSettings() {
+		if !isReservedKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
 
-	config := viper.GetStringMap(key)
-	if len(config) == 0 {
-		PrintError(fmt.Sprintf("no configuration was found for: %s", key))
+	return keys
+}
+
+// isReservedKey checks if the key of a top level section of the config file is used for something other than an operation.
+func isReservedKey(key string) bool {
+	return strings.EqualFold(key, logSettingsKey)
+}
+
+// checkLogSection fails when the "log" section of the config file has the settings of an operation, as an
+// operation with that key would otherwise never run, with nothing but a warning about unknown log settings.
+func checkLogSection(setting interface{}) error {
+	logSettings, ok := setting.(map[string]interface{})
+	if !ok {
 		return nil
 	}
 
-	dests := config["destinations"].([]interface{})
+	for key := range lowerCaseKeys(logSettings) {
+		switch key {
+		case "name", "source", "destinations", "replace":
+			return fmt.Errorf("%w, but it has the \"%s\" setting of one; rename the operation", ErrLogSectionIsOperation, key)
+		}
+	}
+
+	return nil
+}
+
+// loadConfiguration reads and validates the operation with the given key from the config file.
+func loadConfiguration(key string) (*configuration, error) {
+	config := viper.GetStringMap(key)
+	if len(config) == 0 || isReservedKey(key) {
+		return nil, fmt.Errorf("no configuration was found for: %s", key)
+	}
+
+	configObj, err := newConfiguration(config)
+	if err != nil {
+		return nil, fmt.Errorf("the configuration for \"%s\" is invalid: %s", key, err)
+	}
+	configObj.key = key
+
+	return configObj, nil
+}
+
+// newConfiguration builds a configuration from the raw settings of a single operation, validating it along the way.
+// Every OS variant of the source and destinations is validated, but only the one for this OS is kept.
+func newConfiguration(settings map[string]interface{}) (*configuration, error) {
+	name, err := getRequiredString(settings, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	replaceStr, err := getRequiredString(settings, "replace")
+	if err != nil {
+		return nil, err
+	}
+
+	replace, err := parseReplaceMode(replaceStr)
+	if err != nil {
+		return nil, err
+	}
+
+	selector, err := newMachineSelector(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceVariants := getOSVariants(settings["source"])
+	for osName, variant := range sourceVariants {
+		source, ok := variant.(string)
+		if !ok || len(strings.TrimSpace(source)) == 0 {
+			return nil, fmt.Errorf("\"source\" is required%s", osVariantSuffix(osName))
+		}
+	}
 
-	for _, destInst := range dests {
-		destinations = append(destinations, destInst.(string))
+	destinationVariants := getOSVariants(settings["destinations"])
+	for osName, variant := range destinationVariants {
+		_, err = newDestinations(variant, replace)
+		if err != nil {
+			return nil, fmt.Errorf("%s%s", err, osVariantSuffix(osName))
+		}
 	}
 
 	configObj := &configuration{
-		name:         config["name"].(string),
-		source:       config["source"].(string),
-		destinations: destinations,
+		name:     name,
+		replace:  replace,
+		selector: selector,
+	}
+
+	source, sourceFound := selectOSVariant(sourceVariants)
+	destinations, destinationsFound := selectOSVariant(destinationVariants)
+	if sourceFound && destinationsFound {
+		configObj.source = source.(string)
+		configObj.destinations, _ = newDestinations(destinations, replace)
+	} else {
+		configObj.selector.missingForOS = true
+	}
+
+	err = configObj.applyHookSettings(settings)
+	if err != nil {
+		return nil, err
 	}
 
-	switch strings.ToLower(config["replace"].(string)) {
+	if schedule, ok := settings["schedule"]; ok {
+		configObj.schedule, err = newSchedule(schedule)
+		if err != nil {
+			return nil, fmt.Errorf("\"schedule\" %s", err)
+		}
+	}
+
+	if retry, ok := settings["retry"]; ok {
+		configObj.retry, err = newRetryPolicy(retry)
+		if err != nil {
+			return nil, fmt.Errorf("\"retry\" %s", err)
+		}
+	}
+
+	if manifest, ok := settings["manifest"]; ok {
+		configObj.manifest, err = newManifestSettings(manifest)
+		if err != nil {
+			return nil, fmt.Errorf("\"manifest\" %s", err)
+		}
+	}
+
+	return configObj, nil
+}
+
+// newDestinations builds the list of destinations from the config file, making sure at least one is enabled.
+func newDestinations(setting interface{}, defaultReplace replaceMode) ([]destination, error) {
+	var destinations []destination
+
+	dests, ok := setting.([]interface{})
+	if !ok || len(dests) == 0 {
+		return nil, fmt.Errorf("at least one destination is required")
+	}
+
+	enabledCount := 0
+	for index, destInst := range dests {
+		dest, err := newDestination(destInst, defaultReplace)
+		if err != nil {
+			return nil, fmt.Errorf("destination %d is not valid: %s", index+1, err)
+		}
+		if dest.enabled {
+			enabledCount++
+		}
+		destinations = append(destinations, dest)
+	}
+
+	if enabledCount == 0 {
+		return nil, fmt.Errorf("at least one destination must be enabled")
+	}
+
+	return destinations, nil
+}
+
+// osVariantSuffix describes which OS variant of a setting an error is about.
+func osVariantSuffix(osName string) string {
+	if osName == defaultOSKey {
+		return ""
+	}
+
+	return fmt.Sprintf(" (for %s)", osName)
+}
+
+// applyHookSettings reads the commands to run before and after the copy, and how long they are allowed to run.
+func (config *configuration) applyHookSettings(settings map[string]interface{}) error {
+	var err error
+
+	hookTimeout := defaultHookTimeout
+	if timeout, ok := settings["hook_timeout"]; ok {
+		hookTimeout, err = parseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("\"hook_timeout\" %s", err)
+		}
+		config.hookTimeout = hookTimeout
+	}
+
+	if pre, ok := settings["pre"]; ok {
+		config.preHooks, err = newHooks(pre, hookTimeout)
+		if err != nil {
+			return fmt.Errorf("\"pre\" %s", err)
+		}
+	}
+
+	if post, ok := settings["post"]; ok {
+		config.postHooks, err = newHooks(post, hookTimeout)
+		if err != nil {
+			return fmt.Errorf("\"post\" %s", err)
+		}
+	}
+
+	return nil
+}
+
+// parseReplaceMode converts the text form of a replace mode, as found in the config file, into a replaceMode.
+func parseReplaceMode(value string) (replaceMode, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
 	case "always":
-		configObj.replace = replaceAlways
+		return replaceAlways, nil
 
 	case "never":
-		configObj.replace = replaceNever
+		return replaceNever, nil
 
 	case "skip":
-		configObj.replace = replaceSkipIfSame
+		return replaceSkipIfSame, nil
+	}
+
+	return replaceNever, fmt.Errorf("replace must be one of \"never\", \"skip\" or \"always\", not \"%s\"", value)
+}
+
+// getRequiredString returns the named setting as a non-empty string, or an error if it is missing or of the wrong type.
+func getRequiredString(settings map[string]interface{}, key string) (string, error) {
+	value, ok := settings[key].(string)
+	if !ok || len(strings.TrimSpace(value)) == 0 {
+		return "", fmt.Errorf("\"%s\" is required", key)
+	}
+
+	return value, nil
+}
+
+// getOptionalBool returns the named setting as a bool, or the default value if it is not present.
+func getOptionalBool(settings map[string]interface{}, key string, defaultValue bool) (bool, error) {
+	value, ok := settings[key]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	boolValue, ok := value.(bool)
+	if !ok {
+		return defaultValue, fmt.Errorf("\"%s\" must be true or false", key)
+	}
+
+	return boolValue, nil
+}
+
+// getStringList converts a setting that is a list of text values, or a single text value, into a slice of strings.
+func getStringList(value interface{}) ([]string, error) {
+	switch list := value.(type) {
+	case string:
+		return []string{list}, nil
+
+	case []string:
+		return list, nil
+
+	case []interface{}:
+		values := make([]string, 0, len(list))
+		for _, item := range list {
+			text, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("must be a list of text values")
+			}
+			values = append(values, text)
+		}
+		return values, nil
 	}
 
-	return configObj
+	return nil, fmt.Errorf("must be a list of text values")
 }
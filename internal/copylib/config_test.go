@@ -0,0 +1,279 @@
+package copylib
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestNewConfigurationWithDestinationSettingsSuccess(t *testing.T) {
+	settings := map[string]interface{}{
+		"name":    "Foo",
+		"source":  "/games/foo/saves",
+		"replace": "skip",
+		"destinations": []interface{}{
+			"/backups/one/foo",
+			map[string]interface{}{
+				"path":     "/backups/usb/foo",
+				"label":    "USB",
+				"replace":  "always",
+				"required": false,
+				"exclude":  []interface{}{"*.tmp", "cache/*"},
+			},
+			map[string]interface{}{
+				"path":    "/backups/old/foo",
+				"enabled": false,
+			},
+		},
+	}
+
+	config, err := newConfiguration(settings)
+	if err != nil {
+		t.Fatalf("unexpected error creating configuration: %s", err)
+	}
+
+	if len(config.destinations) != 3 {
+		t.Fatalf("expected 3 destinations, but there were %d", len(config.destinations))
+	}
+
+	first := config.destinations[0]
+	if first.replace != replaceSkipIfSame || !first.enabled || !first.required {
+		t.Errorf("the first destination did not get the default settings: %s", first.String())
+	}
+
+	second := config.destinations[1]
+	if second.label != "USB" || second.replace != replaceAlways || second.required {
+		t.Errorf("the second destination did not get its own settings: %s", second.String())
+	}
+	if !second.isExcluded("cache/foo.sav") || !second.isExcluded("saves/foo.tmp") || second.isExcluded("saves/foo.sav") {
+		t.Errorf("the exclude patterns of the second destination were not applied correctly")
+	}
+
+	if config.destinations[2].enabled {
+		t.Errorf("the third destination should be disabled")
+	}
+}
+
+func TestNewConfigurationInvalidDestinationFailure(t *testing.T) {
+	settings := map[string]interface{}{
+		"name":    "Foo",
+		"source":  "/games/foo/saves",
+		"replace": "skip",
+		"destinations": []interface{}{
+			map[string]interface{}{
+				"label":    "no path",
+				"required": "sometimes",
+			},
+		},
+	}
+
+	_, err := newConfiguration(settings)
+	if err == nil {
+		t.Errorf("expected an error for a destination without a path")
+	}
+}
+
+func TestNewConfigurationWithHooksSuccess(t *testing.T) {
+	settings := map[string]interface{}{
+		"name":         "Foo",
+		"source":       "/games/foo/saves",
+		"replace":      "skip",
+		"destinations": []interface{}{"/backups/one/foo"},
+		"hook_timeout": "30s",
+		"pre":          []interface{}{"systemctl stop foo-server"},
+		"post": []interface{}{
+			"systemctl start foo-server",
+			map[string]interface{}{
+				"command": "notify-send done",
+				"timeout": 5,
+			},
+		},
+	}
+
+	config, err := newConfiguration(settings)
+	if err != nil {
+		t.Fatalf("unexpected error creating configuration: %s", err)
+	}
+
+	if len(config.preHooks) != 1 || config.preHooks[0].timeout != 30*time.Second {
+		t.Errorf("the pre hook was not read correctly: %v", config.preHooks)
+	}
+	if len(config.postHooks) != 2 || config.postHooks[1].command != "notify-send done" || config.postHooks[1].timeout != 5*time.Second {
+		t.Errorf("the post hooks were not read correctly: %v", config.postHooks)
+	}
+}
+
+func TestNewConfigurationWithRetrySuccess(t *testing.T) {
+	settings := map[string]interface{}{
+		"name":         "Foo",
+		"source":       "/games/foo/saves",
+		"replace":      "skip",
+		"destinations": []interface{}{"/backups/one/foo"},
+		"retry": map[string]interface{}{
+			"count":   5,
+			"backoff": "2s",
+			"on":      []interface{}{"network", "Timeout"},
+		},
+	}
+
+	config, err := newConfiguration(settings)
+	if err != nil {
+		t.Fatalf("unexpected error creating configuration: %s", err)
+	}
+
+	retry := config.retry
+	if retry.count != 5 || retry.backoff != 2*time.Second || retry.maxBackoff != defaultRetryMaxBackoff {
+		t.Errorf("the retry settings were not read correctly: %+v", retry)
+	}
+	if len(retry.classes) != 2 || retry.classes[0] != errorClassNetwork || retry.classes[1] != errorClassTimeout {
+		t.Errorf("expected to retry network errors and timeouts, but got %v", retry.classes)
+	}
+	if retry.delay(1) != 2*time.Second || retry.delay(3) != 8*time.Second || retry.delay(10) != time.Minute {
+		t.Errorf("expected the backoff to double up to a minute, but got %s, %s and %s", retry.delay(1), retry.delay(3), retry.delay(10))
+	}
+
+	settings["retry"] = map[string]interface{}{"on": "sometimes"}
+	_, err = newConfiguration(settings)
+	if err == nil {
+		t.Errorf("expected an unknown error class to be invalid")
+	}
+}
+
+func TestNewConfigurationWithOSVariantsSuccess(t *testing.T) {
+	settings := map[string]interface{}{
+		"name":    "Foo",
+		"replace": "skip",
+		"source": map[string]interface{}{
+			runtime.GOOS: "/games/foo/saves",
+			"default":    "/other/foo/saves",
+		},
+		"destinations": map[string]interface{}{
+			"default": []interface{}{"/backups/one/foo", "/backups/two/foo"},
+		},
+	}
+
+	config, err := newConfiguration(settings)
+	if err != nil {
+		t.Fatalf("unexpected error creating configuration: %s", err)
+	}
+
+	if config.source != "/games/foo/saves" {
+		t.Errorf("expected the source for %s, but got %s", runtime.GOOS, config.source)
+	}
+	if len(config.destinations) != 2 {
+		t.Errorf("expected the 2 default destinations, but there were %d", len(config.destinations))
+	}
+	if applies, reason := config.selector.appliesToThisMachine(os.Hostname); !applies {
+		t.Errorf("expected the operation to apply to this machine, but it does not, as %s", reason)
+	}
+}
+
+func TestNewConfigurationForOtherMachinesSuccess(t *testing.T) {
+	otherOS := "plan9"
+	if runtime.GOOS == otherOS {
+		otherOS = "linux"
+	}
+
+	hostname := func() (string, error) { return "gaming-pc.example.com", nil }
+
+	missingForOS := map[string]interface{}{
+		"name":         "Foo",
+		"replace":      "skip",
+		"source":       map[string]interface{}{otherOS: "/games/foo/saves"},
+		"destinations": []interface{}{"/backups/one/foo"},
+	}
+
+	otherOSOnly := map[string]interface{}{
+		"name":         "Foo",
+		"replace":      "skip",
+		"os":           otherOS,
+		"source":       "/games/foo/saves",
+		"destinations": []interface{}{"/backups/one/foo"},
+	}
+
+	otherHost := map[string]interface{}{
+		"name":         "Foo",
+		"replace":      "skip",
+		"hosts":        []interface{}{"laptop", "office-*"},
+		"source":       "/games/foo/saves",
+		"destinations": []interface{}{"/backups/one/foo"},
+	}
+
+	thisHost := map[string]interface{}{
+		"name":         "Foo",
+		"replace":      "skip",
+		"hosts":        []interface{}{"laptop", "Gaming-*"},
+		"source":       "/games/foo/saves",
+		"destinations": []interface{}{"/backups/one/foo"},
+	}
+
+	for _, settings := range []map[string]interface{}{missingForOS, otherOSOnly, otherHost} {
+		config, err := newConfiguration(settings)
+		if err != nil {
+			t.Fatalf("unexpected error creating configuration: %s", err)
+		}
+		if applies, _ := config.selector.appliesToThisMachine(hostname); applies {
+			t.Errorf("expected the operation not to apply to this machine: %v", settings)
+		}
+	}
+
+	config, err := newConfiguration(thisHost)
+	if err != nil {
+		t.Fatalf("unexpected error creating configuration: %s", err)
+	}
+	if applies, reason := config.selector.appliesToThisMachine(hostname); !applies {
+		t.Errorf("expected the operation to apply to this host, but it does not, as %s", reason)
+	}
+}
+
+func TestExpandPathTemplatesSuccess(t *testing.T) {
+	settings := map[string]interface{}{
+		"name":    "Foo",
+		"replace": "skip",
+		"source":  "/games/foo/saves",
+		"destinations": []interface{}{
+			"/backups/{host}/{operation}/{date}",
+			"/backups/{operation}/{date:2006/01/02-1504}",
+			"/backups/{3F2504E0-4F89-11D3-9A0C-0305E82C3301}/{operation}",
+		},
+	}
+
+	config, err := newConfiguration(settings)
+	if err != nil {
+		t.Fatalf("unexpected error creating configuration: %s", err)
+	}
+	config.key = "foo"
+
+	hostname := func() (string, error) { return "gaming-pc", nil }
+	err = config.expandPathTemplates(time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC), hostname)
+	if err != nil {
+		t.Fatalf("unexpected error expanding the templates: %s", err)
+	}
+
+	if config.destinations[0].path != "/backups/gaming-pc/foo/2024-03-05" {
+		t.Errorf("the first destination was not expanded correctly: %s", config.destinations[0].path)
+	}
+	if config.destinations[1].path != "/backups/foo/2024/03/05-1430" {
+		t.Errorf("the second destination was not expanded correctly: %s", config.destinations[1].path)
+	}
+	if config.destinations[2].path != "/backups/{3F2504E0-4F89-11D3-9A0C-0305E82C3301}/foo" {
+		t.Errorf("expected text in braces that is not a name to be left as it is: %s", config.destinations[2].path)
+	}
+}
+
+func TestNewConfigurationUnknownPlaceholderFailure(t *testing.T) {
+	for _, destPath := range []string{"/backups/{user}/foo", "/backups/{hots}/foo", "/backups/{Date}/foo", "/backups/{host:x}/foo", "/backups/{date:}/foo"} {
+		settings := map[string]interface{}{
+			"name":         "Foo",
+			"replace":      "skip",
+			"source":       "/games/foo/saves",
+			"destinations": []interface{}{destPath},
+		}
+
+		_, err := newConfiguration(settings)
+		if err == nil {
+			t.Errorf("expected an error for the placeholder in %s", destPath)
+		}
+	}
+}
@@ -0,0 +1,768 @@
+package copylib
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OperationSettings holds the values used to add or edit an operation in the config file.
+// Fields left empty are not written, which lets SetOperation change only what was supplied.
+type OperationSettings struct {
+	Name         string
+	Source       string
+	Destinations []string
+	Replace      string
+	Schedule     string
+}
+
+// toMap returns the settings in the same form viper provides for an operation in the config file.
+func (settings OperationSettings) toMap() map[string]interface{} {
+	destinations := make([]interface{}, 0, len(settings.Destinations))
+	for _, destination := range settings.Destinations {
+		destinations = append(destinations, destination)
+	}
+
+	operationSettings := map[string]interface{}{
+		"name":         settings.Name,
+		"source":       settings.Source,
+		"destinations": destinations,
+		"replace":      settings.Replace,
+	}
+	if len(settings.Schedule) > 0 {
+		operationSettings["schedule"] = settings.Schedule
+	}
+
+	return operationSettings
+}
+
+// settingChange is a single setting to write to an operation, whose value is either a string or a list of strings.
+type settingChange struct {
+	key   string
+	value interface{}
+}
+
+// changes returns the non-empty settings, in the order they are written to the config file.
+func (settings OperationSettings) changes() []settingChange {
+	var changes []settingChange
+	if len(settings.Name) > 0 {
+		changes = append(changes, settingChange{"name", settings.Name})
+	}
+	if len(settings.Source) > 0 {
+		changes = append(changes, settingChange{"source", settings.Source})
+	}
+	if len(settings.Destinations) > 0 {
+		changes = append(changes, settingChange{"destinations", settings.Destinations})
+	}
+	if len(settings.Replace) > 0 {
+		changes = append(changes, settingChange{"replace", strings.ToLower(settings.Replace)})
+	}
+	if len(settings.Schedule) > 0 {
+		changes = append(changes, settingChange{"schedule", settings.Schedule})
+	}
+
+	return changes
+}
+
+// AddOperation adds a new operation after the last one in the config file, leaving the rest of the file untouched.
+func AddOperation(configFile string, key string, settings OperationSettings) error {
+	configText, err := loadConfigText(configFile)
+	if err != nil {
+		return err
+	}
+
+	if isReservedKey(key) {
+		return fmt.Errorf("\"%s\" is used for the log settings, so it cannot be the name of an operation", key)
+	} else if findKeyIndex(configText.root, key) >= 0 {
+		return fmt.Errorf("an operation named \"%s\" already exists", key)
+	}
+
+	operationNode := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	applyOperationSettings(operationNode, settings)
+
+	err = validateOperationNode(operationNode)
+	if err != nil {
+		return err
+	}
+
+	operationText, err := encodeEntry(key, operationNode, configText.indent)
+	if err != nil {
+		return err
+	}
+
+	// insert the operation after the last one, so comments at the end of the file stay at the end
+	insertAt := len(configText.lines)
+	if len(configText.root.Content) > 0 {
+		_, insertAt = configText.operationLines(len(configText.root.Content) - 2)
+	}
+	if insertAt > 0 {
+		operationText = append([]string{""}, operationText...)
+	}
+	configText.replaceLines(insertAt, insertAt, operationText)
+
+	return configText.save()
+}
+
+// SetOperation changes the supplied settings of an existing operation in the config file. Only the values that change
+// are rewritten, so the quoting, comments and layout of the rest of the operation are kept.
+func SetOperation(configFile string, key string, settings OperationSettings) error {
+	configText, err := loadConfigText(configFile)
+	if err != nil {
+		return err
+	}
+
+	index := findKeyIndex(configText.root, key)
+	if index < 0 || isReservedKey(key) {
+		return fmt.Errorf("no operation named \"%s\" was found in %s", key, configFile)
+	}
+
+	keyNode := configText.root.Content[index]
+	operationNode := configText.root.Content[index+1]
+	if operationNode.Kind != yaml.MappingNode {
+		return fmt.Errorf("the operation \"%s\" is not a mapping", key)
+	}
+
+	edited, err := configText.editOperation(index, settings)
+	if err != nil {
+		return err
+	} else if edited {
+		return configText.save()
+	}
+
+	// the values could not be edited in place, such as for an operation written as a flow mapping, so rewrite all of it
+	applyOperationSettings(operationNode, settings)
+
+	err = validateOperationNode(operationNode)
+	if err != nil {
+		return err
+	}
+
+	operationText, err := encodeEntry(keyNode.Value, operationNode, configText.indent)
+	if err != nil {
+		return err
+	}
+
+	// the comments above the operation are left where they are, so only replace from the key onwards
+	_, end := configText.operationLines(index)
+	configText.replaceLines(keyNode.Line-1, end, operationText)
+
+	return configText.save()
+}
+
+// RemoveOperation deletes an operation, along with the comments directly above it, from the config file.
+func RemoveOperation(configFile string, key string) error {
+	configText, err := loadConfigText(configFile)
+	if err != nil {
+		return err
+	}
+
+	index := findKeyIndex(configText.root, key)
+	if index < 0 || isReservedKey(key) {
+		return fmt.Errorf("no operation named \"%s\" was found in %s", key, configFile)
+	}
+
+	start, end := configText.operationLines(index)
+
+	// also remove the blank lines that separated the operation from the next one
+	for end < len(configText.lines) && len(strings.TrimSpace(configText.lines[end])) == 0 {
+		end++
+	}
+	configText.replaceLines(start, end, nil)
+
+	return configText.save()
+}
+
+// configText holds the lines of the config file along with its parsed node tree,
+// so single operations can be rewritten without disturbing the formatting of the rest of the file.
+type configText struct {
+	filename string
+	lines    []string
+	root     *yaml.Node
+	indent   int
+	newline  string
+}
+
+// loadConfigText reads and parses the config file.
+func loadConfigText(configFile string) (*configText, error) {
+	if len(configFile) == 0 {
+		return nil, fmt.Errorf("no config file is loaded")
+	}
+
+	contents, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	document := &yaml.Node{}
+	err = yaml.Unmarshal(contents, document)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", configFile, err)
+	}
+
+	configText := &configText{
+		filename: configFile,
+		indent:   2,
+		newline:  "\n",
+	}
+
+	if document.Kind == 0 {
+		// the file is empty (or only has comments), so there are no operations yet
+		configText.root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	} else if document.Kind == yaml.DocumentNode && len(document.Content) > 0 && document.Content[0].Kind == yaml.MappingNode {
+		configText.root = document.Content[0]
+	} else {
+		return nil, fmt.Errorf("the config file %s does not contain a mapping of operations", configFile)
+	}
+
+	text := string(contents)
+	if strings.Contains(text, "\r\n") {
+		configText.newline = "\r\n"
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	text = strings.TrimRight(text, "\n")
+	if len(text) > 0 {
+		configText.lines = strings.Split(text, "\n")
+	}
+
+	// keep the indentation the file already uses
+	for index := 1; index < len(configText.root.Content); index += 2 {
+		operationNode := configText.root.Content[index]
+		if operationNode.Kind == yaml.MappingNode && len(operationNode.Content) > 0 {
+			configText.indent = operationNode.Content[0].Column - 1
+			break
+		}
+	}
+
+	return configText, nil
+}
+
+// operationLines returns the range of lines, [start, end), used by the operation whose key is at the given index,
+// including the comments directly above it, but not the blank lines or comments that lead into the next operation.
+func (configText *configText) operationLines(index int) (int, int) {
+	start := configText.root.Content[index].Line - 1
+	for start > 0 && isTopLevelComment(configText.lines[start-1]) {
+		start--
+	}
+
+	end := len(configText.lines)
+	if index+2 < len(configText.root.Content) {
+		end = configText.root.Content[index+2].Line - 1
+	}
+	for end > start+1 && (len(strings.TrimSpace(configText.lines[end-1])) == 0 || isTopLevelComment(configText.lines[end-1])) {
+		end--
+	}
+
+	return start, end
+}
+
+// replaceLines swaps the lines in [start, end) for the new lines.
+func (configText *configText) replaceLines(start int, end int, newLines []string) {
+	lines := make([]string, 0, len(configText.lines)-(end-start)+len(newLines))
+	lines = append(lines, configText.lines[:start]...)
+	lines = append(lines, newLines...)
+	lines = append(lines, configText.lines[end:]...)
+
+	configText.lines = lines
+}
+
+// save writes the lines back to the config file, replacing it only once the new contents are fully written.
+func (configText *configText) save() error {
+	contents := strings.Join(configText.lines, configText.newline) + configText.newline
+
+	mode := os.FileMode(0644)
+	fileInfo, err := os.Stat(configText.filename)
+	if err == nil {
+		mode = fileInfo.Mode().Perm()
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(configText.filename), ".go-copy-config-*.yaml")
+	if err != nil {
+		return err
+	}
+	tempFilename := tempFile.Name()
+	defer os.Remove(tempFilename)
+
+	_, err = tempFile.WriteString(contents)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	closeErr := tempFile.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = os.Chmod(tempFilename, mode)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempFilename, configText.filename)
+}
+
+// lineEdit replaces the lines in [start, end) of the config file with new lines.
+type lineEdit struct {
+	start int
+	end   int
+	lines []string
+}
+
+// editOperation rewrites only the values of the operation whose key is at the given index that the settings change,
+// leaving every other line as it is. It returns false, without changing anything, when the operation is laid out in
+// a way that cannot be edited line by line, such as a flow mapping.
+func (configText *configText) editOperation(index int, settings OperationSettings) (bool, error) {
+	keyNode := configText.root.Content[index]
+	operationNode := configText.root.Content[index+1]
+	if operationNode.Style&yaml.FlowStyle != 0 || len(operationNode.Content) == 0 {
+		return false, nil
+	}
+
+	// what the operation should hold once it is edited, to check the edits against
+	var expected map[string]interface{}
+	err := operationNode.Decode(&expected)
+	if err != nil {
+		return false, err
+	}
+	expected = lowerCaseKeys(expected)
+
+	_, operationEnd := configText.operationLines(index)
+	var edits []lineEdit
+	for _, change := range settings.changes() {
+		settingEdits, ok := configText.settingEdits(operationNode, operationEnd, change)
+		if !ok {
+			return false, nil
+		}
+		edits = append(edits, settingEdits...)
+
+		expected[change.key] = change.value
+		if values, ok := change.value.([]string); ok {
+			sequence := make([]interface{}, 0, len(values))
+			for _, value := range values {
+				sequence = append(sequence, value)
+			}
+			expected[change.key] = sequence
+		}
+	}
+
+	// apply the edits from the bottom up, so the line numbers of the ones above are still right
+	lines := append([]string(nil), configText.lines...)
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	for editIndex := len(edits) - 1; editIndex >= 0; editIndex-- {
+		edit := edits[editIndex]
+		lines = append(lines[:edit.start], append(append([]string(nil), edit.lines...), lines[edit.end:]...)...)
+	}
+
+	// make sure the edited file reads back as the settings that were asked for before keeping it
+	document := &yaml.Node{}
+	err = yaml.Unmarshal([]byte(strings.Join(lines, "\n")), document)
+	if err != nil || document.Kind != yaml.DocumentNode || len(document.Content) == 0 {
+		return false, nil
+	}
+	editedIndex := findKeyIndex(document.Content[0], keyNode.Value)
+	if editedIndex < 0 {
+		return false, nil
+	}
+	editedNode := document.Content[0].Content[editedIndex+1]
+	var edited map[string]interface{}
+	err = editedNode.Decode(&edited)
+	if err != nil || !reflect.DeepEqual(lowerCaseKeys(edited), expected) {
+		return false, nil
+	}
+
+	err = validateOperationNode(editedNode)
+	if err != nil {
+		return false, err
+	}
+
+	configText.lines = lines
+
+	return true, nil
+}
+
+// settingEdits returns the edits that write a single setting of the operation, changing only its value where it can.
+func (configText *configText) settingEdits(operationNode *yaml.Node, operationEnd int, change settingChange) ([]lineEdit, bool) {
+	index := findKeyIndex(operationNode, change.key)
+	if index < 0 {
+		// a new setting goes after the last one
+		_, end := configText.settingLines(operationNode, len(operationNode.Content)-2, operationEnd)
+		lines, ok := configText.encodeSetting(operationNode.Content[0].Column-1, change.key, change.value, 0)
+		return []lineEdit{{start: end, end: end, lines: lines}}, ok
+	}
+
+	keyNode := operationNode.Content[index]
+	valueNode := operationNode.Content[index+1]
+	switch value := change.value.(type) {
+	case string:
+		if valueNode.Kind == yaml.ScalarNode {
+			edit, ok := configText.scalarEdit(valueNode, value)
+			if ok {
+				return []lineEdit{edit}, true
+			}
+		}
+	case []string:
+		if valueNode.Kind == yaml.SequenceNode {
+			edits, ok := configText.sequenceEdits(valueNode, value)
+			if ok {
+				return edits, true
+			}
+		}
+	}
+
+	// the value cannot be changed where it is, such as a block scalar, so rewrite just this setting
+	start, end := configText.settingLines(operationNode, index, operationEnd)
+	lines, ok := configText.encodeSetting(keyNode.Column-1, keyNode.Value, change.value, valueNode.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle))
+	return []lineEdit{{start: start, end: end, lines: lines}}, ok
+}
+
+// settingLines returns the range of lines, [start, end), used by the setting whose key is at the given index
+// of the operation, not including the blank lines or comments that lead into the next setting.
+func (configText *configText) settingLines(operationNode *yaml.Node, index int, operationEnd int) (int, int) {
+	start := operationNode.Content[index].Line - 1
+
+	end := operationEnd
+	if index+2 < len(operationNode.Content) {
+		end = operationNode.Content[index+2].Line - 1
+	}
+	for end > start+1 {
+		line := strings.TrimSpace(configText.lines[end-1])
+		if len(line) > 0 && !strings.HasPrefix(line, "#") {
+			break
+		}
+		end--
+	}
+
+	return start, end
+}
+
+// encodeSetting renders a setting as lines of YAML, indented to sit in the operation.
+func (configText *configText) encodeSetting(indent int, key string, value interface{}, style yaml.Style) ([]string, bool) {
+	valueNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Style: style}
+	if values, ok := value.([]string); ok {
+		valueNode = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, value := range values {
+			valueNode.Content = append(valueNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: style})
+		}
+	} else {
+		valueNode.Value = value.(string)
+	}
+
+	lines, err := encodeEntry(key, valueNode, configText.indent)
+	if err != nil {
+		return nil, false
+	}
+	for index := range lines {
+		lines[index] = strings.Repeat(" ", indent) + lines[index]
+	}
+
+	return lines, true
+}
+
+// scalarEdit changes a scalar value where it is on its line, keeping its quoting and any comment after it.
+func (configText *configText) scalarEdit(valueNode *yaml.Node, value string) (lineEdit, bool) {
+	if valueNode.Tag == "!!null" || valueNode.Style&^(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+		return lineEdit{}, false
+	}
+
+	text, ok := encodeScalar(value, valueNode.Style)
+	line := configText.lines[valueNode.Line-1]
+	start := columnOffset(line, valueNode.Column)
+	end := scalarEnd(line, start, valueNode.Style)
+	if !ok || end < 0 {
+		return lineEdit{}, false
+	}
+
+	return lineEdit{start: valueNode.Line - 1, end: valueNode.Line, lines: []string{line[:start] + text + line[end:]}}, true
+}
+
+// sequenceEdits changes the values of a sequence of scalars, keeping the quoting of the values and any comments.
+// Values are changed where they are, added after the last one, or removed along with their lines.
+func (configText *configText) sequenceEdits(sequenceNode *yaml.Node, values []string) ([]lineEdit, bool) {
+	for _, item := range sequenceNode.Content {
+		if item.Kind != yaml.ScalarNode {
+			return nil, false
+		}
+	}
+	style := yaml.Style(0)
+	if len(sequenceNode.Content) > 0 {
+		style = sequenceNode.Content[0].Style
+	}
+
+	if sequenceNode.Style&yaml.FlowStyle != 0 {
+		sequence := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+		for _, value := range values {
+			sequence.Content = append(sequence.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: style})
+		}
+		contents, err := yaml.Marshal(sequence)
+		text := strings.TrimSuffix(string(contents), "\n")
+
+		line := configText.lines[sequenceNode.Line-1]
+		start := columnOffset(line, sequenceNode.Column)
+		end := flowSequenceEnd(line, start)
+		if err != nil || end < 0 || strings.Contains(text, "\n") {
+			return nil, false
+		}
+
+		return []lineEdit{{start: sequenceNode.Line - 1, end: sequenceNode.Line, lines: []string{line[:start] + text + line[end:]}}}, true
+	}
+
+	if len(sequenceNode.Content) == 0 {
+		return nil, false
+	}
+
+	var edits []lineEdit
+	for index, item := range sequenceNode.Content {
+		if index >= len(values) {
+			edits = append(edits, lineEdit{start: item.Line - 1, end: item.Line})
+			continue
+		}
+
+		edit, ok := configText.scalarEdit(item, values[index])
+		if !ok {
+			return nil, false
+		}
+		edits = append(edits, edit)
+	}
+
+	// new values go after the last one, in the same form
+	last := sequenceNode.Content[len(sequenceNode.Content)-1]
+	line := configText.lines[last.Line-1]
+	prefix := line[:columnOffset(line, last.Column)]
+	var added []string
+	for _, value := range values[min(len(values), len(sequenceNode.Content)):] {
+		text, ok := encodeScalar(value, last.Style)
+		if !ok {
+			return nil, false
+		}
+		added = append(added, prefix+text)
+	}
+	if len(added) > 0 {
+		edits = append(edits, lineEdit{start: last.Line, end: last.Line, lines: added})
+	}
+
+	return edits, true
+}
+
+// encodeScalar renders a string in the given quoting style, quoting it anyway when it would not read back as a string.
+func encodeScalar(value string, style yaml.Style) (string, bool) {
+	contents, err := yaml.Marshal(&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: style})
+	text := strings.TrimSuffix(string(contents), "\n")
+
+	return text, err == nil && !strings.Contains(text, "\n")
+}
+
+// columnOffset returns the byte offset in the line of a column reported by the YAML parser, which counts characters from 1.
+func columnOffset(line string, column int) int {
+	characters := 1
+	for offset := range line {
+		if characters == column {
+			return offset
+		}
+		characters++
+	}
+
+	return len(line)
+}
+
+// scalarEnd returns the byte offset in the line just after the scalar starting at the given offset,
+// or -1 when it does not end on the same line.
+func scalarEnd(line string, start int, style yaml.Style) int {
+	switch style {
+	case yaml.DoubleQuotedStyle:
+		for index := start + 1; index < len(line); index++ {
+			if line[index] == '\\' {
+				index++
+			} else if line[index] == '"' {
+				return index + 1
+			}
+		}
+		return -1
+	case yaml.SingleQuotedStyle:
+		for index := start + 1; index < len(line); index++ {
+			if line[index] == '\'' {
+				if index+1 < len(line) && line[index+1] == '\'' {
+					index++
+					continue
+				}
+				return index + 1
+			}
+		}
+		return -1
+	}
+
+	end := len(line)
+	if comment := strings.Index(line[start:], " #"); comment >= 0 {
+		end = start + comment
+	}
+
+	return len(strings.TrimRight(line[:end], " \t"))
+}
+
+// flowSequenceEnd returns the byte offset in the line just after the flow sequence starting at the given offset,
+// or -1 when it does not end on the same line.
+func flowSequenceEnd(line string, start int) int {
+	depth := 0
+	for index := start; index < len(line); index++ {
+		switch line[index] {
+		case '"', '\'':
+			style := yaml.DoubleQuotedStyle
+			if line[index] == '\'' {
+				style = yaml.SingleQuotedStyle
+			}
+			end := scalarEnd(line, index, style)
+			if end < 0 {
+				return -1
+			}
+			index = end - 1
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return index + 1
+			}
+		}
+	}
+
+	return -1
+}
+
+// encodeEntry renders a single key and its value, such as an operation, as lines of YAML.
+func encodeEntry(key string, valueNode *yaml.Node, indent int) ([]string, error) {
+	var buffer bytes.Buffer
+
+	mapping := &yaml.Node{
+		Kind: yaml.MappingNode,
+		Tag:  "!!map",
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+			valueNode,
+		},
+	}
+
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(indent)
+	err := encoder.Encode(mapping)
+	if err != nil {
+		return nil, err
+	}
+	encoder.Close()
+
+	return strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n"), nil
+}
+
+// isTopLevelComment reports whether the line is a comment that is not indented under an operation.
+func isTopLevelComment(line string) bool {
+	return strings.HasPrefix(line, "#")
+}
+
+// findKeyIndex returns the index of the key node in the mapping, or -1 if it does not exist.
+// Keys are matched without regard to case, the same way viper looks them up.
+func findKeyIndex(mapping *yaml.Node, key string) int {
+	for index := 0; index+1 < len(mapping.Content); index += 2 {
+		if strings.EqualFold(mapping.Content[index].Value, key) {
+			return index
+		}
+	}
+
+	return -1
+}
+
+// applyOperationSettings writes the non-empty settings into the operation's mapping node.
+func applyOperationSettings(operationNode *yaml.Node, settings OperationSettings) {
+	for _, change := range settings.changes() {
+		if values, ok := change.value.([]string); ok {
+			setSequenceValue(operationNode, change.key, values)
+		} else {
+			setScalarValue(operationNode, change.key, change.value.(string))
+		}
+	}
+}
+
+// setScalarValue sets a scalar value in the mapping, keeping any comments attached to an existing value.
+func setScalarValue(mapping *yaml.Node, key string, value string) {
+	valueNode := findMappingValue(mapping, key)
+	if valueNode != nil && valueNode.Kind == yaml.ScalarNode {
+		valueNode.Value = value
+		valueNode.Tag = "!!str"
+		valueNode.Style = 0
+		return
+	}
+
+	newNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	setMappingValue(mapping, key, newNode)
+}
+
+// setSequenceValue sets a sequence of strings in the mapping, replacing any existing value.
+func setSequenceValue(mapping *yaml.Node, key string, values []string) {
+	sequenceNode := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, value := range values {
+		sequenceNode.Content = append(sequenceNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+	}
+
+	valueNode := findMappingValue(mapping, key)
+	if valueNode != nil && valueNode.Kind == yaml.SequenceNode {
+		valueNode.Content = sequenceNode.Content
+		return
+	}
+
+	setMappingValue(mapping, key, sequenceNode)
+}
+
+// setMappingValue replaces the value for the key in the mapping, or appends the key if it is not present.
+func setMappingValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	index := findKeyIndex(mapping, key)
+	if index >= 0 {
+		value.HeadComment = mapping.Content[index+1].HeadComment
+		value.LineComment = mapping.Content[index+1].LineComment
+		mapping.Content[index+1] = value
+		return
+	}
+
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	mapping.Content = append(mapping.Content, keyNode, value)
+}
+
+// findMappingValue returns the value node for the key in the mapping, or nil if it is not present.
+func findMappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	index := findKeyIndex(mapping, key)
+	if index < 0 {
+		return nil
+	}
+
+	return mapping.Content[index+1]
+}
+
+// validateOperationNode checks that the edited operation would be accepted when the config file is next loaded.
+func validateOperationNode(operationNode *yaml.Node) error {
+	var settings map[string]interface{}
+
+	err := operationNode.Decode(&settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = newConfiguration(lowerCaseKeys(settings))
+	if err != nil {
+		return fmt.Errorf("the operation is not valid: %s", err)
+	}
+
+	return nil
+}
+
+// lowerCaseKeys returns a copy of the settings with lower case keys, matching what viper provides.
+func lowerCaseKeys(settings map[string]interface{}) map[string]interface{} {
+	lowered := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		lowered[strings.ToLower(key)] = value
+	}
+
+	return lowered
+}
@@ -0,0 +1,201 @@
+package copylib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfigFile = `# game saves
+test:
+  name: Test # the display name
+  source: /games/test/saves
+  destinations:
+    - /backups/one/test
+    - /backups/two/test
+  replace: always
+
+# more game saves
+foo:
+  name: Foo
+  source: /games/foo/saves
+  destinations:
+    - /backups/one/foo
+  replace: never
+
+# end of file
+`
+
+func writeTestConfigFile(t *testing.T) string {
+	configFile := filepath.Join(t.TempDir(), "go-copy-config.yaml")
+
+	err := os.WriteFile(configFile, []byte(testConfigFile), 0644)
+	if err != nil {
+		t.Fatalf("error writing test config file: %s", err)
+	}
+
+	return configFile
+}
+
+func readTestConfigFile(t *testing.T, configFile string) string {
+	contents, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatalf("error reading test config file: %s", err)
+	}
+
+	return string(contents)
+}
+
+func TestAddOperationSuccess(t *testing.T) {
+	configFile := writeTestConfigFile(t)
+
+	settings := OperationSettings{
+		Name:         "Bar",
+		Source:       "/games/bar/saves",
+		Destinations: []string{"/backups/one/bar", "/backups/two/bar"},
+		Replace:      "skip",
+	}
+
+	err := AddOperation(configFile, "bar", settings)
+	if err != nil {
+		t.Fatalf("unexpected error adding operation: %s", err)
+	}
+
+	expected := strings.Replace(testConfigFile, "\n# end of file", `
+bar:
+  name: Bar
+  source: /games/bar/saves
+  destinations:
+    - /backups/one/bar
+    - /backups/two/bar
+  replace: skip
+
+# end of file`, 1)
+
+	contents := readTestConfigFile(t, configFile)
+	if contents != expected {
+		t.Errorf("unexpected config file contents:\n%s", contents)
+	}
+}
+
+func TestAddOperationExistsFailure(t *testing.T) {
+	configFile := writeTestConfigFile(t)
+
+	settings := OperationSettings{
+		Name:         "Foo",
+		Source:       "/games/foo/saves",
+		Destinations: []string{"/backups/one/foo"},
+		Replace:      "skip",
+	}
+
+	err := AddOperation(configFile, "FOO", settings)
+	if err == nil {
+		t.Errorf("expected an error adding an operation that already exists")
+	}
+}
+
+func TestSetOperationSuccess(t *testing.T) {
+	configFile := writeTestConfigFile(t)
+
+	err := SetOperation(configFile, "test", OperationSettings{Name: "Test Two", Replace: "Skip"})
+	if err != nil {
+		t.Fatalf("unexpected error setting operation: %s", err)
+	}
+
+	expected := strings.Replace(testConfigFile, "name: Test # the display name", "name: Test Two # the display name", 1)
+	expected = strings.Replace(expected, "replace: always", "replace: skip", 1)
+
+	contents := readTestConfigFile(t, configFile)
+	if contents != expected {
+		t.Errorf("unexpected config file contents:\n%s", contents)
+	}
+}
+
+func TestSetOperationKeepsFormattingSuccess(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "go-copy-config.yaml")
+	config := `test:
+    # the display name
+    name: "Test"   # shown in the list
+    source: '/games/test/saves'
+    destinations: ["/backups/one/test", '/backups/two/test'] # both drives
+    replace: always
+other:
+    name: Other
+    source: /games/other/saves
+    destinations:
+        - "/backups/one/other" # first
+        - "/backups/two/other"
+        - "/backups/three/other"
+    replace: skip
+`
+	err := os.WriteFile(configFile, []byte(config), 0644)
+	if err != nil {
+		t.Fatalf("error writing test config file: %s", err)
+	}
+
+	err = SetOperation(configFile, "test", OperationSettings{
+		Name:         "Test Two",
+		Source:       "/games/test two/saves",
+		Destinations: []string{"/backups/one/test2"},
+		Schedule:     "24h",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error setting operation: %s", err)
+	}
+
+	expected := strings.Replace(config, `"Test"   #`, `"Test Two"   #`, 1)
+	expected = strings.Replace(expected, `'/games/test/saves'`, `'/games/test two/saves'`, 1)
+	expected = strings.Replace(expected, `["/backups/one/test", '/backups/two/test']`, `["/backups/one/test2"]`, 1)
+	expected = strings.Replace(expected, "replace: always\n", "replace: always\n    schedule: 24h\n", 1)
+
+	contents := readTestConfigFile(t, configFile)
+	if contents != expected {
+		t.Errorf("unexpected config file contents:\n%s", contents)
+	}
+
+	err = SetOperation(configFile, "other", OperationSettings{Destinations: []string{"/backups/one/other", "/backups/four/other"}})
+	if err != nil {
+		t.Fatalf("unexpected error setting operation: %s", err)
+	}
+
+	expected = strings.Replace(expected, `        - "/backups/two/other"
+        - "/backups/three/other"
+`, `        - "/backups/four/other"
+`, 1)
+
+	contents = readTestConfigFile(t, configFile)
+	if contents != expected {
+		t.Errorf("unexpected config file contents:\n%s", contents)
+	}
+}
+
+func TestSetOperationInvalidFailure(t *testing.T) {
+	configFile := writeTestConfigFile(t)
+
+	err := SetOperation(configFile, "test", OperationSettings{Replace: "sometimes"})
+	if err == nil {
+		t.Errorf("expected an error setting an invalid replace mode")
+	}
+
+	contents := readTestConfigFile(t, configFile)
+	if contents != testConfigFile {
+		t.Errorf("the config file was changed even though the edit was invalid:\n%s", contents)
+	}
+}
+
+func TestRemoveOperationSuccess(t *testing.T) {
+	configFile := writeTestConfigFile(t)
+
+	err := RemoveOperation(configFile, "test")
+	if err != nil {
+		t.Fatalf("unexpected error removing operation: %s", err)
+	}
+
+	expected := testConfigFile[strings.Index(testConfigFile, "# more game saves"):]
+
+	contents := readTestConfigFile(t, configFile)
+	if contents != expected {
+		t.Errorf("unexpected config file contents:\n%s", contents)
+	}
+}
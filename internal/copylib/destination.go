@@ -0,0 +1,160 @@
+package copylib
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// destination is a single place an operation copies to, along with the settings that apply only to it.
+type destination struct {
+	path     string
+	label    string
+	replace  replaceMode
+	enabled  bool
+	required bool
+	exclude  []string
+}
+
+// String returns a one line description of the destination and any settings that differ from the defaults.
+func (dest *destination) String() string {
+	var details []string
+
+	description := dest.path
+	if len(dest.label) > 0 {
+		description = fmt.Sprintf("%s [%s]", dest.path, dest.label)
+	}
+
+	details = append(details, "replace: "+dest.replace.String())
+	if !dest.required {
+		details = append(details, "optional")
+	}
+	if !dest.enabled {
+		details = append(details, "disabled")
+	}
+	if len(dest.exclude) > 0 {
+		details = append(details, "exclude: "+strings.Join(dest.exclude, ", "))
+	}
+
+	return fmt.Sprintf("%s (%s)", description, strings.Join(details, "; "))
+}
+
+// displayName returns the label of the destination if it has one, otherwise its path.
+func (dest *destination) displayName() string {
+	if len(dest.label) > 0 {
+		return dest.label
+	}
+
+	return dest.path
+}
+
+// isExcluded reports whether the file, given by its path relative to the source, matches one of the exclude patterns.
+// Patterns are matched against both the relative path and the file name, so "*.tmp" excludes temp files in every folder.
+func (dest *destination) isExcluded(relativePath string) bool {
+	filename := path.Base(relativePath)
+
+	for _, pattern := range dest.exclude {
+		if matched, _ := path.Match(pattern, relativePath); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, filename); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newDestination builds a destination from its entry in the config file, which is either a path,
+// or a mapping with the path and the settings for that destination.
+func newDestination(entry interface{}, defaultReplace replaceMode) (destination, error) {
+	dest := destination{
+		replace:  defaultReplace,
+		enabled:  true,
+		required: true,
+	}
+
+	switch value := entry.(type) {
+	case string:
+		dest.path = value
+
+	case map[string]interface{}:
+		err := dest.applySettings(lowerCaseKeys(value))
+		if err != nil {
+			return dest, err
+		}
+
+	case map[interface{}]interface{}:
+		settings := make(map[string]interface{}, len(value))
+		for key, setting := range value {
+			settings[fmt.Sprint(key)] = setting
+		}
+		err := dest.applySettings(lowerCaseKeys(settings))
+		if err != nil {
+			return dest, err
+		}
+
+	default:
+		return dest, fmt.Errorf("must be a path, or a mapping with a path")
+	}
+
+	if len(strings.TrimSpace(dest.path)) == 0 {
+		return dest, fmt.Errorf("the path is required")
+	}
+
+	err := validatePathTemplate(dest.path)
+	if err != nil {
+		return dest, err
+	}
+
+	return dest, nil
+}
+
+// applySettings sets the fields of the destination from the settings in its config file mapping.
+func (dest *destination) applySettings(settings map[string]interface{}) error {
+	var err error
+
+	dest.path, _ = settings["path"].(string)
+
+	if label, ok := settings["label"]; ok {
+		dest.label, ok = label.(string)
+		if !ok {
+			return fmt.Errorf("\"label\" must be text")
+		}
+	}
+
+	if replace, ok := settings["replace"]; ok {
+		replaceStr, ok := replace.(string)
+		if !ok {
+			return fmt.Errorf("\"replace\" must be text")
+		}
+		dest.replace, err = parseReplaceMode(replaceStr)
+		if err != nil {
+			return err
+		}
+	}
+
+	dest.enabled, err = getOptionalBool(settings, "enabled", true)
+	if err != nil {
+		return err
+	}
+
+	dest.required, err = getOptionalBool(settings, "required", true)
+	if err != nil {
+		return err
+	}
+
+	if exclude, ok := settings["exclude"]; ok {
+		dest.exclude, err = getStringList(exclude)
+		if err != nil {
+			return fmt.Errorf("\"exclude\" %s", err)
+		}
+		for _, pattern := range dest.exclude {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("the exclude pattern \"%s\" is not valid", pattern)
+			}
+		}
+	}
+
+	return nil
+}
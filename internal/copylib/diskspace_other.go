@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package copylib
+
+import (
+	"errors"
+)
+
+// getFreeSpace is not supported on this OS, so it always returns an error.
+func getFreeSpace(folder string) (uint64, error) {
+	return 0, errors.New("checking free space is not supported on this OS")
+}
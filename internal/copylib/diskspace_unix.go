@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+
+package copylib
+
+import (
+	"syscall"
+)
+
+// getFreeSpace returns the number of bytes available to the current user on the volume holding the folder.
+func getFreeSpace(folder string) (uint64, error) {
+	var stat syscall.Statfs_t
+
+	err := syscall.Statfs(folder, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
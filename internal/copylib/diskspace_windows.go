@@ -0,0 +1,24 @@
+//go:build windows
+
+package copylib
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// getFreeSpace returns the number of bytes available to the current user on the volume holding the folder.
+func getFreeSpace(folder string) (uint64, error) {
+	var freeBytes uint64
+
+	folderPtr, err := windows.UTF16PtrFromString(folder)
+	if err != nil {
+		return 0, err
+	}
+
+	err = windows.GetDiskFreeSpaceEx(folderPtr, &freeBytes, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return freeBytes, nil
+}
@@ -0,0 +1,180 @@
+package copylib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// progressInterval is how many bytes of a file are copied between each EventBytesProgress.
+const progressInterval = 4 * 1024 * 1024
+
+// EventType says what happened in an Event.
+type EventType int8
+
+const (
+	// EventOperationStarted is sent when a Runner starts, before the pre hooks.
+	EventOperationStarted EventType = iota
+	// EventDirectoryEntered is sent when the copy moves into a folder of the source, including the source itself.
+	EventDirectoryEntered
+	// EventFileStarted is sent once for each source file, before it is copied to any destination.
+	EventFileStarted
+	// EventBytesProgress is sent as a file is copied to a destination, and when that copy finishes.
+	EventBytesProgress
+	// EventFileCopied is sent when a file has been copied to a destination.
+	EventFileCopied
+	// EventFileSkipped is sent when a file is not copied to a destination; Reason says why.
+	EventFileSkipped
+	// EventFileFailed is sent when a file could not be copied to a destination; Err says why.
+	EventFileFailed
+	// EventOperationFinished is sent when a Runner finishes, after the post hooks, with the final Stats.
+	EventOperationFinished
+	// EventFileRetrying is sent when a copy to a destination failed, and will be tried again after Duration;
+	// Attempt is how many times it has been tried, and Err says why it failed.
+	EventFileRetrying
+)
+
+// String returns the name of the event type, such as "file-copied".
+func (eventType EventType) String() string {
+	switch eventType {
+	case EventOperationStarted:
+		return "operation-started"
+	case EventDirectoryEntered:
+		return "directory-entered"
+	case EventFileStarted:
+		return "file-started"
+	case EventBytesProgress:
+		return "bytes-progress"
+	case EventFileCopied:
+		return "file-copied"
+	case EventFileSkipped:
+		return "file-skipped"
+	case EventFileFailed:
+		return "file-failed"
+	case EventOperationFinished:
+		return "operation-finished"
+	case EventFileRetrying:
+		return "file-retrying"
+	}
+
+	return "unknown"
+}
+
+// Event describes something that happened while a Runner copied an operation.
+// Only the fields that make sense for the Type are set.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Operation is the key of the operation, or its name for an ad-hoc copy.
+	Operation string
+	// Path is the path of the file or folder, relative to the source.
+	Path string
+	// Destination is the label of the destination, or its path if it does not have a label.
+	Destination string
+	// Bytes is how much of the file has been copied so far.
+	Bytes int64
+	// Size is the size of the source file.
+	Size int64
+	// Replaced is set when a copied file replaced one that already existed at the destination.
+	Replaced bool
+	// DryRun is set when a file was not copied, but would have been, as the run is a dry run.
+	DryRun bool
+	// Duration is how long the file took to copy to the destination, or how long until a failed copy is retried.
+	Duration time.Duration
+	// Attempt is how many times the file has been tried at the destination, sent with EventFileRetrying.
+	Attempt int
+	// Reason says why a file was skipped.
+	Reason string
+	// Err says why a file could not be copied.
+	Err error
+	// Stats are the final counts and timings of the run, sent with EventOperationFinished.
+	Stats *Stats
+}
+
+// EventHandler is called with each Event, on the goroutine running the copy, so it should return quickly.
+type EventHandler func(event Event)
+
+// WithEvents calls the handler with every Event of the run; it can be given more than once.
+// To receive the events on a channel, use a handler that sends them to it.
+func WithEvents(handler EventHandler) Option {
+	return func(runner *Runner) {
+		runner.eventHandlers = append(runner.eventHandlers, handler)
+	}
+}
+
+// logFileEvent logs what happened to a file at a destination, from the events sent once it has been copied,
+// skipped, failed or is being retried. Other events are not logged.
+func (logger *logger) logFileEvent(event Event) {
+	args := []any{"file", event.Path, "destination", event.Destination}
+
+	switch event.Type {
+	case EventFileCopied:
+		action, done, preposition := "copy", "copied", "to"
+		if event.Replaced {
+			action, done, preposition = "replace", "replaced", "at"
+		}
+		message := fmt.Sprintf("%s file \"%s\" %s %s", done, event.Path, preposition, event.Destination)
+		if event.DryRun {
+			message = fmt.Sprintf("would %s \"%s\" %s %s", action, event.Path, preposition, event.Destination)
+			args = append(args, "dry_run", true)
+		}
+		logger.print(message, append(args, "action", action)...)
+	case EventFileSkipped:
+		if event.Reason == skipReasonExcluded {
+			logger.debug(fmt.Sprintf("file \"%s\" is excluded from destination %s", event.Path, event.Destination), append(args, "action", "exclude")...)
+		} else {
+			logger.info(fmt.Sprintf("file \"%s\" was not copied to %s, as %s", event.Path, event.Destination, event.Reason), append(args, "action", "skip")...)
+		}
+	case EventFileFailed:
+		if errors.Is(event.Err, context.Canceled) || errors.Is(event.Err, context.DeadlineExceeded) {
+			logger.warning(fmt.Sprintf("copying file \"%s\" to %s was interrupted, so the partial copy was removed", event.Path, event.Destination),
+				append(args, "action", "interrupt")...)
+		} else {
+			logger.error(fmt.Sprintf("error copying file \"%s\" to %s: %s", event.Path, event.Destination, event.Err),
+				append(args, "action", "fail", "error", event.Err)...)
+		}
+	case EventFileRetrying:
+		logger.warning(fmt.Sprintf("error copying file \"%s\" to %s, so trying again in %s (attempt %d): %s",
+			event.Path, event.Destination, event.Duration, event.Attempt, event.Err), append(args, "action", "retry", "error", event.Err)...)
+	}
+}
+
+// eventEmitter sends events for a single operation to its handlers.
+type eventEmitter struct {
+	operation string
+	handlers  []EventHandler
+}
+
+func (emitter *eventEmitter) emit(event Event) {
+	if emitter == nil || len(emitter.handlers) == 0 {
+		return
+	}
+
+	event.Time = time.Now()
+	event.Operation = emitter.operation
+	for _, handler := range emitter.handlers {
+		handler(event)
+	}
+}
+
+// progressReader sends EventBytesProgress as a file is read, every progressInterval bytes.
+type progressReader struct {
+	reader      io.Reader
+	emitter     *eventEmitter
+	event       Event
+	lastEmitted int64
+}
+
+func (progressReader *progressReader) Read(buffer []byte) (int, error) {
+	count, err := progressReader.reader.Read(buffer)
+
+	progressReader.event.Bytes += int64(count)
+	if progressReader.event.Bytes-progressReader.lastEmitted >= progressInterval {
+		progressReader.lastEmitted = progressReader.event.Bytes
+		progressReader.emitter.emit(progressReader.event)
+	}
+
+	return count, err
+}
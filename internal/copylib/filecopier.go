@@ -1,45 +1,151 @@
 package copylib
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"io/fs"
 	"os"
 	"path"
 	"runtime/debug"
+	"sort"
+	"strings"
 	"time"
 )
 
+// folderPermissions are used for the folders created at the destinations.
+const folderPermissions = os.ModeDir | 0755
+
+// partialFileSuffix is added to the name of a file while it is being written, so an interrupted copy
+// never leaves a truncated file, or replaces a good one, under the real name.
+const partialFileSuffix = ".go-copy-partial"
+
 type copyContext struct {
 	filename        string
 	sourcePath      string
 	destinationPath string
 	subFolderPath   string
-}
-
-type stats struct {
-	NumberOfSourceFiles  int
-	NumberOfDestinations int
-	TotalFilesSkipped    int
-	TotalFilesCopied     int
-	BytesCopied          int64
-	TimeToCopy           time.Duration
-	NumberOfWarnings     int
-	NumberOfErrors       int
+	destination     *destination
 }
 
 type fileCopier struct {
-	config *configuration
-	stats  stats
+	ctx          context.Context
+	source       SourceFilesystem
+	destination  Filesystem
+	config       *configuration
+	destinations []*destination
+	logger       *logger
+	events       *eventEmitter
+	stats        Stats
+	// paths limits the copy to these files and folders of the source, when it is not nil
+	paths []string
+	// rescan rebuilds the manifests from the files at the destinations, instead of trusting them
+	rescan bool
+	// dryRun decides what would be copied, without writing anything
+	dryRun bool
+	// safetyFolder is where existing files are moved to before they are replaced, when it is set
+	safetyFolder string
+	// manifests are the manifests of the destinations, when the operation keeps them
+	manifests map[*destination]*destinationManifest
+	// destinationIndex finds the stats of each destination in stats.Destinations
+	destinationIndex map[*destination]int
 }
 
-func (fileCopier *fileCopier) run(config *configuration) {
+func (fileCopier *fileCopier) run(ctx context.Context, config *configuration) {
 	defer fileCopier.handleFinish()
 
+	fileCopier.ctx = ctx
 	fileCopier.config = config
-	fileCopier.stats.NumberOfDestinations = len(config.destinations)
+	fileCopier.stats.StartTime = time.Now()
+	fileCopier.destinations = fileCopier.getAvailableDestinations()
+	fileCopier.stats.NumberOfDestinations = len(fileCopier.destinations)
 
-	startTime := time.Now()
-	fileCopier.walkPath("")
-	fileCopier.stats.TimeToCopy = time.Since(startTime)
+	if len(fileCopier.destinations) == 0 {
+		fileCopier.logger.error("none of the destinations are available, so there is nothing to copy to")
+		fileCopier.stats.NumberOfErrors++
+		return
+	}
+
+	if fileCopier.config.manifest.enabled {
+		fileCopier.loadManifests()
+		if !fileCopier.dryRun {
+			defer fileCopier.saveManifests()
+		}
+	}
+
+	if fileCopier.paths != nil {
+		fileCopier.copyPaths(fileCopier.paths)
+	} else {
+		fileCopier.walkPath("")
+	}
+	fileCopier.stats.TimeToCopy = time.Since(fileCopier.stats.StartTime)
+
+	if fileCopier.ctx.Err() != nil {
+		fileCopier.stats.Interrupted = true
+		fileCopier.logger.warning("the copy was interrupted before it finished")
+	}
+}
+
+// getAvailableDestinations returns the destinations that are enabled and can be reached.
+// A required destination that cannot be reached is an error, while an optional one is only a warning.
+func (fileCopier *fileCopier) getAvailableDestinations() []*destination {
+	var available []*destination
+
+	fileCopier.destinationIndex = make(map[*destination]int)
+	for index := range fileCopier.config.destinations {
+		dest := &fileCopier.config.destinations[index]
+		if !dest.enabled {
+			fileCopier.logger.debug(fmt.Sprintf("destination %s is disabled, so it will be skipped", dest.displayName()), "destination", dest.displayName())
+			continue
+		}
+
+		err := fileCopier.checkDestinationIsOnline(dest)
+		fileCopier.destinationIndex[dest] = len(fileCopier.stats.Destinations)
+		fileCopier.stats.Destinations = append(fileCopier.stats.Destinations, DestinationStats{
+			Destination: dest.displayName(),
+			Path:        dest.path,
+			Online:      err == nil,
+		})
+		if err == nil {
+			available = append(available, dest)
+		} else if dest.required {
+			fileCopier.logger.error(fmt.Sprintf("destination %s is not available: %s", dest.displayName(), err), "destination", dest.displayName(), "error", err)
+			fileCopier.stats.NumberOfErrors++
+		} else {
+			fileCopier.logger.warning(fmt.Sprintf("optional destination %s is offline, so it will be skipped: %s", dest.displayName(), err),
+				"destination", dest.displayName(), "error", err)
+			fileCopier.stats.NumberOfWarnings++
+		}
+	}
+
+	return available
+}
+
+// checkDestinationIsOnline makes sure the root folder of the destination exists.
+// Required destinations are created as needed, but optional destinations are only created when the folder
+// they live in already exists, so a missing drive or share is reported as offline instead of being created.
+func (fileCopier *fileCopier) checkDestinationIsOnline(dest *destination) error {
+	if !dest.required {
+		_, err := fileCopier.destination.Stat(dest.path)
+		if err != nil {
+			parentInfo, err := fileCopier.destination.Stat(path.Dir(dest.path))
+			if err != nil {
+				return err
+			} else if !parentInfo.IsDir() {
+				return fmt.Errorf("%s is not a folder", path.Dir(dest.path))
+			}
+		}
+	}
+	if fileCopier.dryRun {
+		// a dry run never creates anything, so a destination that does not exist yet is treated as empty
+		return nil
+	}
+
+	return fileCopier.destination.MkdirAll(dest.path, folderPermissions)
 }
 
 func (fileCopier *fileCopier) walkPath(pathToWalk string) {
@@ -50,15 +156,22 @@ func (fileCopier *fileCopier) walkPath(pathToWalk string) {
 
 	currentPath := path.Join(fileCopier.config.source, context.subFolderPath)
 
-	files, err := ReadDir(currentPath)
+	fileCopier.events.emit(Event{Type: EventDirectoryEntered, Path: context.subFolderPath})
+
+	files, err := fileCopier.source.ReadDir(currentPath)
 	if err != nil {
-		PrintError(fmt.Sprintf("skipping path %s:\n    %v", currentPath, err))
+		fileCopier.logger.error(fmt.Sprintf("skipping path %s:\n    %v", currentPath, err), "file", context.subFolderPath, "error", err)
 		fileCopier.stats.NumberOfErrors++
 	} else {
 		for _, file := range files {
-			if file.Type().IsRegular() {
+			if fileCopier.ctx.Err() != nil {
+				// the copy has been cancelled, so stop before starting on anything else
+				return
+			}
+			if file.Type().IsRegular() && !isManifestFile(path.Join(context.subFolderPath, file.Name())) {
 				// copy the file
 				context.filename = file.Name()
+				fileCopier.emitFileStarted(context, file)
 				fileCopier.copyFileToDestinations(context)
 			}
 			if file.IsDir() {
@@ -69,40 +182,157 @@ func (fileCopier *fileCopier) walkPath(pathToWalk string) {
 	}
 }
 
+// copyPaths copies only the given files and folders of the source, skipping those that no longer exist.
+// A path inside a folder that is also given is only copied once, as part of the folder.
+func (fileCopier *fileCopier) copyPaths(paths []string) {
+	var copiedFolders []string
+
+	sortedPaths := make([]string, 0, len(paths))
+	for _, relativePath := range paths {
+		relativePath = path.Clean(strings.ReplaceAll(relativePath, "\\", "/"))
+		if relativePath == ".." || strings.HasPrefix(relativePath, "../") || path.IsAbs(relativePath) {
+			fileCopier.logger.error(fmt.Sprintf("skipping path %s, as it is not inside the source", relativePath), "file", relativePath)
+			fileCopier.stats.NumberOfErrors++
+			continue
+		}
+		sortedPaths = append(sortedPaths, relativePath)
+	}
+	sort.Strings(sortedPaths)
+
+	for index, relativePath := range sortedPaths {
+		if fileCopier.ctx.Err() != nil {
+			return
+		} else if index > 0 && relativePath == sortedPaths[index-1] || isInsideFolders(relativePath, copiedFolders) || isManifestFile(relativePath) {
+			continue
+		}
+
+		sourcePath := path.Join(fileCopier.config.source, relativePath)
+		info, err := fileCopier.source.Stat(sourcePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			fileCopier.logger.debug(fmt.Sprintf("skipping path %s, as it no longer exists", sourcePath), "file", relativePath)
+			continue
+		} else if err != nil {
+			fileCopier.logger.error(fmt.Sprintf("skipping path %s:\n    %v", sourcePath, err), "file", relativePath, "error", err)
+			fileCopier.stats.NumberOfErrors++
+			continue
+		}
+
+		if info.IsDir() {
+			if relativePath == "." {
+				relativePath = ""
+			}
+			copiedFolders = append(copiedFolders, relativePath)
+			fileCopier.walkPath(relativePath)
+		} else if info.Mode().IsRegular() {
+			subFolderPath := path.Dir(relativePath)
+			if subFolderPath == "." {
+				subFolderPath = ""
+			}
+			context := &copyContext{
+				sourcePath:    fileCopier.config.source,
+				subFolderPath: subFolderPath,
+				filename:      path.Base(relativePath),
+			}
+			fileCopier.emitFileStarted(context, fs.FileInfoToDirEntry(info))
+			fileCopier.copyFileToDestinations(context)
+		}
+	}
+}
+
+// isInsideFolders checks if the path is in one of the folders, where an empty folder is the whole source.
+func isInsideFolders(relativePath string, folders []string) bool {
+	for _, folder := range folders {
+		if folder == "" || strings.HasPrefix(relativePath, folder+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyFileToDestinations copies the file in the context to each of the destinations. What happens to it at each one
+// is reported by the events, and not logged here, so the output of the command line tool is driven by the same events.
 func (fileCopier *fileCopier) copyFileToDestinations(context *copyContext) {
-	var err error
-	var count = 0
-	var ok bool
+	var attempted = 0
+	var failed = 0
 
-	for _, destPath := range fileCopier.config.destinations {
-		context.destinationPath = destPath
+	relativePath := path.Join(context.subFolderPath, context.filename)
 
-		// make sure all the sub folders exist for this destination path
-		destinationPath := path.Join(context.destinationPath, context.subFolderPath)
-		err = MkdirAll(destinationPath, os.ModeDir)
-		if err != nil {
-			// failed to create the sub-folder(s), so skip this path and continue
+	for _, dest := range fileCopier.destinations {
+		if fileCopier.ctx.Err() != nil {
+			break
+		}
+		if dest.isExcluded(relativePath) {
+			fileCopier.events.emit(Event{Type: EventFileSkipped, Path: relativePath, Destination: dest.displayName(), Reason: skipReasonExcluded})
+			fileCopier.countSkipped(dest)
 			continue
 		}
 
-		ok, err = fileCopier.copyFile(context, destinationPath)
+		attempted++
+		context.destination = dest
+		context.destinationPath = dest.path
+
+		_, err := fileCopier.copyFileWithRetries(context)
 		if err != nil {
-			PrintError(fmt.Sprintf("error copying file %s: %s", context.filename, err))
-			fileCopier.stats.NumberOfErrors++
-		} else if ok {
-			count++
+			// the file is not copied to this destination, but may still be copied to the others
+			failed++
+			fileCopier.countFailed(dest)
+			fileCopier.events.emit(Event{Type: EventFileFailed, Path: relativePath, Destination: dest.displayName(), Err: err})
+			if fileCopier.ctx.Err() == nil {
+				fileCopier.stats.NumberOfErrors++
+			}
 		}
 	}
 
-	if count == 0 {
-		PrintInfo(fmt.Sprintf("file \"%s\" was skipped", context.filename))
-	} else if count == len(fileCopier.config.destinations) {
-		Print(fmt.Sprintf("copied file \"%s\"", context.filename))
-	} else {
-		Print(fmt.Sprintf("file \"%s\" was copied to some of the destinations, but not all of them", context.filename))
+	if failed > 0 {
+		fileCopier.stats.NumberOfFailedFiles++
+	} else if attempted > 0 || fileCopier.ctx.Err() == nil {
+		fileCopier.stats.NumberOfSourceFiles++
 	}
+}
+
+// copyFileWithRetries copies the file in the context to its destination, trying again after a wait when the copy
+// fails with an error the retry policy allows, until it succeeds or the retries are used up.
+func (fileCopier *fileCopier) copyFileWithRetries(context *copyContext) (bool, error) {
+	policy := fileCopier.config.retry
+	relativePath := path.Join(context.subFolderPath, context.filename)
+
+	for attempts := 1; ; attempts++ {
+		// make sure all the sub folders exist for this destination path
+		destinationPath := path.Join(context.destinationPath, context.subFolderPath)
+		var err error
+		if !fileCopier.dryRun {
+			err = fileCopier.destination.MkdirAll(destinationPath, folderPermissions)
+		}
+		if err == nil {
+			var ok bool
+			ok, err = fileCopier.copyFile(context, destinationPath)
+			if err == nil {
+				return ok, nil
+			}
+		}
 
-	fileCopier.stats.NumberOfSourceFiles++
+		if fileCopier.ctx.Err() != nil || !policy.shouldRetry(err, attempts) {
+			return false, err
+		}
+
+		delay := policy.delay(attempts)
+		fileCopier.stats.NumberOfWarnings++
+		fileCopier.countRetry(context.destination)
+		fileCopier.events.emit(Event{
+			Type:        EventFileRetrying,
+			Path:        relativePath,
+			Destination: context.destination.displayName(),
+			Attempt:     attempts,
+			Duration:    delay,
+			Err:         err,
+		})
+
+		if sleep(fileCopier.ctx, delay) != nil {
+			// the copy was cancelled while waiting, so report that, along with the error that caused the wait
+			return false, fmt.Errorf("%w while waiting to try again after: %w", fileCopier.ctx.Err(), err)
+		}
+	}
 }
 
 func (fileCopier *fileCopier) copyFile(context *copyContext, destinationPath string) (bool, error) {
@@ -110,115 +340,216 @@ func (fileCopier *fileCopier) copyFile(context *copyContext, destinationPath str
 
 	// *** this is the main focus of this entire Go program, copying files to specific destinations ***
 
-	sourceFilename := path.Join(fileCopier.config.source, context.subFolderPath, context.filename)
+	relativePath := path.Join(context.subFolderPath, context.filename)
+	sourceFilename := path.Join(fileCopier.config.source, relativePath)
 	destFilename := path.Join(destinationPath, context.filename)
+	manifest := fileCopier.manifestFor(context.destination)
 
-	fileinfoSource, err := Stat(sourceFilename)
+	fileinfoSource, err := fileCopier.source.Stat(sourceFilename)
 	if err != nil {
 		return false, err
 	} else if !fileinfoSource.Mode().IsRegular() {
 		return false, fmt.Errorf("%s was not copied as it is not a regular file", sourceFilename)
 	}
-	// check to see if the file exists, and if it does,
+	// check to see if the file exists, using the manifest when there is one, and if it does,
 	// then check the configuration to see if it should be replaced
-	fileinfoDest, fileExists := fileCopier.doesDestFileExist(destFilename)
+	fileinfoDest, fileExists := manifest.lookUp(relativePath)
+	if !fileExists {
+		fileinfoDest, fileExists, err = fileCopier.doesDestFileExist(destFilename)
+		if err != nil {
+			return false, err
+		}
+	}
 	if fileExists {
 		if !fileCopier.checkIfFileShouldBeReplaced(context, fileinfoSource, fileinfoDest) {
 			// the file should not be replaced
+			manifest.record(relativePath, fileinfoDest.Size(), fileinfoDest.ModTime(), "")
 			return false, nil
 		}
 	}
 
-	sourceFile, err := Open(sourceFilename)
-	if err != nil {
-		return false, err
+	if fileCopier.dryRun {
+		fileCopier.reportDryRunCopy(context, fileinfoSource, fileExists)
+		return true, nil
 	}
-	defer Close(sourceFile)
 
-	destFile, err := Create(destFilename)
+	startTime := time.Now()
+	sourceFile, err := fileCopier.source.Open(sourceFilename)
 	if err != nil {
-		PrintError(fmt.Sprintf("error creating %s: %s", destFilename, err))
-		fileCopier.stats.NumberOfErrors++
 		return false, err
 	}
-	defer Close(destFile)
+	defer sourceFile.Close()
 
-	bytesWritten, err := Copy(destFile, sourceFile)
+	partialFilename := destFilename + partialFileSuffix
+	destFile, err := fileCopier.destination.Create(partialFilename)
 	if err != nil {
 		return false, err
 	}
 
-	// flush file to storage and close it BEFORE changing the modified time of the file
-	err = Sync(destFile)
+	progress := &progressReader{
+		reader:  &contextReader{ctx: fileCopier.ctx, reader: sourceFile},
+		emitter: fileCopier.events,
+		event:   fileCopier.newFileEvent(EventBytesProgress, context, fileinfoSource),
+	}
+	// the hash for the manifest is worked out as the file is written, so the file is only read once
+	var destWriter io.Writer = destFile
+	var hasher hash.Hash
+	if manifest != nil && fileCopier.config.manifest.hash {
+		hasher = sha256.New()
+		destWriter = io.MultiWriter(destFile, hasher)
+	}
+	bytesWritten, err := io.Copy(destWriter, progress)
+	if err == nil {
+		// flush file to storage and close it BEFORE changing the modified time of the file
+		err = destFile.Sync()
+	}
+	closeErr := destFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil && fileExists && len(fileCopier.safetyFolder) > 0 {
+		err = fileCopier.moveToSafetyFolder(relativePath, destFilename)
+	}
+	if err == nil {
+		err = fileCopier.destination.Rename(partialFilename, destFilename)
+	}
 	if err != nil {
+		// never leave a partially written file behind
+		fileCopier.destination.Remove(partialFilename)
 		return false, err
 	}
-	Close(destFile)
 
 	// update the access and modified time for the file to be that of the original file
-	err = Chtimes(destFilename, fileinfoSource.ModTime(), fileinfoSource.ModTime())
+	err = fileCopier.destination.Chtimes(destFilename, fileinfoSource.ModTime(), fileinfoSource.ModTime())
 	if err != nil {
-		PrintError(fmt.Sprintf("failed to changed modified time: %s", err))
+		fileCopier.logger.error(fmt.Sprintf("failed to changed modified time: %s", err),
+			"file", relativePath, "destination", context.destination.displayName(), "error", err)
 		fileCopier.stats.NumberOfErrors++
+		manifest.forget(relativePath)
+	} else {
+		var fileHash string
+		if hasher != nil {
+			fileHash = hex.EncodeToString(hasher.Sum(nil))
+		}
+		manifest.record(relativePath, bytesWritten, fileinfoSource.ModTime(), fileHash)
 	}
 
-	fileCopier.stats.TotalFilesCopied++
-	fileCopier.stats.BytesCopied += bytesWritten
+	fileCopier.countCopied(context.destination, bytesWritten)
+
+	event := fileCopier.newFileEvent(EventBytesProgress, context, fileinfoSource)
+	event.Bytes = bytesWritten
+	fileCopier.events.emit(event)
+	event.Type = EventFileCopied
+	event.Replaced = fileExists
+	event.Duration = time.Since(startTime)
+	fileCopier.events.emit(event)
 
 	return true, nil
 }
 
-func (fileCopier *fileCopier) doesDestFileExist(destFilename string) (os.FileInfo, bool) {
-	var fileExists = false
+// reportDryRunCopy reports a file a dry run would copy, as if it had been copied.
+func (fileCopier *fileCopier) reportDryRunCopy(context *copyContext, fileinfoSource os.FileInfo, fileExists bool) {
+	fileCopier.countCopied(context.destination, fileinfoSource.Size())
 
-	fileinfoDest, err := Stat(destFilename)
+	event := fileCopier.newFileEvent(EventFileCopied, context, fileinfoSource)
+	event.Bytes = fileinfoSource.Size()
+	event.Replaced = fileExists
+	event.DryRun = true
+	fileCopier.events.emit(event)
+}
+
+// doesDestFileExist returns the details of the file at the destination, if it exists.
+// Anything stopping it from finding out, other than the file not existing, is an error.
+func (fileCopier *fileCopier) doesDestFileExist(destFilename string) (os.FileInfo, bool, error) {
+	fileinfoDest, err := fileCopier.destination.Stat(destFilename)
 	if err == nil {
-		fileExists = true
-	} else if !IsNotExist(err) {
-		fileExists = true
-		PrintError(fmt.Sprintf("error checking if file exists: %s", err))
-		fileCopier.stats.NumberOfErrors++
+		return fileinfoDest, true, nil
+	} else if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
 	}
 
-	return fileinfoDest, fileExists
+	return nil, false, fmt.Errorf("error checking if the file exists: %s", err)
 }
 
+// checkIfFileShouldBeReplaced decides whether the file that already exists at the destination is replaced,
+// counting and reporting it as skipped when it is not.
 func (fileCopier *fileCopier) checkIfFileShouldBeReplaced(context *copyContext, fileinfoSource os.FileInfo, fileinfoDest os.FileInfo) bool {
-	returnValue := true
+	reason := skipReason(context.destination.replace, fileinfoSource, fileinfoDest)
+	if len(reason) == 0 {
+		return true
+	}
 
-	switch fileCopier.config.replace {
-	case replaceNever:
-		fileCopier.stats.TotalFilesSkipped++
-		infoMsg := fmt.Sprintf("%s was not copied to %s as it already exists, and the replace flag is set to \"never\"",
-			context.filename, context.destinationPath)
-		PrintInfo(infoMsg)
-		returnValue = false
+	fileCopier.countSkipped(context.destination)
+	fileCopier.emitFileSkipped(context, fileinfoSource, reason)
+
+	return false
+}
 
+// skipReasonExcluded is the reason sent with EventFileSkipped for a file that is excluded from a destination.
+const skipReasonExcluded = "excluded"
+
+// skipReason decides whether a file that already exists at a destination is kept, given the replace mode of the
+// destination. It returns why the file is kept, or "" if it is replaced.
+func skipReason(replace replaceMode, fileinfoSource fs.FileInfo, fileinfoDest fs.FileInfo) string {
+	switch replace {
+	case replaceNever:
+		return "the file exists, and the replace flag is set to \"never\""
 	case replaceSkipIfSame:
-		if (fileinfoSource.ModTime().Equal(fileinfoDest.ModTime())) && (fileinfoSource.Size() == fileinfoDest.Size()) {
-			fileCopier.stats.TotalFilesSkipped++
-			infoMsg := fmt.Sprintf("%s was not copied to %s because it matches the datetime and size of an existing file, and the replace flag is set to \"skip\"",
-				context.filename, context.destinationPath)
-			PrintInfo(infoMsg)
-			returnValue = false
+		if fileinfoSource.ModTime().Equal(fileinfoDest.ModTime()) && fileinfoSource.Size() == fileinfoDest.Size() {
+			return "the file matches the datetime and size of the existing file, and the replace flag is set to \"skip\""
 		}
 	}
 
-	return returnValue
+	return ""
+}
+
+// newFileEvent creates an event about copying the file in the context to its destination.
+func (fileCopier *fileCopier) newFileEvent(eventType EventType, context *copyContext, fileinfoSource os.FileInfo) Event {
+	return Event{
+		Type:        eventType,
+		Path:        path.Join(context.subFolderPath, context.filename),
+		Destination: context.destination.displayName(),
+		Size:        fileinfoSource.Size(),
+	}
 }
 
-func closeFile(file *os.File) error {
-	return file.Close()
+// emitFileStarted sends the event for a file in the source, before it is copied to any of the destinations.
+func (fileCopier *fileCopier) emitFileStarted(context *copyContext, file os.DirEntry) {
+	event := Event{Type: EventFileStarted, Path: path.Join(context.subFolderPath, context.filename)}
+
+	info, err := file.Info()
+	if err == nil && info != nil {
+		event.Size = info.Size()
+	}
+
+	fileCopier.events.emit(event)
 }
 
-func syncFile(file *os.File) error {
-	return file.Sync()
+func (fileCopier *fileCopier) emitFileSkipped(context *copyContext, fileinfoSource os.FileInfo, reason string) {
+	event := fileCopier.newFileEvent(EventFileSkipped, context, fileinfoSource)
+	event.Reason = reason
+	fileCopier.events.emit(event)
+}
+
+// contextReader stops a read part way through a file once its context is cancelled.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (contextReader *contextReader) Read(buffer []byte) (int, error) {
+	err := contextReader.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	return contextReader.reader.Read(buffer)
 }
 
 func (fileCopier *fileCopier) handleFinish() {
 	recovery := recover()
 	if recovery != nil {
-		PrintError(fmt.Sprintf("panic occurred:\n    %v", recovery))
+		fileCopier.logger.error(fmt.Sprintf("panic occurred:\n    %v", recovery), "error", recovery)
 		fileCopier.stats.NumberOfErrors++
 		debug.PrintStack()
 	}
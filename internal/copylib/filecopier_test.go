@@ -1,220 +1,606 @@
 package copylib
 
 import (
+	"context"
+	"errors"
 	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
+const testSource = "/games/foobar/saves"
+
+var testDestinationPaths = []string{"/backups/g/foobar/saves", "/backups/h/foobar/saves", "/backups/i/foobar/saves"}
+
 func TestCopySuccess(t *testing.T) {
-	var configName = "foo"
-	var source = "f:\\games\\foobar\\saves"
-	var destinations = []string{"g:\\game_backups\\foobar\\saves", "h:\\game_backups\\foobar\\saves", "i:\\game_backups\\foobar\\saves"}
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceSkipIfSame)
+	runner := newTestRunner(config, filesystem)
 
-	SetupTestFileSystemFunctions(destinations)
-	defer func() { ReinitializeFileSystemFunctions() }()
+	runner.Copy(context.Background())
 
-	config := &configuration{
-		name:         configName,
-		source:       source,
-		destinations: destinations,
-		replace:      replaceSkipIfSame,
+	if runner.Stats.NumberOfErrors != 0 {
+		t.Errorf("expected no errors, but there were %d", runner.Stats.NumberOfErrors)
+	}
+	if runner.Stats.TotalFilesCopied != 9 {
+		t.Errorf("expected 9 files to be copied, but %d were copied", runner.Stats.TotalFilesCopied)
 	}
 
-	runner := &Runner{
-		configName: config.name,
-		config:     config,
+	for _, destPath := range testDestinationPaths {
+		checkTestFileCopied(t, filesystem, "foobar003.txt", destPath)
 	}
+}
 
-	runner.Waiter.Add(1)
-	currentLogMode = LogVerbose
+func TestCopyWithSubDirectoriesSuccess(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, true)
+	config := newTestConfiguration(replaceSkipIfSame)
+	runner := newTestRunner(config, filesystem)
+
+	runner.Copy(context.Background())
 
-	createSimpleTestFiles()
+	if runner.Stats.TotalFilesCopied != 18 {
+		t.Errorf("expected 18 files to be copied, but %d were copied", runner.Stats.TotalFilesCopied)
+	}
 
-	runner.Copy()
+	for _, destPath := range testDestinationPaths {
+		checkTestFileCopied(t, filesystem, "subdir001/foobar005.txt", destPath)
+	}
 }
 
-func TestCopyWithSubDirectoriesSuccess(t *testing.T) {
-	var configName = "foo"
-	var source = "f:\\games\\foobar\\saves"
-	var destinations = []string{"g:\\game_backups\\foobar\\saves", "h:\\game_backups\\foobar\\saves", "i:\\game_backups\\foobar\\saves"}
+func TestCopyWithPathsSuccess(t *testing.T) {
+	t.Parallel()
 
-	SetupTestFileSystemFunctions(destinations)
-	defer func() { ReinitializeFileSystemFunctions() }()
+	filesystem := newTestFilesystem(t, true)
+	config := newTestConfiguration(replaceSkipIfSame)
+	runner := newTestRunner(config, filesystem)
+	WithPaths([]string{"foobar002.txt", "subdir001", "subdir001/foobar004.txt", "deleted.txt", "foobar002.txt"})(runner)
 
-	config := &configuration{
-		name:         configName,
-		source:       source,
-		destinations: destinations,
-		replace:      replaceSkipIfSame,
+	runner.Copy(context.Background())
+
+	// the file in the folder is only copied once, and the missing file is ignored
+	if runner.Stats.TotalFilesCopied != 12 || runner.Stats.NumberOfErrors != 0 {
+		t.Errorf("expected 12 files to be copied without errors, but %d were copied with %d errors",
+			runner.Stats.TotalFilesCopied, runner.Stats.NumberOfErrors)
+	}
+	for _, destPath := range testDestinationPaths {
+		checkTestFileCopied(t, filesystem, "foobar002.txt", destPath)
+		checkTestFileCopied(t, filesystem, "subdir001/foobar006.txt", destPath)
+
+		_, err := filesystem.Stat(path.Join(destPath, "foobar001.txt"))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected foobar001.txt not to be copied to %s, as it was not one of the paths", destPath)
+		}
 	}
+}
 
-	runner := &Runner{
-		configName: config.name,
-		config:     config,
+func TestCopyWithSkipSuccess(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceSkipIfSame)
+
+	// the first run copies everything, so the second one has nothing left to do
+	newTestRunner(config, filesystem).Copy(context.Background())
+	runner := newTestRunner(config, filesystem)
+	runner.Copy(context.Background())
+
+	if runner.Stats.TotalFilesCopied != 0 {
+		t.Errorf("expected no files to be copied, but %d were copied", runner.Stats.TotalFilesCopied)
+	}
+	if runner.Stats.TotalFilesSkipped != 9 {
+		t.Errorf("expected 9 files to be skipped, but %d were skipped", runner.Stats.TotalFilesSkipped)
 	}
+}
 
-	runner.Waiter.Add(1)
-	currentLogMode = LogVerbose
+func TestCopyWithReplaceSuccess(t *testing.T) {
+	t.Parallel()
 
-	createDirectoriesAndTestFiles()
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceAlways)
 
-	runner.Copy()
+	newTestRunner(config, filesystem).Copy(context.Background())
+	runner := newTestRunner(config, filesystem)
+	runner.Copy(context.Background())
+
+	if runner.Stats.TotalFilesCopied != 9 {
+		t.Errorf("expected 9 files to be replaced, but %d were copied", runner.Stats.TotalFilesCopied)
+	}
 }
 
-func TestCopyWithSkipSuccess(t *testing.T) {
-	var configName = "foo"
-	var source = "f:\\games\\foobar\\saves"
-	var destinations = []string{"g:\\game_backups\\foobar\\saves", "h:\\game_backups\\foobar\\saves", "i:\\game_backups\\foobar\\saves"}
+func TestCopyDryRunSuccess(t *testing.T) {
+	t.Parallel()
 
-	SetupTestFileSystemFunctions(destinations)
-	defer func() { ReinitializeFileSystemFunctions() }()
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceSkipIfSame)
 
-	Stat = StatDestFileExistsSuccess
+	newTestRunner(config, filesystem).Copy(context.Background())
+	writeTestFile(t, filesystem, path.Join(testSource, "foobar002.txt"), 100)
+	writeTestFile(t, filesystem, path.Join(testSource, "subdir001", "foobar004.txt"), 200)
+	runner := newTestRunner(config, filesystem)
+	WithDryRun()(runner)
+	runner.Copy(context.Background())
 
-	config := &configuration{
-		name:         configName,
-		source:       source,
-		destinations: destinations,
-		replace:      replaceSkipIfSame,
+	if runner.Stats.TotalFilesCopied != 6 || runner.Stats.TotalFilesSkipped != 6 || runner.Stats.BytesCopied != 900 {
+		t.Errorf("expected 6 files of 900 bytes to be copied and 6 skipped, but got %d of %d bytes and %d skipped",
+			runner.Stats.TotalFilesCopied, runner.Stats.BytesCopied, runner.Stats.TotalFilesSkipped)
+	}
+	if outcome := runner.Result.Files[1].Destinations[0].Outcome; outcome != FileReplaced {
+		t.Errorf("expected the changed file to be reported as replaced, but got %s", outcome)
 	}
 
-	runner := &Runner{
-		configName: config.name,
-		config:     config,
+	// nothing was written, not even the new folder
+	for _, destPath := range testDestinationPaths {
+		info, err := filesystem.Stat(path.Join(destPath, "foobar002.txt"))
+		if err != nil || info.Size() == 100 {
+			t.Errorf("expected foobar002.txt in %s not to be replaced by a dry run", destPath)
+		}
+		_, err = filesystem.Stat(path.Join(destPath, "subdir001"))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected no folder to be created in %s by a dry run", destPath)
+		}
 	}
+}
 
-	runner.Waiter.Add(1)
-	currentLogMode = LogVerbose
+func TestCopyWithSafetyFolderSuccess(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.destinations = config.destinations[:1]
 
-	createSimpleTestFiles()
+	newTestRunner(config, filesystem).Copy(context.Background())
+	writeTestFile(t, filesystem, path.Join(testSource, "foobar002.txt"), 100)
+	runner := newTestRunner(config, filesystem)
+	runner.safetyFolder = "/backups/safety"
+	runner.Copy(context.Background())
+
+	if runner.Stats.TotalFilesCopied != 1 || runner.Stats.NumberOfErrors != 0 {
+		t.Fatalf("expected the changed file to be replaced without errors, but %d were copied with %d errors",
+			runner.Stats.TotalFilesCopied, runner.Stats.NumberOfErrors)
+	}
+	checkTestFileCopied(t, filesystem, "foobar002.txt", testDestinationPaths[0])
 
-	runner.Copy()
+	info, err := filesystem.Stat("/backups/safety/foobar002.txt")
+	if err != nil || info.Size() != 8640 {
+		t.Errorf("expected the replaced file to be moved to the safety folder")
+	}
+	_, err = filesystem.Stat("/backups/safety/foobar001.txt")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected only the replaced file to be moved to the safety folder")
+	}
 }
 
-func TestCopyWithReplaceSuccess(t *testing.T) {
-	var configName = "foo"
-	var source = "f:\\games\\foobar\\saves"
-	var destinations = []string{"g:\\game_backups\\foobar\\saves", "h:\\game_backups\\foobar\\saves", "i:\\game_backups\\foobar\\saves"}
+func TestCopyOpenFailure(t *testing.T) {
+	t.Parallel()
 
-	SetupTestFileSystemFunctions(destinations)
-	defer func() { ReinitializeFileSystemFunctions() }()
+	filesystem := &failingFilesystem{MemoryFilesystem: newTestFilesystem(t, false), failOpen: true}
+	config := newTestConfiguration(replaceSkipIfSame)
+	runner := newTestRunner(config, filesystem)
 
-	Stat = StatDestFileExistsSuccess
+	runner.Copy(context.Background())
 
-	config := &configuration{
-		name:         configName,
-		source:       source,
-		destinations: destinations,
-		replace:      replaceAlways,
+	if runner.Stats.NumberOfErrors != 9 {
+		t.Errorf("expected 9 errors, but there were %d", runner.Stats.NumberOfErrors)
 	}
+	if runner.Stats.TotalFilesCopied != 0 {
+		t.Errorf("expected no files to be copied, but %d were copied", runner.Stats.TotalFilesCopied)
+	}
+	if len(runner.Result.FailedFiles()) != 3 || runner.Result.Outcome != "failed" {
+		t.Errorf("expected the result to list 3 failed files, but got %d with the result \"%s\"", len(runner.Result.FailedFiles()), runner.Result.Outcome)
+	}
+}
 
-	runner := &Runner{
-		configName: config.name,
-		config:     config,
+func TestCopyResultSuccess(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.destinations[2].exclude = []string{"foobar003.txt"}
+
+	newTestRunner(config, filesystem).Copy(context.Background())
+	writeTestFile(t, filesystem, path.Join(testSource, "foobar002.txt"), 100)
+	runner := newTestRunner(config, filesystem)
+	runner.Copy(context.Background())
+
+	result := runner.Result
+	if result.Outcome != "success" || result.Stats != runner.Stats || len(result.Files) != 3 {
+		t.Fatalf("expected a successful result for 3 files, but got \"%s\" for %d files", result.Outcome, len(result.Files))
 	}
 
-	runner.Waiter.Add(1)
-	currentLogMode = LogVerbose
+	changed := result.Files[1]
+	if changed.Path != "foobar002.txt" || changed.Size != 100 || len(changed.Destinations) != 3 {
+		t.Fatalf("expected the changed file to be copied to 3 destinations, but got %+v", changed)
+	}
+	for _, dest := range changed.Destinations {
+		if dest.Outcome != FileReplaced || dest.Bytes != 100 {
+			t.Errorf("expected the changed file to replace 100 bytes at %s, but got %s of %d bytes", dest.Destination, dest.Outcome, dest.Bytes)
+		}
+	}
 
-	createSimpleTestFiles()
+	excluded := result.Files[2].Destinations[2]
+	if excluded.Outcome != FileSkipped || excluded.Reason != "excluded" {
+		t.Errorf("expected the excluded file to be skipped as excluded, but got %s (%s)", excluded.Outcome, excluded.Reason)
+	}
+	if result.Files[0].Destinations[0].Outcome != FileSkipped || len(result.Files[0].Destinations[0].Reason) == 0 {
+		t.Errorf("expected the unchanged file to be skipped with a reason")
+	}
+}
+
+func TestCopyFailure(t *testing.T) {
+	t.Parallel()
 
-	runner.Copy()
+	filesystem := &failingFilesystem{MemoryFilesystem: newTestFilesystem(t, false), failWrite: true}
+	config := newTestConfiguration(replaceSkipIfSame)
+	runner := newTestRunner(config, filesystem)
+
+	runner.Copy(context.Background())
+
+	if runner.Stats.NumberOfErrors != 9 {
+		t.Errorf("expected 9 errors, but there were %d", runner.Stats.NumberOfErrors)
+	}
+	if runner.Stats.NumberOfFailedFiles != 3 || runner.Stats.NumberOfSourceFiles != 0 || runner.Stats.TotalFilesFailed != 9 {
+		t.Errorf("expected 3 source files to fail at 9 destinations, but got %d and %d, with %d that did not fail",
+			runner.Stats.NumberOfFailedFiles, runner.Stats.TotalFilesFailed, runner.Stats.NumberOfSourceFiles)
+	}
+	for _, destStats := range runner.Stats.Destinations {
+		if destStats.FilesFailed != 3 || destStats.FilesCopied != 0 {
+			t.Errorf("expected every file to fail at %s, but got %+v", destStats.Destination, destStats)
+		}
+	}
+	checkNoPartialFiles(t, filesystem.MemoryFilesystem)
 }
 
-func TestCopyOpenFailure(t *testing.T) {
-	var configName = "foo"
-	var source = "f:\\games\\foobar\\saves"
-	var destinations = []string{"g:\\game_backups\\foobar\\saves", "h:\\game_backups\\foobar\\saves", "i:\\game_backups\\foobar\\saves"}
+func TestCopyWithRetrySuccess(t *testing.T) {
+	t.Parallel()
 
-	SetupTestFileSystemFunctions(destinations)
-	defer func() { ReinitializeFileSystemFunctions() }()
+	filesystem := &failingFilesystem{MemoryFilesystem: newTestFilesystem(t, false), writeFailures: 2}
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.retry = retryPolicy{count: 3, backoff: time.Millisecond, maxBackoff: time.Millisecond, classes: defaultRetryClasses}
+	runner := newTestRunner(config, filesystem)
 
-	Open = OpenFailure
+	runner.Copy(context.Background())
 
-	config := &configuration{
-		name:         configName,
-		source:       source,
-		destinations: destinations,
-		replace:      replaceSkipIfSame,
+	if runner.Stats.NumberOfErrors != 0 || runner.Stats.TotalFilesCopied != 9 {
+		t.Errorf("expected every file to be copied after retrying, but got %d errors and %d copied",
+			runner.Stats.NumberOfErrors, runner.Stats.TotalFilesCopied)
+	}
+	if runner.Stats.TotalRetries != 2 || runner.Stats.Destinations[0].Retries != 2 {
+		t.Errorf("expected the first copy to be retried twice, but got %d retries", runner.Stats.TotalRetries)
+	}
+	if runner.Result.Files[0].Destinations[0].Retries != 2 || runner.Result.Files[0].Destinations[0].Outcome != FileCopied {
+		t.Errorf("expected the result to record the retries, but got %+v", runner.Result.Files[0].Destinations[0])
 	}
+	for _, destPath := range testDestinationPaths {
+		checkTestFileCopied(t, filesystem.MemoryFilesystem, "foobar001.txt", destPath)
+	}
+}
 
-	runner := &Runner{
-		configName: config.name,
-		config:     config,
+func TestCopyWithRetryFailure(t *testing.T) {
+	t.Parallel()
+
+	filesystem := &failingFilesystem{MemoryFilesystem: newTestFilesystem(t, false), failWrite: true}
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.retry = retryPolicy{count: 2, backoff: time.Millisecond, maxBackoff: time.Millisecond, classes: []string{errorClassAll}}
+	runner := newTestRunner(config, filesystem)
+
+	runner.Copy(context.Background())
+
+	if runner.Stats.TotalRetries != 18 || runner.Stats.TotalFilesFailed != 9 || runner.Stats.NumberOfErrors != 9 {
+		t.Errorf("expected each of the 9 copies to be retried twice before failing once, but got %d retries, %d failed and %d errors",
+			runner.Stats.TotalRetries, runner.Stats.TotalFilesFailed, runner.Stats.NumberOfErrors)
 	}
 
-	runner.Waiter.Add(1)
-	currentLogMode = LogVerbose
+	// errors that are not in the classes of the policy are not retried
+	config.retry.classes = []string{errorClassNetwork}
+	runner = newTestRunner(config, filesystem)
 
-	createSimpleTestFiles()
+	runner.Copy(context.Background())
 
-	runner.Copy()
+	if runner.Stats.TotalRetries != 0 || runner.Stats.TotalFilesFailed != 9 {
+		t.Errorf("expected no retries, but got %d retries and %d failed", runner.Stats.TotalRetries, runner.Stats.TotalFilesFailed)
+	}
 }
 
-func TestCopyFailure(t *testing.T) {
-	var configName = "foo"
-	var source = "f:\\games\\foobar\\saves"
-	var destinations = []string{"g:\\game_backups\\foobar\\saves", "h:\\game_backups\\foobar\\saves", "i:\\game_backups\\foobar\\saves"}
+func TestCopyOptionalDestinationOfflineSuccess(t *testing.T) {
+	t.Parallel()
 
-	SetupTestFileSystemFunctions(destinations)
-	defer func() { ReinitializeFileSystemFunctions() }()
+	filesystem := NewMemoryFilesystem()
+	writeTestFile(t, filesystem, path.Join(testSource, "foobar001.txt"), 8600)
 
-	Copy = CopyFailure
+	config := newTestConfiguration(replaceSkipIfSame)
+	for index := range config.destinations {
+		config.destinations[index].required = false
+	}
+	runner := newTestRunner(config, filesystem)
 
-	config := &configuration{
-		name:         configName,
-		source:       source,
-		destinations: destinations,
-		replace:      replaceSkipIfSame,
+	runner.Copy(context.Background())
+
+	if runner.Stats.NumberOfWarnings != len(testDestinationPaths) {
+		t.Errorf("expected %d warnings for the offline destinations, but there were %d", len(testDestinationPaths), runner.Stats.NumberOfWarnings)
+	}
+	if runner.Stats.TotalFilesCopied != 0 {
+		t.Errorf("expected no files to be copied, but %d were copied", runner.Stats.TotalFilesCopied)
 	}
+}
 
-	runner := &Runner{
-		configName: config.name,
-		config:     config,
+func TestCopyWithExcludeSuccess(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.destinations[0].exclude = []string{"foobar002.*"}
+	config.destinations[1].enabled = false
+	runner := newTestRunner(config, filesystem)
+
+	runner.Copy(context.Background())
+
+	if runner.Stats.NumberOfDestinations != 2 {
+		t.Errorf("expected 2 destinations, but there were %d", runner.Stats.NumberOfDestinations)
+	}
+	if runner.Stats.TotalFilesCopied != 5 {
+		t.Errorf("expected 5 files to be copied, but %d were copied", runner.Stats.TotalFilesCopied)
 	}
 
-	runner.Waiter.Add(1)
-	currentLogMode = LogVerbose
+	_, err := filesystem.Stat(path.Join(testDestinationPaths[0], "foobar002.txt"))
+	if err == nil {
+		t.Errorf("expected the excluded file not to be copied")
+	}
+
+	if runner.Stats.NumberOfSourceFiles != 3 || len(runner.Stats.Destinations) != 2 {
+		t.Fatalf("expected 3 source files and the stats of 2 destinations, but got %d and %d", runner.Stats.NumberOfSourceFiles, len(runner.Stats.Destinations))
+	}
+	excluding := runner.Stats.Destinations[0]
+	if excluding.Path != testDestinationPaths[0] || excluding.FilesCopied != 2 || excluding.FilesSkipped != 1 || excluding.BytesCopied != 8600+86400 {
+		t.Errorf("expected the first destination to copy 2 files and skip the excluded one, but got %+v", excluding)
+	}
+	if runner.Stats.Destinations[1].FilesCopied != 3 {
+		t.Errorf("expected the last destination to copy every file, but got %+v", runner.Stats.Destinations[1])
+	}
+}
+
+func TestCopyPreHookFailure(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.preHooks = []hook{{command: "exit 1", timeout: time.Minute}}
+	resultFile := filepath.Join(t.TempDir(), "result")
+	config.postHooks = []hook{{command: "echo $GO_COPY_RESULT > " + resultFile, timeout: time.Minute}}
+	runner := newTestRunner(config, filesystem)
+
+	runner.Copy(context.Background())
+
+	if runner.Stats.NumberOfErrors != 1 {
+		t.Errorf("expected the failed pre hook to be the only error, but there were %d", runner.Stats.NumberOfErrors)
+	}
+	if runner.Stats.TotalFilesCopied != 0 {
+		t.Errorf("expected the failed pre hook to stop the copy, but %d files were copied", runner.Stats.TotalFilesCopied)
+	}
+
+	result, err := os.ReadFile(resultFile)
+	if err != nil || strings.TrimSpace(string(result)) != "failed" {
+		t.Errorf("expected the post hook to run after the failed pre hook, with a failed result, but got %q: %v", result, err)
+	}
+}
+
+func TestCopyPreHookInterruptedFailure(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.preHooks = []hook{{command: "sleep 30", timeout: time.Minute}}
+	runner := newTestRunner(config, filesystem)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	runner.Copy(ctx)
+
+	if time.Since(started) > 10*time.Second {
+		t.Errorf("expected cancelling the context to stop the pre hook, but the copy took %s", time.Since(started))
+	}
+	if !runner.Stats.Interrupted || runner.Stats.TotalFilesCopied != 0 {
+		t.Errorf("expected the copy to be interrupted before it started, but got %+v", runner.Stats)
+	}
+}
+
+func TestCopyCancelledBeforeStartFailure(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceSkipIfSame)
+	runner := newTestRunner(config, filesystem)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	runner.Copy(ctx)
+
+	if !runner.Stats.Interrupted {
+		t.Errorf("expected the stats to be marked as interrupted")
+	}
+	if runner.Stats.TotalFilesCopied != 0 {
+		t.Errorf("expected no files to be copied after cancelling, but %d were copied", runner.Stats.TotalFilesCopied)
+	}
+}
+
+func TestCopyCancelledDuringCopyFailure(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// cancel part way through the first file, as Ctrl-C would
+	filesystem := &failingFilesystem{MemoryFilesystem: newTestFilesystem(t, false), onWrite: cancel}
+	config := newTestConfiguration(replaceSkipIfSame)
+	runner := newTestRunner(config, filesystem)
+
+	runner.Copy(ctx)
+
+	if !runner.Stats.Interrupted {
+		t.Errorf("expected the stats to be marked as interrupted")
+	}
+	if runner.Stats.NumberOfErrors != 0 {
+		t.Errorf("expected the interruption not to be counted as an error, but there were %d errors", runner.Stats.NumberOfErrors)
+	}
+	if runner.Stats.TotalFilesCopied != 0 {
+		t.Errorf("expected no files to be copied, but %d were copied", runner.Stats.TotalFilesCopied)
+	}
+	checkNoPartialFiles(t, filesystem.MemoryFilesystem)
+}
+
+// failingFilesystem is a MemoryFilesystem that fails to open source files, or to write destination files, when asked to.
+// With writeFailures, only that many writes fail, with an I/O error, before the rest succeed.
+type failingFilesystem struct {
+	*MemoryFilesystem
+	failOpen      bool
+	failWrite     bool
+	writeFailures int
+	onWrite       func()
+}
 
-	createSimpleTestFiles()
+func (filesystem *failingFilesystem) Open(name string) (File, error) {
+	if filesystem.failOpen {
+		return nil, errors.New("failed to open the file")
+	}
 
-	runner.Copy()
+	return filesystem.MemoryFilesystem.Open(name)
 }
 
-func createSimpleTestFiles() {
-	testFiles = make([]fs.DirEntry, 0, 3)
+func (filesystem *failingFilesystem) Create(name string) (File, error) {
+	file, err := filesystem.MemoryFilesystem.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failingFile{File: file, filesystem: filesystem}, nil
+}
 
-	dirEntry := createDirEntry("foobar001.txt", 8600, false)
-	testFiles = append(testFiles, dirEntry)
+type failingFile struct {
+	File
+	filesystem *failingFilesystem
+}
 
-	dirEntry = createDirEntry("foobar002.txt", 8640, false)
-	testFiles = append(testFiles, dirEntry)
+func (file *failingFile) Write(buffer []byte) (int, error) {
+	if file.filesystem.onWrite != nil {
+		file.filesystem.onWrite()
+	}
+	if file.filesystem.failWrite {
+		return 0, errors.New("failed to copy file")
+	}
+	if file.filesystem.writeFailures > 0 {
+		file.filesystem.writeFailures--
+		return 0, &fs.PathError{Op: "write", Path: "test", Err: syscall.EIO}
+	}
 
-	dirEntry = createDirEntry("foobar003.txt", 86400, false)
-	testFiles = append(testFiles, dirEntry)
+	return file.File.Write(buffer)
 }
 
-func createDirectoriesAndTestFiles() {
-	testFiles = make([]fs.DirEntry, 0, 3)
+// newTestFilesystem creates a MemoryFilesystem holding the test source files, and the folder the destinations live in.
+func newTestFilesystem(t *testing.T, withSubDirectories bool) *MemoryFilesystem {
+	filesystem := NewMemoryFilesystem()
 
-	dirEntry := createDirEntry("foobar001.txt", 8600, false)
-	testFiles = append(testFiles, dirEntry)
+	writeTestFile(t, filesystem, path.Join(testSource, "foobar001.txt"), 8600)
+	writeTestFile(t, filesystem, path.Join(testSource, "foobar002.txt"), 8640)
+	writeTestFile(t, filesystem, path.Join(testSource, "foobar003.txt"), 86400)
 
-	dirEntry = createDirEntry("foobar002.txt", 8640, false)
-	testFiles = append(testFiles, dirEntry)
+	if withSubDirectories {
+		writeTestFile(t, filesystem, path.Join(testSource, "subdir001", "foobar004.txt"), 8600)
+		writeTestFile(t, filesystem, path.Join(testSource, "subdir001", "foobar005.txt"), 8640)
+		writeTestFile(t, filesystem, path.Join(testSource, "subdir001", "foobar006.txt"), 86400)
+	}
 
-	dirEntry = createDirEntry("foobar003.txt", 86400, false)
-	testFiles = append(testFiles, dirEntry)
+	err := filesystem.MkdirAll("/backups", folderPermissions)
+	if err != nil {
+		t.Fatalf("error creating the backups folder: %s", err)
+	}
 
-	dirEntrySubDir := createDirEntry("subdir001", 0, true)
-	testFiles = append(testFiles, dirEntrySubDir)
+	return filesystem
+}
 
-	dirEntry = createDirEntry("foobar004.txt", 8600, false)
-	dirEntrySubDir.addChildDirEntry(dirEntry)
+func writeTestFile(t *testing.T, filesystem *MemoryFilesystem, name string, size int) {
+	err := filesystem.MkdirAll(path.Dir(name), folderPermissions)
+	if err == nil {
+		err = filesystem.WriteFile(name, []byte(strings.Repeat("x", size)), 0644)
+	}
+	if err == nil {
+		modTime := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+		err = filesystem.Chtimes(name, modTime, modTime)
+	}
+	if err != nil {
+		t.Fatalf("error writing test file %s: %s", name, err)
+	}
+}
+
+func newTestConfiguration(replace replaceMode) *configuration {
+	return &configuration{
+		name:         "foo",
+		source:       testSource,
+		destinations: newTestDestinations(testDestinationPaths, replace),
+		replace:      replace,
+	}
+}
+
+func newTestDestinations(paths []string, replace replaceMode) []destination {
+	destinations := make([]destination, 0, len(paths))
+	for _, destPath := range paths {
+		destinations = append(destinations, destination{
+			path:     destPath,
+			replace:  replace,
+			enabled:  true,
+			required: true,
+		})
+	}
 
-	dirEntry = createDirEntry("foobar005.txt", 8640, false)
-	dirEntrySubDir.addChildDirEntry(dirEntry)
+	return destinations
+}
 
-	dirEntry = createDirEntry("foobar006.txt", 86400, false)
-	dirEntrySubDir.addChildDirEntry(dirEntry)
+func newTestRunner(config *configuration, filesystem Filesystem) *Runner {
+	runner := &Runner{
+		configName:  config.name,
+		config:      config,
+		logger:      newLogger(LogVerbose, nil),
+		source:      filesystem,
+		destination: filesystem,
+	}
+	runner.Waiter.Add(1)
+
+	return runner
+}
+
+// checkTestFileCopied checks that the copy of the file matches the source file, including its modified time.
+func checkTestFileCopied(t *testing.T, filesystem *MemoryFilesystem, relativePath string, destPath string) {
+	sourceInfo, err := filesystem.Stat(path.Join(testSource, relativePath))
+	if err != nil {
+		t.Fatalf("error reading the source file %s: %s", relativePath, err)
+	}
+
+	destInfo, err := filesystem.Stat(path.Join(destPath, relativePath))
+	if err != nil {
+		t.Errorf("expected %s to be copied to %s: %s", relativePath, destPath, err)
+	} else if destInfo.Size() != sourceInfo.Size() || !destInfo.ModTime().Equal(sourceInfo.ModTime()) {
+		t.Errorf("expected the copy of %s in %s to match the size and modified time of the source", relativePath, destPath)
+	}
+}
+
+func checkNoPartialFiles(t *testing.T, filesystem *MemoryFilesystem) {
+	for _, destPath := range testDestinationPaths {
+		entries, err := filesystem.ReadDir(destPath)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			t.Errorf("expected nothing to be left in %s, but found %s", destPath, entry.Name())
+		}
+	}
 }
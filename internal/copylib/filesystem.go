@@ -0,0 +1,80 @@
+package copylib
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// File is an open file on a Filesystem.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	// Sync flushes the contents of the file to storage.
+	Sync() error
+}
+
+// SourceFilesystem is what an operation reads its source files from.
+type SourceFilesystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Open(name string) (File, error)
+}
+
+// Filesystem is what an operation writes its destination files to. It can also be used as a SourceFilesystem.
+type Filesystem interface {
+	SourceFilesystem
+	Create(name string) (File, error)
+	MkdirAll(name string, perm fs.FileMode) error
+	Rename(oldName string, newName string) error
+	Remove(name string) error
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+}
+
+// OSFilesystem is the filesystem of the operating system. A Runner uses it unless it is given another Filesystem.
+type OSFilesystem struct{}
+
+func (OSFilesystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFilesystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OSFilesystem) Open(name string) (File, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		// return a nil interface, rather than an interface holding a nil *os.File
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (OSFilesystem) Create(name string) (File, error) {
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (OSFilesystem) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+func (OSFilesystem) Rename(oldName string, newName string) error {
+	return os.Rename(oldName, newName)
+}
+
+func (OSFilesystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
@@ -0,0 +1,269 @@
+package copylib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// historyFilename holds every run, one JSON object per line, oldest first
+	historyFilename = "history.jsonl"
+	// historyTrimSize is how large the history can grow before its oldest runs are dropped, to bring it down to half the size
+	historyTrimSize = 4 << 20
+	// maxRunErrors is how many of the files that failed are kept with each run
+	maxRunErrors = 20
+)
+
+// runRecord describes how a run of an operation went. Ad-hoc copies are kept too, without an operation key.
+type runRecord struct {
+	Operation string    `json:"operation" yaml:"operation"`
+	Name      string    `json:"name,omitempty" yaml:"name,omitempty"`
+	Started   time.Time `json:"started" yaml:"started"`
+	Finished  time.Time `json:"finished" yaml:"finished"`
+	Result    string    `json:"result" yaml:"result"`
+	ExitCode  int       `json:"exit_code" yaml:"exit_code"`
+	Stats     *Stats    `json:"stats,omitempty" yaml:"-"`
+	// Errors are the first of the files that could not be copied
+	Errors []runError `json:"errors,omitempty" yaml:"-"`
+}
+
+// runError is a file that could not be copied to a destination during a run.
+type runError struct {
+	Path        string `json:"path"`
+	Destination string `json:"destination"`
+	Error       string `json:"error"`
+}
+
+// RecordRun adds the outcome of the runner's copy to the history, along with the exit code go-copy gave it,
+// so it can be shown by the history command, and when listing the operations.
+func RecordRun(operationKey string, runner *Runner, exitCode int) error {
+	if runner.Stats == nil || runner.Result == nil {
+		return nil
+	}
+
+	record := runRecord{
+		Operation: operationKey,
+		Name:      runner.config.name,
+		Started:   runner.Result.Started,
+		Finished:  runner.Result.Finished,
+		Result:    runner.Result.Outcome,
+		ExitCode:  exitCode,
+		Stats:     runner.Stats,
+	}
+
+	for _, file := range runner.Result.FailedFiles() {
+		for _, dest := range file.Destinations {
+			if dest.Outcome == FileFailed && len(record.Errors) < maxRunErrors {
+				record.Errors = append(record.Errors, runError{Path: file.Path, Destination: dest.Destination, Error: dest.Error})
+			}
+		}
+	}
+
+	return appendHistory(record)
+}
+
+// appendHistory adds the run to the end of the history, dropping the oldest runs once it grows too large.
+func appendHistory(record runRecord) error {
+	stateDir, err := stateDirectory()
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(stateDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	// each run is added in a single write, so runs that finish at the same time do not mix their lines
+	filename := filepath.Join(stateDir, historyFilename)
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(contents, '\n'))
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	} else if closeErr != nil {
+		return closeErr
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil || info.Size() <= historyTrimSize {
+		return err
+	}
+
+	return trimHistory(filename)
+}
+
+// trimHistory drops the oldest runs, keeping the newest ones that fit in half of historyTrimSize.
+func trimHistory(filename string) error {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.SplitAfter(string(contents), "\n")
+	size, first := 0, len(lines)
+	for first > 0 && size+len(lines[first-1]) <= historyTrimSize/2 {
+		first--
+		size += len(lines[first])
+	}
+
+	trimmedFilename := filename + ".tmp"
+	err = os.WriteFile(trimmedFilename, []byte(strings.Join(lines[first:], "")), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(trimmedFilename, filename)
+}
+
+// loadHistory returns every run in the history, oldest first. Lines that cannot be read are skipped.
+func loadHistory() ([]runRecord, error) {
+	stateDir, err := stateDirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filepath.Join(stateDir, historyFilename))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []runRecord
+	var unreadable int
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), historyTrimSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var record runRecord
+		err := json.Unmarshal(line, &record)
+		if err != nil {
+			unreadable++
+			continue
+		}
+		records = append(records, record)
+	}
+	if unreadable > 0 {
+		PrintWarning(fmt.Sprintf("%d run(s) in the history could not be read, so they were skipped", unreadable))
+	}
+
+	return records, scanner.Err()
+}
+
+// loadLastRuns returns a summary of the most recent run of each operation, keyed by the operation.
+// Any problem reading them is treated as there being no previous runs.
+func loadLastRuns() map[string]runRecord {
+	lastRuns := make(map[string]runRecord)
+
+	records, err := loadHistory()
+	if err != nil {
+		PrintWarning(fmt.Sprintf("the history of previous runs could not be read: %s", err))
+	}
+	for _, record := range records {
+		if len(record.Operation) > 0 {
+			record.Stats = nil
+			record.Errors = nil
+			lastRuns[record.Operation] = record
+		}
+	}
+
+	return lastRuns
+}
+
+// lastRunStarted returns when the most recent run of the operation started, if it has been run before.
+func lastRunStarted(operationKey string) (time.Time, bool) {
+	lastRun, ok := loadLastRuns()[operationKey]
+	return lastRun.Started, ok
+}
+
+// ListHistory displays the most recent runs, oldest first, in the table or json format.
+// Only the runs of the operation are shown when operationKey is given, and only the last limit runs when it is more than zero.
+func ListHistory(operationKey string, format string, limit int) error {
+	switch format {
+	case ListFormatTable, ListFormatJSON:
+	default:
+		return fmt.Errorf("unknown history format \"%s\"; expected table or json", format)
+	}
+
+	records, err := loadHistory()
+	if err != nil {
+		return err
+	}
+
+	runs := []runRecord{}
+	for _, record := range records {
+		if len(operationKey) == 0 || strings.EqualFold(record.Operation, operationKey) {
+			runs = append(runs, record)
+		}
+	}
+	if limit > 0 && len(runs) > limit {
+		runs = runs[len(runs)-limit:]
+	}
+
+	if format == ListFormatJSON {
+		contents, err := json.MarshalIndent(runs, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, string(contents))
+		return nil
+	}
+
+	if len(runs) == 0 {
+		if len(operationKey) > 0 {
+			PrintKeyValue("History: ", fmt.Sprintf("operation \"%s\" has not been run yet", operationKey))
+		} else {
+			PrintKeyValue("History: ", "nothing has been run yet")
+		}
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "STARTED\tOPERATION\tRESULT\tEXIT\tCOPIED\tSKIPPED\tFAILED\tRETRIES\tERRORS\tBYTES\tDURATION")
+	for _, run := range runs {
+		operationName := run.Operation
+		if len(operationName) == 0 {
+			operationName = fmt.Sprintf("(%s)", run.Name)
+		}
+
+		var runStats Stats
+		if run.Stats != nil {
+			runStats = *run.Stats
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\n", run.Started.Local().Format(time.DateTime), operationName,
+			run.Result, run.ExitCode, runStats.TotalFilesCopied, runStats.TotalFilesSkipped, runStats.TotalFilesFailed,
+			runStats.TotalRetries, runStats.NumberOfErrors, formatBytes(uint64(runStats.BytesCopied)),
+			run.Finished.Sub(run.Started).Round(time.Millisecond))
+	}
+	writer.Flush()
+
+	lines := strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n")
+	PrintKeyValueArray("History: ", lines)
+
+	return nil
+}
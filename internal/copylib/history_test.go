@@ -0,0 +1,100 @@
+package copylib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFinishedRunner(name string, started time.Time, stats *Stats, files ...*FileResult) *Runner {
+	return &Runner{
+		config: &configuration{name: name},
+		Stats:  stats,
+		Result: &Result{Started: started, Finished: started.Add(time.Minute), Outcome: stats.Outcome(), Stats: stats, Files: files},
+	}
+}
+
+func TestRecordRunSuccess(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv("GO_COPY_STATE_DIR", stateDir)
+
+	started := time.Date(2026, time.March, 6, 14, 20, 30, 0, time.UTC)
+	failed := &FileResult{Path: "saves/slot1.sav", Destinations: []DestinationResult{
+		{Destination: "backup", Outcome: FileCopied},
+		{Destination: "usb", Outcome: FileFailed, Error: "disk full"},
+	}}
+	runs := []struct {
+		key      string
+		runner   *Runner
+		exitCode int
+	}{
+		{"saves", newTestFinishedRunner("Saves", started, &Stats{TotalFilesCopied: 2}), 0},
+		{"", newTestFinishedRunner("ad-hoc copy", started.Add(time.Hour), &Stats{TotalFilesCopied: 1}), 0},
+		{"saves", newTestFinishedRunner("Saves", started.Add(2*time.Hour), &Stats{TotalFilesCopied: 1, NumberOfErrors: 1}, failed), 3},
+	}
+	for _, run := range runs {
+		err := RecordRun(run.key, run.runner, run.exitCode)
+		if err != nil {
+			t.Fatalf("unexpected error recording the run: %s", err)
+		}
+	}
+
+	records, err := loadHistory()
+	if err != nil {
+		t.Fatalf("unexpected error loading the history: %s", err)
+	}
+	if len(records) != 3 || records[1].Operation != "" || records[1].Name != "ad-hoc copy" {
+		t.Fatalf("expected the 3 runs in the order they finished, but got %+v", records)
+	}
+	if len(records[2].Errors) != 1 || records[2].Errors[0].Destination != "usb" || records[2].Errors[0].Error != "disk full" {
+		t.Errorf("expected the failed file to be kept with the run, but got %+v", records[2].Errors)
+	}
+
+	// the history uses snake_case throughout, like the stats it holds
+	contents, err := os.ReadFile(filepath.Join(stateDir, historyFilename))
+	if err != nil {
+		t.Fatalf("unable to read the history: %s", err)
+	}
+	if !strings.Contains(string(contents), `"exit_code":3`) || !strings.Contains(string(contents), `"files_copied":1`) {
+		t.Errorf("expected the exit code and the stats in snake_case, but got %s", contents)
+	}
+
+	// ad-hoc copies have no operation, so they have no last run
+	lastRuns := loadLastRuns()
+	if len(lastRuns) != 1 {
+		t.Errorf("expected the last run of 1 operation, but got %d", len(lastRuns))
+	}
+	if lastRun := lastRuns["saves"]; !lastRun.Started.Equal(started.Add(2*time.Hour)) || lastRun.Result != "partial" || lastRun.ExitCode != 3 {
+		t.Errorf("expected the last run of saves to be the partial one, but got %+v", lastRun)
+	}
+}
+
+func TestTrimHistorySuccess(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), historyFilename)
+	line := strings.Repeat("x", 1023) + "\n"
+	contents := "first\n" + strings.Repeat(line, historyTrimSize/len(line)+1)
+	err := os.WriteFile(filename, []byte(contents), 0644)
+	if err != nil {
+		t.Fatalf("unable to create the history: %s", err)
+	}
+
+	err = trimHistory(filename)
+	if err != nil {
+		t.Fatalf("unexpected error trimming the history: %s", err)
+	}
+
+	trimmed, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unable to read the history: %s", err)
+	}
+	if len(trimmed) > historyTrimSize/2 || len(trimmed) < historyTrimSize/2-len(line) {
+		t.Errorf("expected the history to be trimmed to half its limit, but it is %d bytes", len(trimmed))
+	}
+	if strings.HasPrefix(string(trimmed), "first") || len(trimmed)%len(line) != 0 {
+		t.Errorf("expected only whole lines, and only the newest, to be kept")
+	}
+}
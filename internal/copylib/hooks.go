@@ -0,0 +1,180 @@
+package copylib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultHookTimeout = 5 * time.Minute
+
+// hook is a command that is run before or after an operation copies its files.
+type hook struct {
+	command string
+	timeout time.Duration
+}
+
+// newHooks builds the list of hooks from the config file, where each entry is either a command,
+// or a mapping with the command and its timeout.
+func newHooks(setting interface{}, defaultTimeout time.Duration) ([]hook, error) {
+	var hooks []hook
+
+	entries, ok := setting.([]interface{})
+	if !ok {
+		if _, isString := setting.(string); !isString {
+			return nil, fmt.Errorf("must be a list of commands")
+		}
+		entries = []interface{}{setting}
+	}
+
+	for index, entry := range entries {
+		hookObj := hook{timeout: defaultTimeout}
+
+		switch value := entry.(type) {
+		case string:
+			hookObj.command = value
+
+		case map[string]interface{}:
+			settings := lowerCaseKeys(value)
+			hookObj.command, _ = settings["command"].(string)
+			if timeout, ok := settings["timeout"]; ok {
+				var err error
+				hookObj.timeout, err = parseDuration(timeout)
+				if err != nil {
+					return nil, fmt.Errorf("hook %d has an invalid timeout: %s", index+1, err)
+				}
+			}
+
+		default:
+			return nil, fmt.Errorf("hook %d must be a command, or a mapping with a command", index+1)
+		}
+
+		if len(strings.TrimSpace(hookObj.command)) == 0 {
+			return nil, fmt.Errorf("hook %d does not have a command", index+1)
+		}
+
+		hooks = append(hooks, hookObj)
+	}
+
+	return hooks, nil
+}
+
+// parseDuration converts a duration from the config file, such as "90s" or "5m", into a time.Duration.
+// Plain numbers are treated as seconds.
+func parseDuration(value interface{}) (time.Duration, error) {
+	var duration time.Duration
+	var err error
+
+	switch setting := value.(type) {
+	case string:
+		duration, err = time.ParseDuration(strings.TrimSpace(setting))
+		if err != nil {
+			return 0, err
+		}
+	case int:
+		duration = time.Duration(setting) * time.Second
+	case float64:
+		duration = time.Duration(setting * float64(time.Second))
+	default:
+		return 0, fmt.Errorf("must be a duration, such as \"30s\" or \"5m\"")
+	}
+
+	if duration <= 0 {
+		return 0, fmt.Errorf("must be greater than zero")
+	}
+
+	return duration, nil
+}
+
+// runHooks runs each of the hooks in order, stopping at the first one that fails, or when the context is done.
+func runHooks(ctx context.Context, logger *logger, phase string, hooks []hook, environment []string) error {
+	for _, hookObj := range hooks {
+		err := hookObj.run(ctx, logger, phase, environment)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// run executes the hook's command through the shell of the OS, killing it if it runs longer than its timeout,
+// or the context is done.
+func (hookObj *hook) run(ctx context.Context, logger *logger, phase string, environment []string) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("the %s hook \"%s\" was not run, as the copy was interrupted", phase, hookObj.command)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, hookObj.timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(runCtx, "cmd", "/C", hookObj.command)
+	} else {
+		cmd = exec.CommandContext(runCtx, "sh", "-c", hookObj.command)
+	}
+	cmd.Env = append(os.Environ(), environment...)
+
+	// the shell may leave child processes behind when it is killed, so don't wait long for them to release the output
+	cmd.WaitDelay = time.Second
+
+	logger.info(fmt.Sprintf("running %s hook: %s", phase, hookObj.command))
+
+	output, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\r\n"), "\n") {
+		if len(line) > 0 {
+			logger.info(fmt.Sprintf("    %s", strings.TrimRight(line, "\r")))
+		}
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("the %s hook \"%s\" was stopped, as the copy was interrupted", phase, hookObj.command)
+	} else if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("the %s hook \"%s\" timed out after %s", phase, hookObj.command, hookObj.timeout)
+	} else if err != nil {
+		return fmt.Errorf("the %s hook \"%s\" failed: %s", phase, hookObj.command, err)
+	}
+
+	return nil
+}
+
+// hookEnvironment returns the environment variables that tell a hook which operation it is running for,
+// and, once the copy has finished, how it went.
+func hookEnvironment(config *configuration, phase string, runStats *Stats) []string {
+	destinations := make([]string, 0, len(config.destinations))
+	for index := range config.destinations {
+		destinations = append(destinations, config.destinations[index].path)
+	}
+
+	environment := []string{
+		"GO_COPY_HOOK=" + phase,
+		"GO_COPY_OPERATION=" + config.key,
+		"GO_COPY_OPERATION_NAME=" + config.name,
+		"GO_COPY_SOURCE=" + config.source,
+		"GO_COPY_DESTINATIONS=" + strings.Join(destinations, string(os.PathListSeparator)),
+	}
+
+	if runStats != nil {
+		environment = append(environment,
+			"GO_COPY_RESULT="+runStats.Outcome(),
+			"GO_COPY_SOURCE_FILES="+strconv.Itoa(runStats.NumberOfSourceFiles),
+			"GO_COPY_FILES_COPIED="+strconv.Itoa(runStats.TotalFilesCopied),
+			"GO_COPY_FILES_SKIPPED="+strconv.Itoa(runStats.TotalFilesSkipped),
+			"GO_COPY_FILES_FAILED="+strconv.Itoa(runStats.TotalFilesFailed),
+			"GO_COPY_RETRIES="+strconv.Itoa(runStats.TotalRetries),
+			"GO_COPY_BYTES_COPIED="+strconv.FormatInt(runStats.BytesCopied, 10),
+			"GO_COPY_DURATION_SECONDS="+strconv.FormatFloat(runStats.TimeToCopy.Seconds(), 'f', 3, 64),
+			"GO_COPY_WARNINGS="+strconv.Itoa(runStats.NumberOfWarnings),
+			"GO_COPY_ERRORS="+strconv.Itoa(runStats.NumberOfErrors),
+		)
+	}
+
+	return environment
+}
@@ -0,0 +1,269 @@
+package copylib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The formats ListConfigurations can display the operations in.
+const (
+	ListFormatTable = "table"
+	ListFormatJSON  = "json"
+	ListFormatYAML  = "yaml"
+)
+
+// operationListing is everything shown about an operation when listing the config.
+type operationListing struct {
+	Key          string               `json:"key" yaml:"key"`
+	Name         string               `json:"name,omitempty" yaml:"name,omitempty"`
+	Replace      string               `json:"replace,omitempty" yaml:"replace,omitempty"`
+	Schedule     string               `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	NextRun      *time.Time           `json:"nextRun,omitempty" yaml:"nextRun,omitempty"`
+	Source       *pathListing         `json:"source,omitempty" yaml:"source,omitempty"`
+	Destinations []destinationListing `json:"destinations,omitempty" yaml:"destinations,omitempty"`
+	LastRun      *runRecord           `json:"lastRun,omitempty" yaml:"lastRun,omitempty"`
+	Error        string               `json:"error,omitempty" yaml:"error,omitempty"`
+
+	schedule *Schedule
+}
+
+// pathListing describes a path from the config, and what it currently resolves to on this machine.
+type pathListing struct {
+	Path         string `json:"path" yaml:"path"`
+	ResolvedPath string `json:"resolvedPath" yaml:"resolvedPath"`
+	Exists       bool   `json:"exists" yaml:"exists"`
+}
+
+// destinationListing describes a destination of an operation, including how much space is left on it.
+type destinationListing struct {
+	pathListing `yaml:",inline"`
+	Label       string   `json:"label,omitempty" yaml:"label,omitempty"`
+	Replace     string   `json:"replace" yaml:"replace"`
+	Enabled     bool     `json:"enabled" yaml:"enabled"`
+	Required    bool     `json:"required" yaml:"required"`
+	Exclude     []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	FreeBytes   *uint64  `json:"freeBytes,omitempty" yaml:"freeBytes,omitempty"`
+}
+
+// ListConfigurations displays every operation in the config that applies to this machine, sorted by key, in the given format.
+// The hostname function returns the name of this machine, which is usually os.Hostname.
+func ListConfigurations(format string, hostname func() (string, error)) error {
+	return listConfigurations(os.Stdout, format, time.Now(), hostname)
+}
+
+// listConfigurations lists the operations as of the given time, writing the JSON or YAML to the output.
+// The table is shown with the Print functions, like the rest of the command line tool's output.
+func listConfigurations(output io.Writer, format string, now time.Time, hostname func() (string, error)) error {
+	var listings []operationListing
+
+	switch format {
+	case ListFormatTable, ListFormatJSON, ListFormatYAML:
+	default:
+		return fmt.Errorf("unknown list format \"%s\"; expected table, json or yaml", format)
+	}
+
+	lastRuns := loadLastRuns()
+	for _, key := range ApplicableOperations(hostname) {
+		listing := newOperationListing(key, now, hostname)
+		lastRun, hasRun := lastRuns[key]
+		if hasRun {
+			listing.LastRun = &lastRun
+		}
+		if listing.schedule != nil {
+			nextRun := listing.schedule.firstRun(now, lastRun.Started, hasRun)
+			listing.NextRun = &nextRun
+		}
+		listings = append(listings, listing)
+	}
+
+	switch format {
+	case ListFormatJSON:
+		contents, err := json.MarshalIndent(listings, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(output, string(contents))
+
+	case ListFormatYAML:
+		contents, err := yaml.Marshal(listings)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(output, string(contents))
+
+	default:
+		for _, listing := range listings {
+			listing.print()
+		}
+	}
+
+	return nil
+}
+
+// newOperationListing gathers the details of the operation with the given key, with its paths as they are at the given time.
+func newOperationListing(key string, now time.Time, hostname func() (string, error)) operationListing {
+	listing := operationListing{Key: key}
+
+	config, err := loadConfiguration(key)
+	if err != nil {
+		listing.Error = err.Error()
+		return listing
+	}
+
+	err = config.expandPathTemplates(now, hostname)
+	if err != nil {
+		listing.Error = err.Error()
+		return listing
+	}
+
+	listing.Name = config.name
+	listing.Replace = config.replace.String()
+	if config.schedule != nil {
+		listing.Schedule = config.schedule.String()
+		listing.schedule = config.schedule
+	}
+	source := newPathListing(config.source)
+	listing.Source = &source
+
+	for index := range config.destinations {
+		dest := &config.destinations[index]
+		destListing := destinationListing{
+			pathListing: newPathListing(dest.path),
+			Label:       dest.label,
+			Replace:     dest.replace.String(),
+			Enabled:     dest.enabled,
+			Required:    dest.required,
+			Exclude:     dest.exclude,
+		}
+
+		freeBytes, err := getFreeSpace(nearestExistingFolder(destListing.ResolvedPath))
+		if err == nil {
+			destListing.FreeBytes = &freeBytes
+		}
+
+		listing.Destinations = append(listing.Destinations, destListing)
+	}
+
+	return listing
+}
+
+// newPathListing resolves the path to an absolute path, following any symbolic links, and checks that it exists.
+func newPathListing(configPath string) pathListing {
+	listing := pathListing{
+		Path:         configPath,
+		ResolvedPath: configPath,
+	}
+
+	absolutePath, err := filepath.Abs(configPath)
+	if err == nil {
+		listing.ResolvedPath = absolutePath
+	}
+
+	_, err = os.Stat(listing.ResolvedPath)
+	if err == nil {
+		listing.Exists = true
+
+		resolvedPath, err := filepath.EvalSymlinks(listing.ResolvedPath)
+		if err == nil {
+			listing.ResolvedPath = resolvedPath
+		}
+	}
+
+	return listing
+}
+
+// nearestExistingFolder returns the folder itself if it exists, otherwise the closest parent folder that does.
+func nearestExistingFolder(folder string) string {
+	for {
+		_, err := os.Stat(folder)
+		if err == nil {
+			return folder
+		}
+
+		parent := filepath.Dir(folder)
+		if parent == folder {
+			return folder
+		}
+		folder = parent
+	}
+}
+
+// print displays a text representation of the operation, with its destinations laid out as a table.
+func (listing *operationListing) print() {
+	PrintKeyValue("Name: ", fmt.Sprintf("%s (%s)", listing.Name, listing.Key))
+	if len(listing.Error) > 0 {
+		PrintErrorHighlight(listing.Error)
+		return
+	}
+
+	PrintKeyValue("  Source: ", fmt.Sprintf("%s (%s)", listing.Source.ResolvedPath, existsText(listing.Source.Exists)))
+	PrintKeyValue("  Replace: ", listing.Replace)
+	if listing.NextRun != nil {
+		PrintKeyValue("  Schedule: ", fmt.Sprintf("%s (next run %s)", listing.Schedule, listing.NextRun.Local().Format(time.DateTime)))
+	}
+	if listing.LastRun != nil {
+		PrintKeyValue("  Last Run: ", fmt.Sprintf("%s (%s)", listing.LastRun.Finished.Local().Format(time.DateTime), listing.LastRun.Result))
+	} else {
+		PrintKeyValue("  Last Run: ", "never")
+	}
+
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "PATH\tLABEL\tREPLACE\tENABLED\tREQUIRED\tEXISTS\tFREE\tEXCLUDE")
+	for _, dest := range listing.Destinations {
+		freeSpace := "unknown"
+		if dest.FreeBytes != nil {
+			freeSpace = formatBytes(*dest.FreeBytes)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", dest.ResolvedPath, dest.Label, dest.Replace, yesNo(dest.Enabled),
+			yesNo(dest.Required), yesNo(dest.Exists), freeSpace, strings.Join(dest.Exclude, ", "))
+	}
+	writer.Flush()
+
+	lines := strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n")
+	PrintKeyValueArray("  Destinations: ", lines)
+	PrintBlankLine()
+}
+
+// existsText returns a short description of whether a path exists.
+func existsText(exists bool) string {
+	if exists {
+		return "exists"
+	}
+
+	return "missing"
+}
+
+// yesNo returns "yes" or "no" for the value.
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+
+	return "no"
+}
+
+// formatBytes returns the number of bytes in the largest unit that keeps the value at one or more.
+func formatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	divisor, exponent := uint64(unit), 0
+	for remaining := bytes / unit; remaining >= unit; remaining /= unit {
+		divisor *= unit
+		exponent++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(divisor), "KMGTPE"[exponent])
+}
@@ -0,0 +1,266 @@
+package copylib
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// testListingConfig is the config listed by the tests, with the folders filled in by loadTestListingConfig.
+// Its operations are out of order, one is invalid, one is for another machine than testListingHostname, and the log
+// section is not an operation.
+const testListingConfig = `
+zelda:
+  name: Zelda
+  source: '{root}/zelda'
+  destinations:
+    - '{root}/backups/{host}/zelda'
+  replace: skip
+
+photos:
+  name: Photos
+  source: '{root}/photos'
+  schedule: 6h
+  destinations:
+    - path: '{root}/backups/photos'
+      label: NAS
+      exclude:
+        - '*.tmp'
+    - path: '{root}/usb/photos'
+      replace: always
+      enabled: false
+      required: false
+  replace: never
+
+broken:
+  source: '{root}/broken'
+  destinations:
+    - '{root}/backups/broken'
+  replace: always
+
+elsewhere:
+  name: Elsewhere
+  hosts:
+    - office-pc
+  source: '{root}/elsewhere'
+  destinations:
+    - '{root}/backups/elsewhere'
+  replace: always
+
+log:
+  level: info
+`
+
+// testListingHostname is the name of the machine the tests list the operations on.
+func testListingHostname() (string, error) {
+	return "gaming-pc", nil
+}
+
+// loadTestListingConfig loads the test config into viper, with its folders in a temporary folder, and returns that folder.
+// Only photos has a source, and the last run of photos is in the history.
+func loadTestListingConfig(t *testing.T, lastRun time.Time) string {
+	root := t.TempDir()
+	t.Setenv("GO_COPY_STATE_DIR", filepath.Join(root, "state"))
+
+	configFile := filepath.Join(root, "go-copy-config.yaml")
+	err := os.WriteFile(configFile, []byte(strings.ReplaceAll(testListingConfig, "{root}", filepath.ToSlash(root))), 0644)
+	if err != nil {
+		t.Fatalf("unable to write the config: %s", err)
+	}
+	err = os.MkdirAll(filepath.Join(root, "photos"), 0755)
+	if err != nil {
+		t.Fatalf("unable to create the source: %s", err)
+	}
+
+	viper.SetConfigFile(configFile)
+	err = viper.ReadInConfig()
+	if err != nil {
+		t.Fatalf("unable to read the config: %s", err)
+	}
+	t.Cleanup(viper.Reset)
+
+	err = RecordRun("photos", newTestFinishedRunner("Photos", lastRun, &Stats{TotalFilesCopied: 2, NumberOfErrors: 1}), 3)
+	if err != nil {
+		t.Fatalf("unable to record the last run: %s", err)
+	}
+
+	return root
+}
+
+// checkTestListings checks the listings of the test config, however they were written.
+func checkTestListings(t *testing.T, root string, lastRun time.Time, listings []operationListing) {
+	keys := make([]string, 0, len(listings))
+	for _, listing := range listings {
+		keys = append(keys, listing.Key)
+	}
+	if strings.Join(keys, ",") != "broken,photos,zelda" {
+		t.Fatalf("expected the operations for this machine sorted by key, but got %v", keys)
+	}
+
+	broken := listings[0]
+	if !strings.Contains(broken.Error, "\"name\" is required") || broken.Source != nil {
+		t.Errorf("expected the invalid operation to be listed with its error, but got %+v", broken)
+	}
+
+	photos := listings[1]
+	if photos.Name != "Photos" || photos.Replace != replaceNever.String() || photos.Schedule != "6h" {
+		t.Errorf("expected the settings of photos, but got %+v", photos)
+	}
+	if photos.Source == nil || !photos.Source.Exists || photos.Source.ResolvedPath != resolvedTestPath(t, filepath.Join(root, "photos")) {
+		t.Errorf("expected the source of photos to exist, but got %+v", photos.Source)
+	}
+	if photos.LastRun == nil || !photos.LastRun.Started.Equal(lastRun) || photos.LastRun.Result != "partial" {
+		t.Errorf("expected the last run of photos to be the partial one, but got %+v", photos.LastRun)
+	}
+	if photos.NextRun == nil || !photos.NextRun.Equal(lastRun.Add(6*time.Hour)) {
+		t.Errorf("expected photos to run next 6 hours after its last run, but got %v", photos.NextRun)
+	}
+
+	if len(photos.Destinations) != 2 {
+		t.Fatalf("expected 2 destinations for photos, but got %d", len(photos.Destinations))
+	}
+	nas, usb := photos.Destinations[0], photos.Destinations[1]
+	if nas.Label != "NAS" || nas.Replace != replaceNever.String() || !nas.Enabled || !nas.Required || strings.Join(nas.Exclude, ",") != "*.tmp" {
+		t.Errorf("expected the NAS destination with the operation's replace mode, but got %+v", nas)
+	}
+	if nas.Exists || nas.FreeBytes == nil {
+		t.Errorf("expected the missing NAS folder to have the free space of the folder above it, but got %+v", nas)
+	}
+	if usb.Label != "" || usb.Replace != replaceAlways.String() || usb.Enabled || usb.Required {
+		t.Errorf("expected the disabled USB destination with its own settings, but got %+v", usb)
+	}
+
+	zelda := listings[2]
+	if zelda.Source == nil || zelda.Source.Exists || zelda.LastRun != nil || zelda.NextRun != nil {
+		t.Errorf("expected zelda to have a missing source, no runs and no schedule, but got %+v", zelda)
+	}
+	if len(zelda.Destinations) != 1 || !strings.Contains(zelda.Destinations[0].Path, "/gaming-pc/") {
+		t.Errorf("expected the destination of zelda to be on the host the operations were listed on, but got %+v", zelda.Destinations)
+	}
+}
+
+// resolvedTestPath returns the path as the listing resolves it, following any symbolic links in the temporary folder.
+func resolvedTestPath(t *testing.T, path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		t.Fatalf("unable to resolve %s: %s", path, err)
+	}
+
+	return resolved
+}
+
+func TestListConfigurationsJSONSuccess(t *testing.T) {
+	lastRun := time.Date(2026, time.March, 6, 14, 20, 30, 0, time.UTC)
+	root := loadTestListingConfig(t, lastRun)
+
+	var output bytes.Buffer
+	err := listConfigurations(&output, ListFormatJSON, lastRun.Add(time.Hour), testListingHostname)
+	if err != nil {
+		t.Fatalf("unexpected error listing the operations: %s", err)
+	}
+
+	var listings []operationListing
+	err = json.Unmarshal(output.Bytes(), &listings)
+	if err != nil {
+		t.Fatalf("expected the listing to be JSON, but got %s: %s", output.String(), err)
+	}
+	checkTestListings(t, root, lastRun, listings)
+
+	if !strings.Contains(output.String(), `"resolvedPath"`) || !strings.Contains(output.String(), `"nextRun"`) {
+		t.Errorf("expected the fields in camelCase, but got %s", output.String())
+	}
+}
+
+func TestListConfigurationsYAMLSuccess(t *testing.T) {
+	lastRun := time.Date(2026, time.March, 6, 14, 20, 30, 0, time.UTC)
+	root := loadTestListingConfig(t, lastRun)
+
+	var output bytes.Buffer
+	err := listConfigurations(&output, ListFormatYAML, lastRun.Add(time.Hour), testListingHostname)
+	if err != nil {
+		t.Fatalf("unexpected error listing the operations: %s", err)
+	}
+
+	var listings []operationListing
+	err = yaml.Unmarshal(output.Bytes(), &listings)
+	if err != nil {
+		t.Fatalf("expected the listing to be YAML, but got %s: %s", output.String(), err)
+	}
+	checkTestListings(t, root, lastRun, listings)
+
+	// the path of a destination is inlined, rather than nested
+	if strings.Contains(output.String(), "pathlisting") {
+		t.Errorf("expected the path of each destination to be inlined, but got %s", output.String())
+	}
+}
+
+func TestListConfigurationsTableSuccess(t *testing.T) {
+	lastRun := time.Date(2026, time.March, 6, 14, 20, 30, 0, time.UTC)
+	root := loadTestListingConfig(t, lastRun)
+
+	var output bytes.Buffer
+	previousOutput, previousNoColor := color.Output, color.NoColor
+	color.Output, color.NoColor = &output, true
+	t.Cleanup(func() { color.Output, color.NoColor = previousOutput, previousNoColor })
+
+	var unused bytes.Buffer
+	err := listConfigurations(&unused, ListFormatTable, lastRun.Add(time.Hour), testListingHostname)
+	if err != nil {
+		t.Fatalf("unexpected error listing the operations: %s", err)
+	}
+	if unused.Len() > 0 {
+		t.Errorf("expected the table to be shown like the rest of the output, but got %s", unused.String())
+	}
+
+	table := output.String()
+	broken := strings.Index(table, "Name:  (broken)")
+	photos := strings.Index(table, "Name: Photos (photos)")
+	zelda := strings.Index(table, "Name: Zelda (zelda)")
+	if broken < 0 || photos < broken || zelda < photos {
+		t.Fatalf("expected the operations sorted by key, but got:\n%s", table)
+	}
+	if strings.Contains(table, "Elsewhere") {
+		t.Errorf("expected the operation for another machine to be left out, but got:\n%s", table)
+	}
+
+	photosTable := table[photos:zelda]
+	expected := []string{
+		"Source: " + resolvedTestPath(t, filepath.Join(root, "photos")) + " (exists)",
+		"Schedule: 6h (next run " + lastRun.Add(6*time.Hour).Local().Format(time.DateTime) + ")",
+		"Last Run: " + lastRun.Add(time.Minute).Local().Format(time.DateTime) + " (partial)",
+		"PATH",
+		"LABEL",
+		"EXCLUDE",
+		"NAS",
+		"*.tmp",
+	}
+	for _, text := range expected {
+		if !strings.Contains(photosTable, text) {
+			t.Errorf("expected the listing of photos to contain \"%s\", but got:\n%s", text, photosTable)
+		}
+	}
+	if !strings.Contains(table[zelda:], "Last Run: never") {
+		t.Errorf("expected zelda never to have run, but got:\n%s", table[zelda:])
+	}
+}
+
+func TestListConfigurationsUnknownFormatFailure(t *testing.T) {
+	t.Parallel()
+
+	var output bytes.Buffer
+	err := listConfigurations(&output, "xml", time.Now(), testListingHostname)
+	if err == nil || !strings.Contains(err.Error(), "unknown list format") {
+		t.Errorf("expected an error for an unknown format, but got %v", err)
+	}
+	if output.Len() > 0 {
+		t.Errorf("expected nothing to be listed, but got %s", output.String())
+	}
+}
@@ -0,0 +1,272 @@
+package copylib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	locksFolder = "locks"
+	// lockRetryInterval is how often a run waiting for a lock checks if it has been released
+	lockRetryInterval = time.Second
+)
+
+// ErrLocked is returned, wrapped in an error that says who holds the lock, when another run is already using
+// the operation or one of its destinations.
+var ErrLocked = errors.New("another run holds the lock")
+
+// errLockHeld is returned by lockFile when another run has the file locked.
+var errLockHeld = errors.New("the lock file is locked by another run")
+
+// lockOwner is written to a lock file, to say which run holds it.
+type lockOwner struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	Operation string    `json:"operation"`
+	Started   time.Time `json:"started"`
+}
+
+// fileLock is an advisory lock on a file in the locks folder of the state directory. The OS holds the lock for as
+// long as the run has the file open, so it is given back even when the run crashes, and two runs can never both
+// take it over.
+type fileLock struct {
+	filename    string
+	description string
+	file        *os.File
+}
+
+// runLocks are the locks a run holds on its operation and destinations.
+type runLocks struct {
+	locks []*fileLock
+	held  []*fileLock
+}
+
+// newRunLocks creates the locks for an operation, if it has a key, and for each of its enabled destinations.
+// They are sorted, so runs always take them in the same order.
+func newRunLocks(operationKey string, config *configuration) (*runLocks, error) {
+	stateDir, err := stateDirectory()
+	if err != nil {
+		return nil, err
+	}
+	lockDir := filepath.Join(stateDir, locksFolder)
+
+	var locks []*fileLock
+	if len(operationKey) > 0 {
+		locks = append(locks, &fileLock{
+			filename:    filepath.Join(lockDir, "operation-"+lockName(strings.ToLower(operationKey))+".lock"),
+			description: fmt.Sprintf("operation \"%s\"", operationKey),
+		})
+	}
+
+	for _, dest := range config.destinations {
+		if !dest.enabled {
+			continue
+		}
+
+		destPath, err := filepath.Abs(dest.path)
+		if err != nil {
+			destPath = filepath.Clean(dest.path)
+		}
+		locks = append(locks, &fileLock{
+			filename:    filepath.Join(lockDir, "destination-"+lockName(destPath)+".lock"),
+			description: fmt.Sprintf("destination %s", dest.displayName()),
+		})
+	}
+
+	sort.Slice(locks, func(first int, second int) bool {
+		return locks[first].filename < locks[second].filename
+	})
+
+	return &runLocks{locks: locks}, nil
+}
+
+// lockName turns a key or path into a name that is safe to use in a file name.
+func lockName(text string) string {
+	hash := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(hash[:8])
+}
+
+// acquire takes every lock, or none of them. If another run holds one of them, it fails with ErrLocked,
+// unless waitCtx is given, in which case it waits until the locks are free or waitCtx is done.
+func (locks *runLocks) acquire(owner lockOwner, waitCtx context.Context) error {
+	for waiting := false; ; waiting = true {
+		err := locks.tryAcquire(owner)
+		if err == nil || !errors.Is(err, ErrLocked) || waitCtx == nil {
+			return err
+		}
+		if !waiting {
+			PrintWarning(fmt.Sprintf("%s, so waiting for it to finish", err))
+		}
+
+		select {
+		case <-waitCtx.Done():
+			return err
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// tryAcquire takes every lock, releasing those it took if one of them is held by another run,
+// so a run never holds some of its locks while it waits for the others.
+func (locks *runLocks) tryAcquire(owner lockOwner) error {
+	for _, lock := range locks.locks {
+		err := lock.tryAcquire(owner)
+		if err != nil {
+			locks.release()
+			return err
+		}
+		locks.held = append(locks.held, lock)
+	}
+
+	return nil
+}
+
+// release gives back the locks this run holds.
+func (locks *runLocks) release() {
+	if locks == nil {
+		return
+	}
+
+	for _, lock := range locks.held {
+		err := lock.release()
+		if err != nil {
+			PrintWarning(fmt.Sprintf("unable to release the lock on %s: %s", lock.description, err))
+		}
+	}
+	locks.held = nil
+}
+
+// tryAcquire opens the lock file and locks it, then writes the owner into it. A lock file that is there, but that
+// no run has locked, was left behind by a run that crashed, so it is taken over.
+func (lock *fileLock) tryAcquire(owner lockOwner) error {
+	err := os.MkdirAll(filepath.Dir(lock.filename), 0755)
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.MarshalIndent(owner, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(lock.filename, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+
+		err = lockFile(file)
+		if errors.Is(err, errLockHeld) {
+			file.Close()
+			return fmt.Errorf("%s is in use: %w (%s)", lock.description, ErrLocked, lock.readHolder())
+		} else if err != nil {
+			file.Close()
+			return err
+		}
+
+		if !lock.isCurrent(file) {
+			// the run holding the lock removed the file as it released it, so lock the file that is there now
+			unlockFile(file)
+			file.Close()
+			continue
+		}
+
+		previous, err := io.ReadAll(file)
+		if err == nil && len(previous) > 0 {
+			PrintWarning(fmt.Sprintf("taking over the lock on %s, left behind by %s", lock.description, describeLockOwner(previous)))
+		}
+
+		err = file.Truncate(0)
+		if err == nil {
+			_, err = file.WriteAt(contents, 0)
+		}
+		if err == nil {
+			err = file.Sync()
+		}
+		if err != nil {
+			unlockFile(file)
+			file.Close()
+			return err
+		}
+
+		lock.file = file
+		return nil
+	}
+
+	return fmt.Errorf("%s is in use: %w", lock.description, ErrLocked)
+}
+
+// isCurrent checks if the open lock file is still the one in the locks folder.
+func (lock *fileLock) isCurrent(file *os.File) bool {
+	openInfo, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(lock.filename)
+
+	return err == nil && os.SameFile(openInfo, info)
+}
+
+// release clears and removes the lock file, then unlocks it.
+func (lock *fileLock) release() error {
+	if lock.file == nil {
+		return nil
+	}
+
+	// the owner is cleared while the file is still locked, so a file that cannot be removed is not mistaken for one
+	// left behind by a run that crashed
+	err := lock.file.Truncate(0)
+	removeErr := os.Remove(lock.filename)
+	unlockFile(lock.file)
+	closeErr := lock.file.Close()
+	lock.file = nil
+
+	if removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+		// Windows cannot remove a file while it is open, so it is removed once it is closed, unless another run
+		// has opened it by then, in which case it is left for that run
+		os.Remove(lock.filename)
+	}
+	if err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// readHolder describes the run holding the lock.
+func (lock *fileLock) readHolder() string {
+	contents, err := os.ReadFile(lock.filename)
+	if err != nil {
+		return "a run whose lock file cannot be read"
+	}
+
+	return describeLockOwner(contents)
+}
+
+// describeLockOwner describes the run that wrote the contents of a lock file.
+func describeLockOwner(contents []byte) string {
+	var owner lockOwner
+
+	err := json.Unmarshal(contents, &owner)
+	if err != nil || owner.PID <= 0 {
+		return "a run whose lock file cannot be read"
+	}
+
+	holder := fmt.Sprintf("process %d", owner.PID)
+	if len(owner.Operation) > 0 {
+		holder = fmt.Sprintf("operation \"%s\" in %s", owner.Operation, holder)
+	}
+
+	return fmt.Sprintf("%s on %s, since %s", holder, owner.Host, owner.Started.Local().Format(time.DateTime))
+}
@@ -0,0 +1,156 @@
+package copylib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a PID above the largest one any of the supported systems hands out, for the owner of a lock left behind
+const deadPID = 1 << 30
+
+func newTestRunLocks(folder string, names ...string) *runLocks {
+	locks := &runLocks{}
+	for _, name := range names {
+		locks.locks = append(locks.locks, &fileLock{filename: filepath.Join(folder, name+".lock"), description: name})
+	}
+
+	return locks
+}
+
+func newTestLockOwner(pid int) lockOwner {
+	host, _ := os.Hostname()
+	return lockOwner{PID: pid, Host: host, Operation: "saves", Started: time.Now()}
+}
+
+func writeTestLockFile(t *testing.T, filename string, owner lockOwner) {
+	contents, err := json.Marshal(owner)
+	if err != nil {
+		t.Fatalf("unable to create the lock file: %s", err)
+	}
+	err = os.WriteFile(filename, contents, 0644)
+	if err != nil {
+		t.Fatalf("unable to create the lock file: %s", err)
+	}
+}
+
+func TestRunLocksSuccess(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	first := newTestRunLocks(folder, "operation", "destination")
+	second := newTestRunLocks(folder, "operation", "destination")
+
+	err := first.acquire(newTestLockOwner(os.Getpid()), nil)
+	if err != nil {
+		t.Fatalf("unexpected error taking the locks: %s", err)
+	}
+
+	err = second.acquire(newTestLockOwner(os.Getpid()), nil)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected the locks to be held by the first run, but got: %v", err)
+	}
+
+	// a run that waits gets the locks once the first run releases them
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		first.release()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = second.acquire(newTestLockOwner(os.Getpid()), ctx)
+	if err != nil {
+		t.Fatalf("expected the waiting run to get the locks, but got: %s", err)
+	}
+
+	second.release()
+	entries, _ := os.ReadDir(folder)
+	if len(entries) != 0 {
+		t.Errorf("expected every lock file to be removed once released, but %d were left", len(entries))
+	}
+}
+
+func TestRunLocksFailure(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	held := newTestRunLocks(folder, "destination")
+	err := held.acquire(newTestLockOwner(os.Getpid()), nil)
+	if err != nil {
+		t.Fatalf("unexpected error taking the lock: %s", err)
+	}
+	defer held.release()
+
+	// the operation lock is taken first, so it must be given back when the destination lock is not free
+	locks := newTestRunLocks(folder, "a-operation", "destination")
+	err = locks.acquire(newTestLockOwner(os.Getpid()), nil)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected the destination to be locked, but got: %v", err)
+	}
+	_, err = os.Stat(filepath.Join(folder, "a-operation.lock"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the operation lock to be released when the destination lock could not be taken")
+	}
+
+	// waiting stops when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err = newTestRunLocks(folder, "destination").acquire(newTestLockOwner(os.Getpid()), ctx)
+	if !errors.Is(err, ErrLocked) {
+		t.Errorf("expected waiting for the lock to stop with the context, but got: %v", err)
+	}
+}
+
+func TestRunLocksStaleSuccess(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	writeTestLockFile(t, filepath.Join(folder, "operation.lock"), newTestLockOwner(deadPID))
+
+	// runs that all find the lock left behind at once take it over one at a time, so only one of them gets it
+	var waiter sync.WaitGroup
+	results := make(chan error, 8)
+	for range 8 {
+		waiter.Add(1)
+		go func() {
+			defer waiter.Done()
+			locks := newTestRunLocks(folder, "operation")
+			err := locks.acquire(newTestLockOwner(os.Getpid()), nil)
+			if err == nil {
+				t.Cleanup(locks.release)
+			}
+			results <- err
+		}()
+	}
+	waiter.Wait()
+	close(results)
+
+	acquired := 0
+	for err := range results {
+		if err == nil {
+			acquired++
+		} else if !errors.Is(err, ErrLocked) {
+			t.Errorf("unexpected error taking over the lock: %s", err)
+		}
+	}
+	if acquired != 1 {
+		t.Fatalf("expected exactly one run to take over the lock left behind, but %d did", acquired)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(folder, "operation.lock"))
+	if err != nil {
+		t.Fatalf("unable to read the lock file: %s", err)
+	}
+	var owner lockOwner
+	err = json.Unmarshal(contents, &owner)
+	if err != nil || owner.PID != os.Getpid() {
+		t.Errorf("expected the lock to be held by this process, but got: %s", contents)
+	}
+}
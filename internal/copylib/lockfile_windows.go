@@ -0,0 +1,32 @@
+//go:build windows
+
+package copylib
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockOffsetHigh puts the byte that is locked far past the owner written to the file, as Windows stops other
+// processes from reading a locked range, and other runs read the owner to say who holds the lock.
+const lockOffsetHigh = 1
+
+// lockFile takes an exclusive lock on the file, without waiting, failing with errLockHeld if another run has it.
+func lockFile(file *os.File) error {
+	overlapped := windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	err := windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, &overlapped)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errLockHeld
+	}
+
+	return err
+}
+
+// unlockFile gives back the lock on the file.
+func unlockFile(file *os.File) error {
+	overlapped := windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, &overlapped)
+}
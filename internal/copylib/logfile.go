@@ -0,0 +1,376 @@
+package copylib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// logSettingsKey is the section of the config file with the log file settings, so it is never an operation
+	logSettingsKey = "log"
+
+	defaultLogFileMaxSize = 10 << 20
+	defaultLogFileKeep    = 5
+
+	// logFileTimeFormat is the time a log file was rotated, added to its name, so the names sort by it
+	logFileTimeFormat = "20060102-150405.000"
+)
+
+// ErrLogSectionIsOperation is returned, wrapped, when the "log" section of the config file is an operation,
+// which cannot run as the key is reserved for the log file settings.
+var ErrLogSectionIsOperation = errors.New("the \"log\" section is reserved for the log file settings, so it cannot be an operation")
+
+// logFileSettings are the "log" section of the config file.
+type logFileSettings struct {
+	path   string
+	level  slog.Level
+	format string
+	// maxSize rotates the file before it grows beyond this many bytes, unless it is zero
+	maxSize int64
+	// maxAge rotates the file once it was started this long ago, unless it is zero
+	maxAge time.Duration
+	// keep is how many rotated files are kept
+	keep int
+}
+
+// newLogFileSettings reads the "log" section of the config file, which may be empty.
+func newLogFileSettings(setting interface{}) (logFileSettings, error) {
+	settings := logFileSettings{
+		level:   slog.LevelInfo,
+		format:  LogFormatText,
+		maxSize: defaultLogFileMaxSize,
+		keep:    defaultLogFileKeep,
+	}
+	if setting == nil {
+		return settings, nil
+	}
+
+	err := checkLogSection(setting)
+	if err != nil {
+		return settings, err
+	}
+
+	logSettings, ok := setting.(map[string]interface{})
+	if !ok {
+		return settings, fmt.Errorf("must be a mapping with \"file\", \"level\", \"format\", \"max_size\", \"max_age\" and \"keep\"")
+	}
+
+	for key, value := range lowerCaseKeys(logSettings) {
+		switch key {
+		case "file":
+			file, ok := value.(string)
+			if !ok {
+				return settings, fmt.Errorf("\"file\" must be a path")
+			}
+			settings.path = strings.TrimSpace(file)
+		case "level":
+			level, _ := value.(string)
+			settings.level, err = parseLogLevel(level)
+			if err != nil {
+				return settings, err
+			}
+		case "format":
+			settings.format, _ = value.(string)
+			err = checkLogFormat(settings.format)
+			if err != nil {
+				return settings, err
+			}
+		case "max_size":
+			settings.maxSize, err = parseSize(value)
+			if err != nil {
+				return settings, fmt.Errorf("\"max_size\" %s", err)
+			}
+		case "max_age":
+			if value == 0 || value == "0" {
+				// the file is only rotated when it gets too big
+				settings.maxAge = 0
+				continue
+			}
+			settings.maxAge, err = parseDuration(value)
+			if err != nil {
+				return settings, fmt.Errorf("\"max_age\" %s", err)
+			}
+		case "keep":
+			keep, ok := value.(int)
+			if !ok || keep < 0 {
+				return settings, fmt.Errorf("\"keep\" must be a whole number that is zero or more")
+			}
+			settings.keep = keep
+		default:
+			return settings, fmt.Errorf("has an unknown setting \"%s\"", key)
+		}
+	}
+
+	return settings, nil
+}
+
+// parseLogLevel reads the level of a log file: debug, info, warning or error.
+func parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warning", "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+
+	return slog.LevelInfo, fmt.Errorf("\"level\" must be debug, info, warning or error, not \"%s\"", level)
+}
+
+// parseSize reads a size from the config file, such as "10MB", "512KB" or a number of bytes, where each unit
+// is 1024 of the one before it. Zero turns the limit off.
+func parseSize(value interface{}) (int64, error) {
+	switch setting := value.(type) {
+	case int:
+		if setting >= 0 {
+			return int64(setting), nil
+		}
+	case string:
+		text := strings.ToUpper(strings.TrimSpace(setting))
+		text = strings.TrimSuffix(strings.TrimSuffix(text, "B"), "I")
+		multiplier := int64(1)
+		if unit := strings.Index("KMGT", text[max(len(text)-1, 0):]); len(text) > 0 && unit >= 0 {
+			multiplier = 1 << (10 * (unit + 1))
+			text = text[:len(text)-1]
+		}
+		size, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err == nil && size >= 0 {
+			return int64(size * float64(multiplier)), nil
+		}
+	}
+
+	return 0, fmt.Errorf("must be a size, such as \"10MB\" or \"512KB\"")
+}
+
+// OpenLogFile starts writing the log output to a file as well, at its own level, whatever the logging mode of the
+// console, using the "log" section of the loaded config file, if there is one. The filename, when it is given,
+// is used in place of the file in the config. Without either, there is no log file.
+func OpenLogFile(filename string) error {
+	settings, err := newLogFileSettings(viper.Get(logSettingsKey))
+	if err != nil {
+		return fmt.Errorf("the log settings are invalid: %w", err)
+	}
+	if len(filename) > 0 {
+		settings.path = filename
+	}
+	if len(settings.path) == 0 {
+		return nil
+	}
+
+	file, err := openRotatingFile(settings)
+	if err != nil {
+		return fmt.Errorf("unable to open the log file %s: %s", settings.path, err)
+	}
+
+	CloseLogFile()
+	defaultLogger.file = newLogFileHandler(file, settings)
+	defaultLogger.closer = file
+
+	return nil
+}
+
+// CloseLogFile stops writing the log output to a file.
+func CloseLogFile() {
+	if defaultLogger.closer != nil {
+		defaultLogger.closer.Close()
+	}
+	defaultLogger.file = nil
+	defaultLogger.closer = nil
+}
+
+// newLogFileHandler creates the slog handler that writes a log file, which is never in color.
+func newLogFileHandler(output io.Writer, settings logFileSettings) slog.Handler {
+	options := &slog.HandlerOptions{Level: settings.level, ReplaceAttr: replaceLevelName}
+	if settings.format == LogFormatJSON {
+		return slog.NewJSONHandler(output, options)
+	}
+
+	return slog.NewTextHandler(output, options)
+}
+
+// rotatingFile is a log file that is renamed, and a new one started, once it gets too big or too old.
+// Only the most recent rotated files are kept.
+type rotatingFile struct {
+	mutex    sync.Mutex
+	settings logFileSettings
+	file     *os.File
+	size     int64
+	started  time.Time
+}
+
+// openRotatingFile opens the log file to add to it, rotating it first if it is already too big or too old.
+func openRotatingFile(settings logFileSettings) (*rotatingFile, error) {
+	err := os.MkdirAll(filepath.Dir(settings.path), folderPermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	rotating := &rotatingFile{settings: settings}
+	err = rotating.open()
+	if err != nil {
+		return nil, err
+	}
+	if rotating.needsRotating(0, time.Now()) {
+		err = rotating.rotate()
+	}
+
+	return rotating, err
+}
+
+// open opens the log file for appending, working out when it was started from its first line.
+func (rotating *rotatingFile) open() error {
+	file, err := os.OpenFile(rotating.settings.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rotating.file = file
+	rotating.size = info.Size()
+	rotating.started = time.Now()
+	if info.Size() > 0 {
+		rotating.started = logFileStarted(rotating.settings.path, info.ModTime())
+	}
+
+	return nil
+}
+
+// logFileStartTime finds the time of the first message in a text or JSON log file.
+var logFileStartTime = regexp.MustCompile(`\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:\d\d)`)
+
+// logFileStarted returns when the log file was started, from the time of its first message,
+// or the given time if it cannot be found.
+func logFileStarted(filename string, defaultTime time.Time) time.Time {
+	file, err := os.Open(filename)
+	if err != nil {
+		return defaultTime
+	}
+	defer file.Close()
+
+	firstLine, _ := bufio.NewReader(file).ReadString('\n')
+	started, err := time.Parse(time.RFC3339Nano, logFileStartTime.FindString(firstLine))
+	if err != nil {
+		return defaultTime
+	}
+
+	return started
+}
+
+// Write adds to the log file, rotating it first if the message would make it too big, or it is too old.
+func (rotating *rotatingFile) Write(contents []byte) (int, error) {
+	rotating.mutex.Lock()
+	defer rotating.mutex.Unlock()
+
+	if rotating.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if rotating.needsRotating(int64(len(contents)), time.Now()) {
+		err := rotating.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	written, err := rotating.file.Write(contents)
+	rotating.size += int64(written)
+
+	return written, err
+}
+
+// needsRotating checks if the log file is too old, or would be too big once the given number of bytes are added.
+// A file that is empty is never rotated.
+func (rotating *rotatingFile) needsRotating(adding int64, now time.Time) bool {
+	if rotating.size == 0 {
+		return false
+	}
+
+	return rotating.settings.maxSize > 0 && rotating.size+adding > rotating.settings.maxSize ||
+		rotating.settings.maxAge > 0 && now.Sub(rotating.started) >= rotating.settings.maxAge
+}
+
+// rotate renames the log file after the time it was rotated, starts a new one,
+// and removes the oldest rotated files beyond the number to keep.
+func (rotating *rotatingFile) rotate() error {
+	rotating.file.Close()
+	rotating.file = nil
+
+	extension := filepath.Ext(rotating.settings.path)
+	base := strings.TrimSuffix(rotating.settings.path, extension)
+	rotated := time.Now()
+	rotatedName := fmt.Sprintf("%s-%s%s", base, rotated.Format(logFileTimeFormat), extension)
+	for {
+		if _, err := os.Stat(rotatedName); err != nil {
+			break
+		}
+		// another file was rotated in the same millisecond, so move this one on to keep the names in order
+		rotated = rotated.Add(time.Millisecond)
+		rotatedName = fmt.Sprintf("%s-%s%s", base, rotated.Format(logFileTimeFormat), extension)
+	}
+
+	err := os.Rename(rotating.settings.path, rotatedName)
+	if err == nil {
+		rotating.removeOldFiles(base, extension)
+	}
+
+	// when the file could not be renamed, keep adding to it rather than losing the messages, and try again next time
+	return rotating.open()
+}
+
+// removeOldFiles removes the oldest rotated log files, beyond the number to keep.
+func (rotating *rotatingFile) removeOldFiles(base string, extension string) {
+	rotatedFiles, err := filepath.Glob(base + "-*" + extension)
+	if err != nil {
+		return
+	}
+
+	prefixLength := len(base) + 1
+	var rotated []string
+	for _, rotatedFile := range rotatedFiles {
+		if _, err := time.Parse(logFileTimeFormat, strings.TrimSuffix(rotatedFile[prefixLength:], extension)); err == nil {
+			rotated = append(rotated, rotatedFile)
+		}
+	}
+	sort.Strings(rotated)
+
+	for len(rotated) > rotating.settings.keep {
+		os.Remove(rotated[0])
+		rotated = rotated[1:]
+	}
+}
+
+// Close closes the log file.
+func (rotating *rotatingFile) Close() error {
+	rotating.mutex.Lock()
+	defer rotating.mutex.Unlock()
+
+	if rotating.file == nil {
+		return nil
+	}
+
+	err := rotating.file.Close()
+	rotating.file = nil
+
+	return err
+}
@@ -0,0 +1,154 @@
+package copylib
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewLogFileSettingsSuccess(t *testing.T) {
+	t.Parallel()
+
+	settings, err := newLogFileSettings(map[string]interface{}{
+		"File":     "/var/log/go-copy.log",
+		"level":    "debug",
+		"format":   "json",
+		"max_size": "1.5MB",
+		"max_age":  "24h",
+		"keep":     2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error reading the log settings: %s", err)
+	}
+
+	expected := logFileSettings{path: "/var/log/go-copy.log", level: slog.LevelDebug, format: LogFormatJSON, maxSize: 3 << 19, maxAge: 24 * time.Hour, keep: 2}
+	if settings != expected {
+		t.Errorf("expected the log settings to be %+v, but got %+v", expected, settings)
+	}
+
+	settings, err = newLogFileSettings(nil)
+	if err != nil || settings.maxSize != defaultLogFileMaxSize || settings.keep != defaultLogFileKeep || settings.level != slog.LevelInfo {
+		t.Errorf("expected the default log settings without a log section, but got %+v: %v", settings, err)
+	}
+
+	for text, size := range map[interface{}]int64{"512": 512, "512KB": 512 << 10, "2 GiB": 2 << 30, "10m": 10 << 20, 0: 0} {
+		parsed, err := parseSize(text)
+		if err != nil || parsed != size {
+			t.Errorf("expected %v to be %d bytes, but got %d: %v", text, size, parsed, err)
+		}
+	}
+}
+
+func TestNewLogFileSettingsFailure(t *testing.T) {
+	t.Parallel()
+
+	for _, setting := range []interface{}{
+		"go-copy.log",
+		map[string]interface{}{"level": "loud"},
+		map[string]interface{}{"format": "xml"},
+		map[string]interface{}{"max_size": "big"},
+		map[string]interface{}{"max_age": "a week"},
+		map[string]interface{}{"keep": -1},
+		map[string]interface{}{"rotate": true},
+	} {
+		_, err := newLogFileSettings(setting)
+		if err == nil {
+			t.Errorf("expected %v to be invalid log settings", setting)
+		}
+	}
+}
+
+func TestLogSectionIsOperationFailure(t *testing.T) {
+	t.Parallel()
+
+	// a backup of a logs folder called "log" clashes with the log settings, so it must not be dropped quietly
+	operation := map[string]interface{}{
+		"Name":         "Logs",
+		"source":       "/var/log",
+		"destinations": []interface{}{"/backups/log"},
+		"replace":      "skip",
+	}
+	_, err := newLogFileSettings(operation)
+	if !errors.Is(err, ErrLogSectionIsOperation) {
+		t.Errorf("expected an operation called log to clash with the log settings, but got: %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "go-copy-config.yaml")
+	contents := "log:\n  name: Logs\n  source: /var/log\n  destinations:\n    - /backups/log\n  replace: skip\n"
+	err = os.WriteFile(filename, []byte(contents), 0644)
+	if err != nil {
+		t.Fatalf("unable to create the config file: %s", err)
+	}
+	_, err = LoadConfig(filename)
+	if !errors.Is(err, ErrLogSectionIsOperation) {
+		t.Errorf("expected loading a config with an operation called log to fail, but got: %v", err)
+	}
+
+	err = checkLogSection(map[string]interface{}{"file": "/var/log/go-copy.log", "level": "debug"})
+	if err != nil {
+		t.Errorf("unexpected error for log settings that are not an operation: %s", err)
+	}
+}
+
+func TestRotatingFileSuccess(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	filename := filepath.Join(folder, "go-copy.log")
+	file, err := openRotatingFile(logFileSettings{path: filename, maxSize: 100, keep: 2})
+	if err != nil {
+		t.Fatalf("unexpected error opening the log file: %s", err)
+	}
+	defer file.Close()
+
+	line := strings.Repeat("x", 39) + "\n"
+	for range 10 {
+		_, err = file.Write([]byte(line))
+		if err != nil {
+			t.Fatalf("unexpected error writing to the log file: %s", err)
+		}
+	}
+
+	contents, err := os.ReadFile(filename)
+	if err != nil || len(contents) != 2*len(line) {
+		t.Errorf("expected the log file to have been rotated before it grew beyond 100 bytes, but it has %d: %v", len(contents), err)
+	}
+
+	rotated, _ := filepath.Glob(filepath.Join(folder, "go-copy-*.log"))
+	if len(rotated) != 2 {
+		t.Errorf("expected only the 2 most recent rotated files to be kept, but found %v", rotated)
+	}
+}
+
+func TestRotatingFileAgeSuccess(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	filename := filepath.Join(folder, "go-copy.log")
+	started := time.Now().Add(-25 * time.Hour).Format(time.RFC3339Nano)
+	err := os.WriteFile(filename, []byte(fmt.Sprintf("time=%s level=INFO msg=started\n", started)), 0644)
+	if err != nil {
+		t.Fatalf("error writing the log file: %s", err)
+	}
+
+	file, err := openRotatingFile(logFileSettings{path: filename, maxAge: 24 * time.Hour, keep: 5})
+	if err != nil {
+		t.Fatalf("unexpected error opening the log file: %s", err)
+	}
+	defer file.Close()
+
+	info, err := os.Stat(filename)
+	if err != nil || info.Size() != 0 {
+		t.Errorf("expected a log file started more than a day ago to be rotated when it is opened")
+	}
+
+	rotated, _ := filepath.Glob(filepath.Join(folder, "go-copy-*.log"))
+	if len(rotated) != 1 {
+		t.Errorf("expected the old log file to be kept, but found %v", rotated)
+	}
+}
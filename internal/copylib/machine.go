@@ -0,0 +1,142 @@
+package copylib
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// defaultOSKey is used in a setting with a variant per OS, for every OS without its own variant.
+const defaultOSKey = "default"
+
+// knownOperatingSystems are the OS names, as Go reports them, that can be used to select operations and paths.
+var knownOperatingSystems = []string{
+	"aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "ios", "linux",
+	"netbsd", "openbsd", "plan9", "solaris", "windows",
+}
+
+// machineSelector limits an operation to the machines it belongs to.
+type machineSelector struct {
+	hosts            []string
+	operatingSystems []string
+	missingForOS     bool
+}
+
+// newMachineSelector reads the "hosts" and "os" settings of an operation.
+func newMachineSelector(settings map[string]interface{}) (machineSelector, error) {
+	var selector machineSelector
+	var err error
+
+	if hosts, ok := settings["hosts"]; ok {
+		selector.hosts, err = getStringList(hosts)
+		if err != nil {
+			return selector, fmt.Errorf("\"hosts\" %s", err)
+		}
+		for _, host := range selector.hosts {
+			if _, err := path.Match(strings.ToLower(host), ""); err != nil {
+				return selector, fmt.Errorf("the host pattern \"%s\" is not valid", host)
+			}
+		}
+	}
+
+	if operatingSystems, ok := settings["os"]; ok {
+		selector.operatingSystems, err = getStringList(operatingSystems)
+		if err != nil {
+			return selector, fmt.Errorf("\"os\" %s", err)
+		}
+		for _, operatingSystem := range selector.operatingSystems {
+			if !isKnownOperatingSystem(operatingSystem) {
+				return selector, fmt.Errorf("\"%s\" is not a known OS; expected one of %s", operatingSystem, strings.Join(knownOperatingSystems, ", "))
+			}
+		}
+	}
+
+	return selector, nil
+}
+
+// appliesToThisMachine reports whether the operation should run on this machine, and if not, why not.
+// The hostname function returns the name of this machine, which is usually os.Hostname.
+func (selector *machineSelector) appliesToThisMachine(hostname func() (string, error)) (bool, string) {
+	if len(selector.operatingSystems) > 0 && !containsFold(selector.operatingSystems, runtime.GOOS) {
+		return false, fmt.Sprintf("it only runs on %s", strings.Join(selector.operatingSystems, ", "))
+	}
+
+	if selector.missingForOS {
+		return false, fmt.Sprintf("it has no source or destinations for %s", runtime.GOOS)
+	}
+
+	if len(selector.hosts) > 0 {
+		host, err := hostname()
+		if err != nil {
+			return false, fmt.Sprintf("the name of this host could not be found: %s", err)
+		}
+		if !matchesHost(selector.hosts, host) {
+			return false, fmt.Sprintf("it only runs on the hosts %s", strings.Join(selector.hosts, ", "))
+		}
+	}
+
+	return true, ""
+}
+
+// matchesHost reports whether the hostname, or its short form without the domain, matches one of the host patterns.
+func matchesHost(hosts []string, hostname string) bool {
+	hostname = strings.ToLower(hostname)
+	shortName, _, _ := strings.Cut(hostname, ".")
+
+	for _, host := range hosts {
+		pattern := strings.ToLower(host)
+		if matched, _ := path.Match(pattern, hostname); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, shortName); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getOSVariants splits a setting that has a variant per OS into those variants.
+// A setting that is not split by OS is returned as the variant for every OS.
+func getOSVariants(setting interface{}) map[string]interface{} {
+	variants, ok := setting.(map[string]interface{})
+	if !ok || len(variants) == 0 {
+		return map[string]interface{}{defaultOSKey: setting}
+	}
+
+	for key := range variants {
+		if key != defaultOSKey && !isKnownOperatingSystem(key) {
+			// this is not split by OS, it is a mapping in its own right
+			return map[string]interface{}{defaultOSKey: setting}
+		}
+	}
+
+	return lowerCaseKeys(variants)
+}
+
+// selectOSVariant returns the variant for this OS, falling back to the default variant.
+func selectOSVariant(variants map[string]interface{}) (interface{}, bool) {
+	if value, ok := variants[runtime.GOOS]; ok {
+		return value, true
+	}
+
+	value, ok := variants[defaultOSKey]
+	return value, ok
+}
+
+// isKnownOperatingSystem reports whether the name is one of the OS names Go uses.
+func isKnownOperatingSystem(name string) bool {
+	return containsFold(knownOperatingSystems, name)
+}
+
+// containsFold reports whether the value is in the list, ignoring case.
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,302 @@
+package copylib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// manifestFilename is the manifest kept at the root of each destination of an operation that uses one.
+	// It is never copied from a source, so a destination can be the source of another operation.
+	manifestFilename = ".go-copy-manifest.json"
+	// manifestVersion is increased whenever the manifest changes in a way older versions cannot read
+	manifestVersion = 1
+)
+
+// manifestSettings are the "manifest" setting of an operation.
+type manifestSettings struct {
+	enabled bool
+	// hash adds the SHA-256 of each file to the manifest, worked out as the file is copied
+	hash bool
+}
+
+// newManifestSettings reads the "manifest" setting of an operation, which is either true or false,
+// or a mapping with "hash", which turns the manifest on.
+func newManifestSettings(setting interface{}) (manifestSettings, error) {
+	switch value := setting.(type) {
+	case bool:
+		return manifestSettings{enabled: value}, nil
+	case map[string]interface{}:
+		settings := manifestSettings{enabled: true}
+		for key, option := range lowerCaseKeys(value) {
+			switch key {
+			case "hash":
+				hash, ok := option.(bool)
+				if !ok {
+					return settings, fmt.Errorf("\"hash\" must be true or false")
+				}
+				settings.hash = hash
+			default:
+				return settings, fmt.Errorf("has an unknown setting \"%s\"", key)
+			}
+		}
+		return settings, nil
+	}
+
+	return manifestSettings{}, fmt.Errorf("must be true, false, or a mapping with \"hash\"")
+}
+
+// manifestEntry is what the manifest knows about a file at the destination.
+type manifestEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Hash    string    `json:"sha256,omitempty"`
+}
+
+// destinationManifest lists the files at a destination, keyed by their path relative to the destination,
+// so deciding whether to skip a file does not need to look at the destination at all.
+type destinationManifest struct {
+	Version int                      `json:"version"`
+	Files   map[string]manifestEntry `json:"files"`
+
+	// changed is set once the manifest no longer matches the file at the destination
+	changed bool
+}
+
+// manifestFileInfo describes a file at a destination using its manifest entry, in place of looking it up.
+type manifestFileInfo struct {
+	name  string
+	entry manifestEntry
+}
+
+func (info manifestFileInfo) Name() string       { return info.name }
+func (info manifestFileInfo) Size() int64        { return info.entry.Size }
+func (info manifestFileInfo) Mode() fs.FileMode  { return 0644 }
+func (info manifestFileInfo) ModTime() time.Time { return info.entry.ModTime }
+func (info manifestFileInfo) IsDir() bool        { return false }
+func (info manifestFileInfo) Sys() interface{}   { return nil }
+
+// isManifestFile checks if the path, relative to the root of a source or destination, is a manifest.
+func isManifestFile(relativePath string) bool {
+	return relativePath == manifestFilename
+}
+
+// loadManifests loads the manifest of each destination, or rebuilds it from the files at the destination when
+// rescan is set. A destination without a manifest, or with one that cannot be read, starts with an empty one,
+// which is filled in as each file is looked up.
+func (fileCopier *fileCopier) loadManifests() {
+	fileCopier.manifests = make(map[*destination]*destinationManifest)
+
+	for _, dest := range fileCopier.destinations {
+		if fileCopier.rescan {
+			fileCopier.logger.info(fmt.Sprintf("rebuilding the manifest of destination %s from the files in it", dest.displayName()),
+				"destination", dest.displayName())
+			fileCopier.manifests[dest] = fileCopier.scanManifest(dest)
+			continue
+		}
+
+		manifest, err := readManifest(fileCopier.destination, path.Join(dest.path, manifestFilename))
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				fileCopier.logger.warning(fmt.Sprintf("the manifest of destination %s could not be read, so it will be rebuilt: %s", dest.displayName(), err),
+					"destination", dest.displayName(), "error", err)
+				fileCopier.stats.NumberOfWarnings++
+			}
+			manifest = &destinationManifest{Version: manifestVersion, Files: make(map[string]manifestEntry), changed: true}
+		}
+		fileCopier.manifests[dest] = manifest
+	}
+}
+
+// readManifest reads a manifest, failing if it was written by a version of go-copy that used a different format.
+func readManifest(filesystem SourceFilesystem, filename string) (*destinationManifest, error) {
+	file, err := filesystem.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var manifest destinationManifest
+	err = json.NewDecoder(file).Decode(&manifest)
+	if err != nil {
+		return nil, err
+	} else if manifest.Version != manifestVersion {
+		return nil, fmt.Errorf("it has version %d, but version %d is expected", manifest.Version, manifestVersion)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]manifestEntry)
+	}
+
+	return &manifest, nil
+}
+
+// scanManifest builds a manifest from the files at the destination, hashing them if the manifest keeps hashes.
+func (fileCopier *fileCopier) scanManifest(dest *destination) *destinationManifest {
+	manifest := &destinationManifest{Version: manifestVersion, Files: make(map[string]manifestEntry), changed: true}
+
+	var scanFolder func(relativeFolder string)
+	scanFolder = func(relativeFolder string) {
+		folder := path.Join(dest.path, relativeFolder)
+		entries, err := fileCopier.destination.ReadDir(folder)
+		if err != nil {
+			fileCopier.logger.warning(fmt.Sprintf("unable to read %s while rebuilding the manifest: %s", folder, err),
+				"file", relativeFolder, "destination", dest.displayName(), "error", err)
+			fileCopier.stats.NumberOfWarnings++
+			return
+		}
+
+		for _, entry := range entries {
+			if fileCopier.ctx.Err() != nil {
+				return
+			}
+
+			relativePath := path.Join(relativeFolder, entry.Name())
+			if entry.IsDir() {
+				scanFolder(relativePath)
+				continue
+			} else if !entry.Type().IsRegular() || isManifestFile(relativePath) || strings.HasSuffix(relativePath, partialFileSuffix) {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			manifestEntry := manifestEntry{Size: info.Size(), ModTime: info.ModTime()}
+			if fileCopier.config.manifest.hash {
+				manifestEntry.Hash, err = hashFile(fileCopier.destination, path.Join(folder, entry.Name()))
+				if err != nil {
+					fileCopier.logger.warning(fmt.Sprintf("unable to hash %s while rebuilding the manifest: %s", relativePath, err),
+						"file", relativePath, "destination", dest.displayName(), "error", err)
+					fileCopier.stats.NumberOfWarnings++
+				}
+			}
+			manifest.Files[relativePath] = manifestEntry
+		}
+	}
+	scanFolder("")
+
+	return manifest
+}
+
+// hashFile returns the SHA-256 of the file, in hex.
+func hashFile(filesystem SourceFilesystem, filename string) (string, error) {
+	file, err := filesystem.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// manifestFor returns the manifest of the destination, or nil if the operation does not use manifests.
+func (fileCopier *fileCopier) manifestFor(dest *destination) *destinationManifest {
+	return fileCopier.manifests[dest]
+}
+
+// lookUp returns the details of a file at the destination from the manifest, if it is in it.
+func (manifest *destinationManifest) lookUp(relativePath string) (fs.FileInfo, bool) {
+	if manifest == nil {
+		return nil, false
+	}
+
+	entry, ok := manifest.Files[relativePath]
+	if !ok {
+		return nil, false
+	}
+
+	return manifestFileInfo{name: path.Base(relativePath), entry: entry}, true
+}
+
+// record notes the details of a file at the destination. The hash is kept when the file has not changed,
+// and dropped when it has but no new hash is given.
+func (manifest *destinationManifest) record(relativePath string, size int64, modTime time.Time, hash string) {
+	if manifest == nil {
+		return
+	}
+
+	previous, ok := manifest.Files[relativePath]
+	if ok && previous.Size == size && previous.ModTime.Equal(modTime) && (len(hash) == 0 || hash == previous.Hash) {
+		// the file has not changed, so the hash it had, if any, still applies
+		return
+	}
+
+	manifest.Files[relativePath] = manifestEntry{Size: size, ModTime: modTime, Hash: hash}
+	manifest.changed = true
+}
+
+// forget drops a file whose details at the destination are no longer known, so it is looked up next time.
+func (manifest *destinationManifest) forget(relativePath string) {
+	if manifest == nil {
+		return
+	}
+
+	delete(manifest.Files, relativePath)
+	manifest.changed = true
+}
+
+// saveManifests writes the manifest of each destination that changed during the run, even if it was interrupted,
+// as the manifest only lists the files the run knows are at the destination.
+func (fileCopier *fileCopier) saveManifests() {
+	for _, dest := range fileCopier.destinations {
+		manifest := fileCopier.manifests[dest]
+		if manifest == nil || !manifest.changed {
+			continue
+		}
+
+		err := writeManifest(fileCopier.destination, path.Join(dest.path, manifestFilename), manifest)
+		if err != nil {
+			fileCopier.logger.warning(fmt.Sprintf("unable to save the manifest of destination %s, so the next run will look up its files: %s", dest.displayName(), err),
+				"destination", dest.displayName(), "error", err)
+			fileCopier.stats.NumberOfWarnings++
+		}
+	}
+}
+
+// writeManifest writes the manifest to a partial file first, so an interrupted write never leaves a truncated manifest.
+func writeManifest(filesystem Filesystem, filename string, manifest *destinationManifest) error {
+	contents, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	partialFilename := filename + partialFileSuffix
+	file, err := filesystem.Create(partialFilename)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(contents)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = filesystem.Rename(partialFilename, filename)
+	}
+	if err != nil {
+		filesystem.Remove(partialFilename)
+		return err
+	}
+
+	manifest.changed = false
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package copylib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// statCountingFilesystem counts the files looked up at the destinations.
+type statCountingFilesystem struct {
+	*MemoryFilesystem
+	mutex sync.Mutex
+	stats int
+}
+
+func (filesystem *statCountingFilesystem) Stat(name string) (fs.FileInfo, error) {
+	if strings.HasPrefix(name, "/backups/") && path.Ext(name) == ".txt" {
+		filesystem.mutex.Lock()
+		filesystem.stats++
+		filesystem.mutex.Unlock()
+	}
+
+	return filesystem.MemoryFilesystem.Stat(name)
+}
+
+func TestCopyWithManifestSuccess(t *testing.T) {
+	t.Parallel()
+
+	filesystem := &statCountingFilesystem{MemoryFilesystem: newTestFilesystem(t, false)}
+	writeTestFile(t, filesystem.MemoryFilesystem, path.Join(testSource, manifestFilename), 10)
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.manifest = manifestSettings{enabled: true, hash: true}
+
+	newTestRunner(config, filesystem).Copy(context.Background())
+
+	hash := sha256.Sum256([]byte(strings.Repeat("x", 8600)))
+	for _, destPath := range testDestinationPaths {
+		manifest, err := readManifest(filesystem, path.Join(destPath, manifestFilename))
+		if err != nil {
+			t.Fatalf("expected a manifest to be written to %s: %s", destPath, err)
+		}
+		if len(manifest.Files) != 3 {
+			t.Errorf("expected the manifest of %s to list the 3 files copied, but it has %d", destPath, len(manifest.Files))
+		}
+		if manifest.Files["foobar001.txt"].Hash != hex.EncodeToString(hash[:]) {
+			t.Errorf("expected the manifest of %s to have the hash of foobar001.txt", destPath)
+		}
+	}
+
+	// the files are skipped using the manifests, without looking them up at the destinations
+	filesystem.stats = 0
+	runner := newTestRunner(config, filesystem)
+	runner.Copy(context.Background())
+
+	if runner.Stats.TotalFilesSkipped != 9 || runner.Stats.TotalFilesCopied != 0 {
+		t.Errorf("expected 9 files to be skipped, but %d were skipped and %d copied", runner.Stats.TotalFilesSkipped, runner.Stats.TotalFilesCopied)
+	}
+	if filesystem.stats != 0 {
+		t.Errorf("expected no files to be looked up at the destinations, but %d were", filesystem.stats)
+	}
+
+	// a file removed behind go-copy's back is only noticed once the manifests are rebuilt
+	err := filesystem.Remove(path.Join(testDestinationPaths[0], "foobar002.txt"))
+	if err != nil {
+		t.Fatalf("error removing the copied file: %s", err)
+	}
+
+	runner = newTestRunner(config, filesystem)
+	runner.Copy(context.Background())
+	if runner.Stats.TotalFilesCopied != 0 {
+		t.Errorf("expected the manifest to be trusted, but %d files were copied", runner.Stats.TotalFilesCopied)
+	}
+
+	runner = newTestRunner(config, filesystem)
+	WithRescan()(runner)
+	runner.Copy(context.Background())
+	if runner.Stats.TotalFilesCopied != 1 || runner.Stats.TotalFilesSkipped != 8 {
+		t.Errorf("expected the removed file to be copied again after a rescan, but %d were copied and %d skipped",
+			runner.Stats.TotalFilesCopied, runner.Stats.TotalFilesSkipped)
+	}
+	checkTestFileCopied(t, filesystem.MemoryFilesystem, "foobar002.txt", testDestinationPaths[0])
+}
+
+func TestNewManifestSettingsSuccess(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		setting  interface{}
+		expected manifestSettings
+	}{
+		{true, manifestSettings{enabled: true}},
+		{false, manifestSettings{}},
+		{map[string]interface{}{"Hash": true}, manifestSettings{enabled: true, hash: true}},
+	}
+
+	for _, test := range tests {
+		settings, err := newManifestSettings(test.setting)
+		if err != nil {
+			t.Errorf("unexpected error reading %v: %s", test.setting, err)
+		} else if settings != test.expected {
+			t.Errorf("expected %v to be read as %+v, but got %+v", test.setting, test.expected, settings)
+		}
+	}
+}
+
+func TestNewManifestSettingsFailure(t *testing.T) {
+	t.Parallel()
+
+	for _, setting := range []interface{}{"yes", 1, map[string]interface{}{"hash": "yes"}, map[string]interface{}{"size": true}} {
+		_, err := newManifestSettings(setting)
+		if err == nil {
+			t.Errorf("expected %v to be an invalid manifest setting", setting)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package copylib
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errNotDirectory = errors.New("not a directory")
+var errIsDirectory = errors.New("is a directory")
+var errDirectoryNotEmpty = errors.New("directory not empty")
+
+// MemoryFilesystem is a Filesystem held entirely in memory. It behaves like the filesystem of the operating system:
+// files must be created in folders that exist, open files see later writes, and errors wrap the fs errors, such as
+// fs.ErrNotExist. It is safe to use from several goroutines, so each test can have its own.
+// Paths use forward slashes, and relative paths are relative to the root folder.
+type MemoryFilesystem struct {
+	mutex sync.Mutex
+	nodes map[string]*memoryNode
+}
+
+// memoryNode is a file or folder in a MemoryFilesystem.
+type memoryNode struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+}
+
+// NewMemoryFilesystem creates an empty MemoryFilesystem, holding only the root folder.
+func NewMemoryFilesystem() *MemoryFilesystem {
+	return &MemoryFilesystem{
+		nodes: map[string]*memoryNode{
+			"/": {name: "/", mode: fs.ModeDir | 0755, modTime: time.Now()},
+		},
+	}
+}
+
+// cleanMemoryPath returns the path of the node with the given name.
+func cleanMemoryPath(name string) string {
+	return path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+}
+
+func (filesystem *MemoryFilesystem) Stat(name string) (fs.FileInfo, error) {
+	filesystem.mutex.Lock()
+	defer filesystem.mutex.Unlock()
+
+	node, ok := filesystem.nodes[cleanMemoryPath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return node.info(), nil
+}
+
+func (filesystem *MemoryFilesystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	filesystem.mutex.Lock()
+	defer filesystem.mutex.Unlock()
+
+	folderPath := cleanMemoryPath(name)
+	node, ok := filesystem.nodes[folderPath]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	} else if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDirectory}
+	}
+
+	var entries []fs.DirEntry
+	for nodePath, child := range filesystem.nodes {
+		if nodePath != folderPath && path.Dir(nodePath) == folderPath {
+			entries = append(entries, fs.FileInfoToDirEntry(child.info()))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+func (filesystem *MemoryFilesystem) Open(name string) (File, error) {
+	filesystem.mutex.Lock()
+	defer filesystem.mutex.Unlock()
+
+	node, ok := filesystem.nodes[cleanMemoryPath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	} else if node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDirectory}
+	}
+
+	return &memoryFile{filesystem: filesystem, node: node, name: name}, nil
+}
+
+// Create creates the file, or truncates it if it already exists, and opens it for writing.
+func (filesystem *MemoryFilesystem) Create(name string) (File, error) {
+	filesystem.mutex.Lock()
+	defer filesystem.mutex.Unlock()
+
+	node, err := filesystem.createFile("open", name, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memoryFile{filesystem: filesystem, node: node, name: name, writable: true}, nil
+}
+
+func (filesystem *MemoryFilesystem) MkdirAll(name string, perm fs.FileMode) error {
+	filesystem.mutex.Lock()
+	defer filesystem.mutex.Unlock()
+
+	folderPath := cleanMemoryPath(name)
+	var missing []string
+	for ; folderPath != "/"; folderPath = path.Dir(folderPath) {
+		node, ok := filesystem.nodes[folderPath]
+		if ok {
+			if !node.mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: name, Err: errNotDirectory}
+			}
+			break
+		}
+		missing = append(missing, folderPath)
+	}
+
+	for _, folderPath := range missing {
+		filesystem.nodes[folderPath] = &memoryNode{name: path.Base(folderPath), mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	}
+
+	return nil
+}
+
+// Rename moves the file or folder, replacing any file already at the new name.
+func (filesystem *MemoryFilesystem) Rename(oldName string, newName string) error {
+	filesystem.mutex.Lock()
+	defer filesystem.mutex.Unlock()
+
+	oldPath := cleanMemoryPath(oldName)
+	newPath := cleanMemoryPath(newName)
+
+	node, ok := filesystem.nodes[oldPath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: fs.ErrNotExist}
+	}
+	err := filesystem.checkParent(newPath)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: err}
+	}
+	if existing, ok := filesystem.nodes[newPath]; ok && existing.mode.IsDir() && oldPath != newPath {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: fs.ErrExist}
+	}
+	if oldPath == newPath {
+		return nil
+	}
+
+	if node.mode.IsDir() {
+		if strings.HasPrefix(newPath, oldPath+"/") {
+			return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: fs.ErrInvalid}
+		}
+		for nodePath, child := range filesystem.nodes {
+			if strings.HasPrefix(nodePath, oldPath+"/") {
+				delete(filesystem.nodes, nodePath)
+				filesystem.nodes[newPath+strings.TrimPrefix(nodePath, oldPath)] = child
+			}
+		}
+	}
+
+	delete(filesystem.nodes, oldPath)
+	node.name = path.Base(newPath)
+	filesystem.nodes[newPath] = node
+
+	return nil
+}
+
+// Remove removes the file, or the folder if it is empty.
+func (filesystem *MemoryFilesystem) Remove(name string) error {
+	filesystem.mutex.Lock()
+	defer filesystem.mutex.Unlock()
+
+	nodePath := cleanMemoryPath(name)
+	node, ok := filesystem.nodes[nodePath]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	} else if nodePath == "/" {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+
+	if node.mode.IsDir() {
+		for childPath := range filesystem.nodes {
+			if strings.HasPrefix(childPath, nodePath+"/") {
+				return &fs.PathError{Op: "remove", Path: name, Err: errDirectoryNotEmpty}
+			}
+		}
+	}
+
+	delete(filesystem.nodes, nodePath)
+
+	return nil
+}
+
+func (filesystem *MemoryFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	filesystem.mutex.Lock()
+	defer filesystem.mutex.Unlock()
+
+	node, ok := filesystem.nodes[cleanMemoryPath(name)]
+	if !ok {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrNotExist}
+	}
+	node.modTime = mtime
+
+	return nil
+}
+
+// WriteFile writes the data to the file, creating it if needed, in the same way as os.WriteFile.
+func (filesystem *MemoryFilesystem) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	filesystem.mutex.Lock()
+	defer filesystem.mutex.Unlock()
+
+	node, err := filesystem.createFile("open", name, perm)
+	if err != nil {
+		return err
+	}
+	node.data = append([]byte(nil), data...)
+
+	return nil
+}
+
+// ReadFile returns the contents of the file, in the same way as os.ReadFile.
+func (filesystem *MemoryFilesystem) ReadFile(name string) ([]byte, error) {
+	file, err := filesystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+// createFile creates an empty file, or truncates the existing one. The caller must hold the mutex.
+func (filesystem *MemoryFilesystem) createFile(op string, name string, perm fs.FileMode) (*memoryNode, error) {
+	nodePath := cleanMemoryPath(name)
+
+	err := filesystem.checkParent(nodePath)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	node, ok := filesystem.nodes[nodePath]
+	if ok {
+		if node.mode.IsDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: errIsDirectory}
+		}
+		node.data = nil
+	} else {
+		node = &memoryNode{name: path.Base(nodePath), mode: perm.Perm()}
+		filesystem.nodes[nodePath] = node
+	}
+	node.modTime = time.Now()
+
+	return node, nil
+}
+
+// checkParent makes sure the folder the node goes in exists. The caller must hold the mutex.
+func (filesystem *MemoryFilesystem) checkParent(nodePath string) error {
+	parent, ok := filesystem.nodes[path.Dir(nodePath)]
+	if !ok {
+		return fs.ErrNotExist
+	} else if !parent.mode.IsDir() {
+		return errNotDirectory
+	}
+
+	return nil
+}
+
+// info returns a snapshot of the node, so it does not change as the file is written.
+func (node *memoryNode) info() fs.FileInfo {
+	return &memoryFileInfo{name: node.name, size: int64(len(node.data)), mode: node.mode, modTime: node.modTime}
+}
+
+type memoryFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (info *memoryFileInfo) Name() string {
+	return info.name
+}
+
+func (info *memoryFileInfo) Size() int64 {
+	return info.size
+}
+
+func (info *memoryFileInfo) Mode() fs.FileMode {
+	return info.mode
+}
+
+func (info *memoryFileInfo) ModTime() time.Time {
+	return info.modTime
+}
+
+func (info *memoryFileInfo) IsDir() bool {
+	return info.mode.IsDir()
+}
+
+func (info *memoryFileInfo) Sys() any {
+	return nil
+}
+
+// memoryFile is an open file in a MemoryFilesystem. Like a file handle of the OS, it keeps referring to the same
+// file when it is renamed or removed.
+type memoryFile struct {
+	filesystem *MemoryFilesystem
+	node       *memoryNode
+	name       string
+	offset     int
+	writable   bool
+	closed     bool
+}
+
+func (file *memoryFile) Read(buffer []byte) (int, error) {
+	file.filesystem.mutex.Lock()
+	defer file.filesystem.mutex.Unlock()
+
+	if file.closed {
+		return 0, &fs.PathError{Op: "read", Path: file.name, Err: fs.ErrClosed}
+	} else if file.writable {
+		return 0, &fs.PathError{Op: "read", Path: file.name, Err: fs.ErrPermission}
+	} else if file.offset >= len(file.node.data) {
+		return 0, io.EOF
+	}
+
+	count := copy(buffer, file.node.data[file.offset:])
+	file.offset += count
+
+	return count, nil
+}
+
+func (file *memoryFile) Write(buffer []byte) (int, error) {
+	file.filesystem.mutex.Lock()
+	defer file.filesystem.mutex.Unlock()
+
+	if file.closed {
+		return 0, &fs.PathError{Op: "write", Path: file.name, Err: fs.ErrClosed}
+	} else if !file.writable {
+		return 0, &fs.PathError{Op: "write", Path: file.name, Err: fs.ErrPermission}
+	}
+
+	file.node.data = append(file.node.data, buffer...)
+	file.node.modTime = time.Now()
+
+	return len(buffer), nil
+}
+
+func (file *memoryFile) Sync() error {
+	file.filesystem.mutex.Lock()
+	defer file.filesystem.mutex.Unlock()
+
+	if file.closed {
+		return &fs.PathError{Op: "sync", Path: file.name, Err: fs.ErrClosed}
+	}
+
+	return nil
+}
+
+func (file *memoryFile) Close() error {
+	file.filesystem.mutex.Lock()
+	defer file.filesystem.mutex.Unlock()
+
+	if file.closed {
+		return &fs.PathError{Op: "close", Path: file.name, Err: fs.ErrClosed}
+	}
+	file.closed = true
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package copylib
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+)
+
+func TestMemoryFilesystemCreateSuccess(t *testing.T) {
+	t.Parallel()
+
+	filesystem := NewMemoryFilesystem()
+
+	_, err := filesystem.Create("/missing/file.txt")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected creating a file in a missing folder to fail with fs.ErrNotExist, but got %v", err)
+	}
+
+	err = filesystem.MkdirAll("/saves/profiles", folderPermissions)
+	if err != nil {
+		t.Fatalf("unexpected error creating the folders: %s", err)
+	}
+
+	file, err := filesystem.Create("/saves/profiles/profile.sav")
+	if err != nil {
+		t.Fatalf("unexpected error creating the file: %s", err)
+	}
+	_, err = io.WriteString(file, "profile")
+	if err != nil {
+		t.Fatalf("unexpected error writing the file: %s", err)
+	}
+
+	// writes can be seen before the file is closed, as they can on disk
+	info, err := filesystem.Stat("saves/profiles/profile.sav")
+	if err != nil || info.Size() != 7 || info.IsDir() {
+		t.Errorf("expected a 7 byte file, but got %v, %v", info, err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		t.Errorf("unexpected error closing the file: %s", err)
+	}
+	_, err = file.Write([]byte("more"))
+	if !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("expected writing to a closed file to fail with fs.ErrClosed, but got %v", err)
+	}
+}
+
+func TestMemoryFilesystemReadDirSuccess(t *testing.T) {
+	t.Parallel()
+
+	filesystem := NewMemoryFilesystem()
+	writeTestFile(t, filesystem, "/saves/b.sav", 1)
+	writeTestFile(t, filesystem, "/saves/a.sav", 2)
+	writeTestFile(t, filesystem, "/saves/sub/c.sav", 3)
+
+	entries, err := filesystem.ReadDir("/saves")
+	if err != nil {
+		t.Fatalf("unexpected error reading the folder: %s", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(names) != 3 || names[0] != "a.sav" || names[1] != "b.sav" || names[2] != "sub" || !entries[2].IsDir() {
+		t.Errorf("expected a.sav, b.sav and the sub folder, sorted by name, but got %v", names)
+	}
+}
+
+func TestMemoryFilesystemRenameSuccess(t *testing.T) {
+	t.Parallel()
+
+	filesystem := NewMemoryFilesystem()
+	writeTestFile(t, filesystem, "/saves/new.sav", 3)
+	writeTestFile(t, filesystem, "/saves/old.sav", 10)
+
+	err := filesystem.Rename("/saves/new.sav", "/saves/old.sav")
+	if err != nil {
+		t.Fatalf("unexpected error renaming the file: %s", err)
+	}
+
+	_, err = filesystem.Stat("/saves/new.sav")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the old name to be gone, but got %v", err)
+	}
+	info, err := filesystem.Stat("/saves/old.sav")
+	if err != nil || info.Size() != 3 {
+		t.Errorf("expected the renamed file to replace the existing one, but got %v, %v", info, err)
+	}
+
+	err = filesystem.Rename("/saves", "/backups")
+	if err != nil {
+		t.Fatalf("unexpected error renaming the folder: %s", err)
+	}
+	contents, err := filesystem.ReadFile("/backups/old.sav")
+	if err != nil || len(contents) != 3 {
+		t.Errorf("expected the file to move with its folder, but got %q, %v", contents, err)
+	}
+}
+
+func TestMemoryFilesystemRemoveFailure(t *testing.T) {
+	t.Parallel()
+
+	filesystem := NewMemoryFilesystem()
+	writeTestFile(t, filesystem, "/saves/a.sav", 1)
+
+	err := filesystem.Remove("/saves")
+	if err == nil {
+		t.Errorf("expected removing a folder that is not empty to fail")
+	}
+
+	err = filesystem.Remove("/saves/missing.sav")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected removing a missing file to fail with fs.ErrNotExist, but got %v", err)
+	}
+
+	err = filesystem.Remove("/saves/a.sav")
+	if err == nil {
+		err = filesystem.Remove("/saves")
+	}
+	if err != nil {
+		t.Errorf("unexpected error removing the file and then its folder: %s", err)
+	}
+}
@@ -1,7 +1,18 @@
 package copylib
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+	"time"
+
 	"github.com/fatih/color"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
 )
 
 type LogMode int8
@@ -15,73 +26,399 @@ const (
 	LogVerbose
 )
 
-var currentLogMode = LogInfo
+// The formats go-copy can log in.
+const (
+	// LogFormatText is the human readable output, in color when writing to a terminal.
+	LogFormatText = "text"
+	// LogFormatJSON writes each message as a line of JSON, with fields such as the operation, file, destination,
+	// action and error, for log aggregation.
+	LogFormatJSON = "json"
+)
+
+// The slog levels of the messages go-copy logs, beyond the standard debug, info, warning and error.
+// Each kind of message has its own level, so the text output can show it in its own color,
+// and the levels are ordered so each LogMode shows what it always has.
+const (
+	// levelSimple is a message shown from LogSimple up
+	levelSimple = slog.LevelWarn + 1
+	// levelPrint is a message shown unless the output is silent
+	levelPrint = slog.LevelWarn + 2
+	// levelErrorHighlight is an error that stands out from the ones around it
+	levelErrorHighlight = slog.LevelError + 1
+	// levelAlways is a message shown even when the output is silent
+	levelAlways = slog.LevelError + 4
+)
+
+// level returns the lowest level of message shown at the logging mode.
+func (logMode LogMode) level() slog.Level {
+	switch {
+	case logMode <= LogSilent:
+		return slog.LevelError
+	case logMode == LogSimple:
+		return levelSimple
+	case logMode == LogWarning:
+		return slog.LevelWarn
+	case logMode == LogInfo:
+		return slog.LevelInfo
+	}
+
+	return slog.LevelDebug
+}
+
+// levelName returns the name of the level in JSON output, where go-copy's own levels use the standard names.
+func levelName(level slog.Level) string {
+	switch level {
+	case levelSimple, levelPrint, levelAlways:
+		return slog.LevelInfo.String()
+	case levelErrorHighlight:
+		return slog.LevelError.String()
+	}
+
+	return level.String()
+}
+
+// replaceLevelName is a slog ReplaceAttr function that gives go-copy's own levels their standard names.
+func replaceLevelName(groups []string, attr slog.Attr) slog.Attr {
+	if level, ok := attr.Value.Any().(slog.Level); ok && attr.Key == slog.LevelKey && len(groups) == 0 {
+		attr.Value = slog.StringValue(levelName(level))
+	}
+
+	return attr
+}
+
+// logger writes the output of go-copy at a given logging mode, through a slog handler for its format.
+// Each Runner has its own, so copies embedded in other programs do not share any logging state.
+type logger struct {
+	mode   LogMode
+	output io.Writer
+	format string
+	// args are added to every message, such as the operation being run
+	args []any
+	// console writes the messages shown by the logging mode to the output, in the format; it is built by setOutput
+	console slog.Handler
+	// file also writes each message to the log file, at its own level, when there is one
+	file   slog.Handler
+	closer io.Closer
+}
+
+// defaultLogger is used by the command line tool, and by the package level Print functions.
+var defaultLogger = newLogger(LogInfo, nil)
 
 func SetLogMode(logMode LogMode) {
 	// set the current logging mode
-	currentLogMode = logMode
+	defaultLogger.mode = logMode
 }
 
-func Print(formattedString string) {
-	if currentLogMode > LogSilent {
-		color.Green("%s%s", color.GreenString("go-copy: "), color.WhiteString(formattedString))
+// SetLogFormat sets the format of the command line tool's output: text or json.
+func SetLogFormat(format string) error {
+	err := checkLogFormat(format)
+	if err != nil {
+		return err
 	}
+
+	defaultLogger.setOutput(defaultLogger.output, format)
+
+	return nil
 }
 
-func PrintAlways(formattedString string) {
-	color.Green("%s%s", color.GreenString("go-copy: "), color.BlueString(formattedString))
+// checkLogFormat checks the format is one go-copy can log in.
+func checkLogFormat(format string) error {
+	switch format {
+	case LogFormatText, LogFormatJSON:
+		return nil
+	}
+
+	return fmt.Errorf("unknown log format \"%s\"; expected text or json", format)
 }
 
-func PrintBlankLine() {
-	color.Green("")
+// newLogger creates a logger at the given mode, writing text to the output, or to stdout if the output is nil.
+func newLogger(mode LogMode, output io.Writer) *logger {
+	logger := &logger{mode: mode}
+	logger.setOutput(output, LogFormatText)
+
+	return logger
 }
 
-func PrintVersionInfo(stringOne string, stringTwo string) {
-	color.Green("%s%s", color.CyanString(stringOne), color.MagentaString(stringTwo))
+// setOutput sets where the logger writes, or stdout if the output is nil, and in which format, and builds the
+// handler for them, so it is not built again for every message.
+func (logger *logger) setOutput(output io.Writer, format string) {
+	logger.output = output
+	logger.format = format
+
+	writer := output
+	if writer == nil {
+		writer = color.Output
+	}
+	if format == LogFormatJSON {
+		logger.console = slog.NewJSONHandler(writer, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: replaceLevelName})
+	} else {
+		logger.console = &textHandler{output: writer}
+	}
+}
+
+// with returns a copy of the logger that adds the args, as slog key and value pairs, to every message.
+func (logger *logger) with(args ...any) *logger {
+	withArgs := *logger
+	withArgs.args = append(append([]any{}, logger.args...), args...)
+
+	return &withArgs
+}
+
+// log writes the message, with the args as slog key and value pairs, if the logging mode shows its level,
+// and to the log file if its level includes it.
+func (logger *logger) log(level slog.Level, message string, args ...any) {
+	toConsole := level >= logger.mode.level()
+	toFile := logger.file != nil && logger.file.Enabled(context.Background(), level)
+	if !toConsole && !toFile {
+		return
+	}
+
+	record := slog.NewRecord(time.Now(), level, message, 0)
+	record.Add(logger.args...)
+	record.Add(args...)
+	if toConsole {
+		logger.console.Handle(context.Background(), record)
+	}
+	if toFile {
+		logger.file.Handle(context.Background(), record)
+	}
 }
 
-func PrintSimple(formattedString string) {
-	if currentLogMode >= LogSimple {
-		color.Yellow("%s%s", color.GreenString("go-copy: "), color.New(color.FgMagenta, color.Italic).Sprint(formattedString))
+// logToFile writes the message, with the args as slog key and value pairs, only to the log file, if there is one.
+// It is used for output that is shown on the console in another way, such as the stats table.
+func (logger *logger) logToFile(level slog.Level, message string, args ...any) {
+	if logger.file == nil || !logger.file.Enabled(context.Background(), level) {
+		return
 	}
+
+	record := slog.NewRecord(time.Now(), level, message, 0)
+	record.Add(logger.args...)
+	record.Add(args...)
+	logger.file.Handle(context.Background(), record)
+}
+
+// isJSON checks if the logger writes JSON, in which case there are no tables or blank lines.
+func (logger *logger) isJSON() bool {
+	return logger.format == LogFormatJSON
+}
+
+// logStats writes the stats of a run as a single record, with the totals and the stats of each destination.
+func (logger *logger) logStats(operationName string, runStats *Stats) {
+	logger.always("stats", "operation", operationName, "stats", runStats)
+}
+
+func (logger *logger) print(formattedString string, args ...any) {
+	logger.log(levelPrint, formattedString, args...)
+}
+
+func (logger *logger) always(formattedString string, args ...any) {
+	logger.log(levelAlways, formattedString, args...)
+}
+
+func (logger *logger) simple(formattedString string, args ...any) {
+	logger.log(levelSimple, formattedString, args...)
+}
+
+func (logger *logger) debug(formattedString string, args ...any) {
+	logger.log(slog.LevelDebug, formattedString, args...)
+}
+
+func (logger *logger) info(formattedString string, args ...any) {
+	logger.log(slog.LevelInfo, formattedString, args...)
+}
+
+func (logger *logger) warning(formattedString string, args ...any) {
+	logger.log(slog.LevelWarn, formattedString, args...)
+}
+
+func (logger *logger) error(formattedString string, args ...any) {
+	logger.log(slog.LevelError, formattedString, args...)
+}
+
+func (logger *logger) errorHighlight(formattedString string, args ...any) {
+	logger.log(levelErrorHighlight, formattedString, args...)
+}
+
+// textHandler is the slog handler for the human readable output: a line for each message, with a prefix and colors
+// that depend on its level. The attributes, such as the file, destination and error, are left out, as the messages
+// already say what they are about; they are only written by the JSON output, and by the log file in either format.
+type textHandler struct {
+	output io.Writer
 }
 
-func PrintDebug(formattedString string) {
-	if currentLogMode >= LogDebug {
-		color.Yellow("%s%s", color.GreenString("go-copy: DEBUG - "), color.New(color.FgBlue, color.Italic).Sprint(formattedString))
+func (handler *textHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (handler *textHandler) Handle(_ context.Context, record slog.Record) error {
+	var lineColor *color.Color
+	var line string
+
+	switch record.Level {
+	case levelAlways:
+		lineColor, line = color.New(color.FgGreen), color.GreenString("go-copy: ")+color.BlueString(record.Message)
+	case levelPrint:
+		lineColor, line = color.New(color.FgGreen), color.GreenString("go-copy: ")+color.WhiteString(record.Message)
+	case levelSimple:
+		lineColor, line = color.New(color.FgYellow), color.GreenString("go-copy: ")+color.New(color.FgMagenta, color.Italic).Sprint(record.Message)
+	case slog.LevelDebug:
+		lineColor, line = color.New(color.FgYellow), color.GreenString("go-copy: DEBUG - ")+color.New(color.FgBlue, color.Italic).Sprint(record.Message)
+	case slog.LevelInfo:
+		lineColor, line = color.New(color.FgYellow), color.WhiteString("go-copy: INFO - ")+color.New(color.FgCyan, color.Italic).Sprint(record.Message)
+	case slog.LevelWarn:
+		lineColor, line = color.New(color.FgYellow), color.YellowString("go-copy: WARNING - ")+color.New(color.FgMagenta, color.Italic).Sprint(record.Message)
+	case levelErrorHighlight:
+		lineColor, line = color.New(color.FgRed), color.RedString("go-copy: ERROR - ")+color.New(color.FgMagenta, color.Italic).Sprint(record.Message)
+	default:
+		lineColor, line = color.New(color.FgRed), color.RedString("go-copy: ERROR - ")+color.New(color.FgYellow, color.Italic).Sprint(record.Message)
 	}
+
+	_, err := lineColor.Fprintln(handler.output, line)
+
+	return err
 }
 
-func PrintInfo(formattedString string) {
-	if currentLogMode >= LogInfo {
-		color.Yellow("%s%s", color.WhiteString("go-copy: INFO - "), color.New(color.FgCyan, color.Italic).Sprint(formattedString))
+func (handler *textHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return handler
+}
+
+func (handler *textHandler) WithGroup(string) slog.Handler {
+	return handler
+}
+
+// The Print functions write to the command line tool's output. Those that take args add them,
+// as slog key and value pairs, to the message when the output is JSON, and to the log file.
+
+func Print(formattedString string, args ...any) {
+	defaultLogger.print(formattedString, args...)
+}
+
+func PrintAlways(formattedString string, args ...any) {
+	defaultLogger.always(formattedString, args...)
+}
+
+func PrintBlankLine() {
+	if defaultLogger.mode > LogSilent && !defaultLogger.isJSON() {
+		color.Green("")
 	}
 }
 
-func PrintWarning(formattedString string) {
-	if currentLogMode >= LogWarning {
-		color.Yellow("%s%s", color.YellowString("go-copy: WARNING - "), color.New(color.FgMagenta, color.Italic).Sprint(formattedString))
+func PrintVersionInfo(stringOne string, stringTwo string) {
+	if defaultLogger.isJSON() {
+		printValue(stringOne, stringTwo)
+		return
 	}
+
+	color.Green("%s%s", color.CyanString(stringOne), color.MagentaString(stringTwo))
+}
+
+func PrintSimple(formattedString string, args ...any) {
+	defaultLogger.simple(formattedString, args...)
+}
+
+func PrintDebug(formattedString string, args ...any) {
+	defaultLogger.debug(formattedString, args...)
 }
 
-func PrintError(formattedString string) {
-	color.Red("%s%s", color.RedString("go-copy: ERROR - "), color.New(color.FgYellow, color.Italic).Sprint(formattedString))
+func PrintInfo(formattedString string, args ...any) {
+	defaultLogger.info(formattedString, args...)
 }
 
-func PrintErrorHighlight(formattedString string) {
-	color.Red("%s%s", color.RedString("go-copy: ERROR - "), color.New(color.FgMagenta, color.Italic).Sprint(formattedString))
+func PrintWarning(formattedString string, args ...any) {
+	defaultLogger.warning(formattedString, args...)
+}
+
+func PrintError(formattedString string, args ...any) {
+	defaultLogger.error(formattedString, args...)
+}
+
+func PrintErrorHighlight(formattedString string, args ...any) {
+	defaultLogger.errorHighlight(formattedString, args...)
+}
+
+// PrintFileEvent displays what happened to a file at a destination, from an event of a run, such as the file being
+// copied or skipped. Other events are ignored.
+func PrintFileEvent(event Event) {
+	defaultLogger.with("operation", event.Operation).logFileEvent(event)
+}
+
+// printValue writes a labelled value as a JSON message, named after the label.
+func printValue(label string, value any) {
+	defaultLogger.always(strings.TrimSuffix(strings.TrimSpace(label), ":"), "value", value)
 }
 
 func PrintStats(stringOne string, stringTwo string) {
+	if defaultLogger.isJSON() {
+		printValue(stringOne, stringTwo)
+		return
+	}
+
 	color.Green("%s%s", color.GreenString(stringOne), color.MagentaString(stringTwo))
 }
 
+// PrintRunStats displays the stats of a finished run, with a table of the counts for each destination.
+// As JSON, they are a single message with the stats.
+func PrintRunStats(operationName string, runStats *Stats) {
+	if defaultLogger.isJSON() {
+		defaultLogger.logStats(operationName, runStats)
+		return
+	}
+	defaultLogger.logToFile(levelAlways, "stats", "operation", operationName, "stats", runStats)
+
+	printer := message.NewPrinter(language.English)
+
+	PrintColor(color.New(color.FgBlue, color.Bold), "\nStats:")
+	PrintStats("    Operation: ", operationName)
+	PrintStats("    Source Files: ", fmt.Sprintf("%d (%d failed)", runStats.NumberOfSourceFiles+runStats.NumberOfFailedFiles, runStats.NumberOfFailedFiles))
+	PrintStats("    Destinations: ", fmt.Sprintf("%d of %d online", runStats.NumberOfDestinations, len(runStats.Destinations)))
+	PrintStats("    Files Copied: ", fmt.Sprintf("%d", runStats.TotalFilesCopied))
+	PrintStats("    Files Skipped: ", fmt.Sprintf("%d", runStats.TotalFilesSkipped))
+	PrintStats("    Files Failed: ", fmt.Sprintf("%d", runStats.TotalFilesFailed))
+	PrintStats("    Retries: ", fmt.Sprintf("%d", runStats.TotalRetries))
+	PrintStats("    Bytes Copied: ", printer.Sprintf("%d", runStats.BytesCopied))
+	PrintStats("    Time to Copy: ", fmt.Sprintf("%f", runStats.TimeToCopy.Seconds()))
+	PrintStats("    Warnings: ", fmt.Sprintf("%d", runStats.NumberOfWarnings))
+	PrintStats("    Errors: ", fmt.Sprintf("%d", runStats.NumberOfErrors))
+	if runStats.Interrupted {
+		PrintStats("    Interrupted: ", "yes, these are the stats up to the interruption")
+	}
+
+	if len(runStats.Destinations) == 0 {
+		return
+	}
+
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "DESTINATION\tONLINE\tCOPIED\tSKIPPED\tFAILED\tRETRIES\tBYTES")
+	for _, destStats := range runStats.Destinations {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%d\t%d\t%s\n", destStats.Destination, yesNo(destStats.Online),
+			destStats.FilesCopied, destStats.FilesSkipped, destStats.FilesFailed, destStats.Retries,
+			printer.Sprintf("%d", destStats.BytesCopied))
+	}
+	writer.Flush()
+
+	PrintBlankLine()
+	for _, line := range strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n") {
+		PrintStats("    ", line)
+	}
+}
+
 func PrintKeyValue(stringOne string, stringTwo string) {
+	if defaultLogger.isJSON() {
+		printValue(stringOne, stringTwo)
+		return
+	}
+
 	color.New(color.FgBlue, color.Bold).Printf("%s", stringOne)
 	color.New(color.FgMagenta).Printf("%s\n", stringTwo)
 }
 
 func PrintKeyValueArray(stringOne string, stringArray []string) {
+	if defaultLogger.isJSON() {
+		printValue(stringOne, stringArray)
+		return
+	}
+
 	color.New(color.FgBlue, color.Bold).Printf("%s\n", stringOne)
 	for _, str := range stringArray {
 		color.New(color.FgMagenta).Printf("    %s\n", str)
@@ -89,5 +426,10 @@ func PrintKeyValueArray(stringOne string, stringArray []string) {
 }
 
 func PrintColor(color *color.Color, formattedString string) {
+	if defaultLogger.isJSON() {
+		defaultLogger.always(strings.TrimSpace(formattedString))
+		return
+	}
+
 	color.Println(formattedString)
 }
@@ -0,0 +1,163 @@
+package copylib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestJSONLogFormatSuccess(t *testing.T) {
+	t.Parallel()
+
+	var output bytes.Buffer
+	filesystem := newTestFilesystem(t, false)
+	runner := newTestRunner(newTestConfiguration(replaceSkipIfSame), filesystem)
+	runner.logger = newLogger(LogInfo, nil).with("operation", "foo")
+	runner.logFileEvents = true
+	WithOutput(&output)(runner)
+	WithLogFormat(LogFormatJSON)(runner)
+
+	runner.Copy(context.Background())
+
+	copied := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var record map[string]interface{}
+		err := json.Unmarshal([]byte(line), &record)
+		if err != nil {
+			t.Fatalf("expected every line to be JSON, but got %s: %s", line, err)
+		}
+		if record["operation"] != "foo" {
+			t.Errorf("expected every record to have the operation, but got %v", record)
+		}
+		if record["level"] == "DEBUG" {
+			t.Errorf("expected no debug records at the info level, but got %v", record)
+		}
+		if record["action"] == "copy" {
+			if record["level"] != "INFO" {
+				t.Errorf("expected the copied files to be logged at the info level, but got %v", record["level"])
+			}
+			if record["destination"] == nil {
+				t.Errorf("expected the copied files to be logged with their destination, but got %v", record)
+			}
+			copied[record["file"].(string)]++
+		}
+	}
+
+	for _, filename := range []string{"foobar001.txt", "foobar002.txt", "foobar003.txt"} {
+		if copied[filename] != len(testDestinationPaths) {
+			t.Errorf("expected a record for each destination %s was copied to, but got %d", filename, copied[filename])
+		}
+	}
+}
+
+func TestJSONLogFormatErrorsSuccess(t *testing.T) {
+	t.Parallel()
+
+	var output bytes.Buffer
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.manifest = manifestSettings{enabled: true}
+	writeTestFile(t, filesystem, path.Join(testDestinationPaths[0], manifestFilename), 10)
+	runner := newTestRunner(config, filesystem)
+	runner.logger = newLogger(LogInfo, nil).with("operation", "foo")
+	runner.paths = []string{"../outside", "foobar001.txt"}
+	WithOutput(&output)(runner)
+	WithLogFormat(LogFormatJSON)(runner)
+
+	runner.Copy(context.Background())
+
+	// the errors and warnings have the same attributes as the records for each file
+	var outside, manifest bool
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var record map[string]interface{}
+		err := json.Unmarshal([]byte(line), &record)
+		if err != nil {
+			t.Fatalf("expected every line to be JSON, but got %s: %s", line, err)
+		}
+		switch {
+		case record["level"] == "ERROR" && record["file"] == "../outside":
+			outside = true
+		case record["level"] == "WARN" && record["destination"] == testDestinationPaths[0] && record["error"] != nil:
+			manifest = true
+		}
+	}
+
+	if !outside {
+		t.Errorf("expected an error record with the path outside the source, but got %s", output.String())
+	}
+	if !manifest {
+		t.Errorf("expected a warning record with the destination and error of the unreadable manifest, but got %s", output.String())
+	}
+}
+
+func TestJSONStatsRecordSuccess(t *testing.T) {
+	t.Parallel()
+
+	var output bytes.Buffer
+	filesystem := newTestFilesystem(t, false)
+	runner := newTestRunner(newTestConfiguration(replaceSkipIfSame), filesystem)
+	runner.Copy(context.Background())
+
+	jsonLogger := newLogger(LogInfo, nil)
+	jsonLogger.setOutput(&output, LogFormatJSON)
+	jsonLogger.logStats("foo", runner.Stats)
+
+	var record struct {
+		Operation string `json:"operation"`
+		Stats     struct {
+			Result         string             `json:"result"`
+			FilesCopied    int                `json:"files_copied"`
+			PerDestination []DestinationStats `json:"per_destination"`
+		} `json:"stats"`
+	}
+	err := json.Unmarshal(output.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("expected the stats to be a single JSON record, but got %s: %s", output.String(), err)
+	}
+	if record.Operation != "foo" || record.Stats.Result != "success" || record.Stats.FilesCopied != 9 {
+		t.Errorf("expected the totals of the run in the stats record, but got %s", output.String())
+	}
+	if len(record.Stats.PerDestination) != len(testDestinationPaths) || record.Stats.PerDestination[1].FilesCopied != 3 ||
+		record.Stats.PerDestination[1].Path != testDestinationPaths[1] {
+		t.Errorf("expected the stats of each destination in the stats record, but got %+v", record.Stats.PerDestination)
+	}
+}
+
+func TestLogModeLevelSuccess(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		mode     LogMode
+		expected string
+	}{
+		{LogSilent, "error,highlight,always"},
+		{LogSimple, "simple,print,error,highlight,always"},
+		{LogWarning, "simple,print,warning,error,highlight,always"},
+		{LogInfo, "simple,print,info,warning,error,highlight,always"},
+		{LogDebug, "simple,print,debug,info,warning,error,highlight,always"},
+	}
+
+	for _, test := range tests {
+		var output bytes.Buffer
+		logger := newLogger(test.mode, &output)
+		logger.simple("simple")
+		logger.print("print")
+		logger.debug("debug")
+		logger.info("info")
+		logger.warning("warning")
+		logger.error("error")
+		logger.errorHighlight("highlight")
+		logger.always("always")
+
+		var shown []string
+		for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+			shown = append(shown, line[strings.LastIndex(line, " ")+1:])
+		}
+		if strings.Join(shown, ",") != test.expected {
+			t.Errorf("expected mode %d to show %s, but it showed %s", test.mode, test.expected, strings.Join(shown, ","))
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package copylib
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// FileOutcome is what happened to a file at a single destination.
+type FileOutcome string
+
+const (
+	// FileCopied means the file did not exist at the destination, and was copied.
+	FileCopied FileOutcome = "copied"
+	// FileReplaced means the file already existed at the destination, and was replaced.
+	FileReplaced FileOutcome = "replaced"
+	// FileSkipped means the file was not copied to the destination; the Reason says why.
+	FileSkipped FileOutcome = "skipped"
+	// FileFailed means the file could not be copied to the destination; the Error says why.
+	FileFailed FileOutcome = "failed"
+)
+
+// Result lists every file of a run, and what happened to it at each destination.
+type Result struct {
+	Operation string        `json:"operation"`
+	Started   time.Time     `json:"started"`
+	Finished  time.Time     `json:"finished"`
+	Outcome   string        `json:"result"`
+	Stats     *Stats        `json:"stats"`
+	Files     []*FileResult `json:"files"`
+}
+
+// FileResult is what happened to a single source file.
+type FileResult struct {
+	// Path is the path of the file, relative to the source.
+	Path         string              `json:"path"`
+	Size         int64               `json:"size"`
+	Destinations []DestinationResult `json:"destinations"`
+}
+
+// DestinationResult is what happened to a file at a single destination.
+type DestinationResult struct {
+	Destination string        `json:"destination"`
+	Outcome     FileOutcome   `json:"outcome"`
+	Reason      string        `json:"reason,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Bytes       int64         `json:"bytes"`
+	Duration    time.Duration `json:"duration_ns"`
+	// Retries is how many times the copy was tried again after failing.
+	Retries int `json:"retries,omitempty"`
+}
+
+// FailedFiles returns the files that could not be copied to at least one of the destinations.
+func (result *Result) FailedFiles() []*FileResult {
+	var failed []*FileResult
+	for _, file := range result.Files {
+		for _, dest := range file.Destinations {
+			if dest.Outcome == FileFailed {
+				failed = append(failed, file)
+				break
+			}
+		}
+	}
+
+	return failed
+}
+
+// resultRecorder builds the Result of a run from its events.
+type resultRecorder struct {
+	result  *Result
+	current *FileResult
+	// retries counts the retries of the current file at each destination
+	retries map[string]int
+}
+
+func newResultRecorder(operation string) *resultRecorder {
+	return &resultRecorder{result: &Result{Operation: operation, Files: []*FileResult{}}}
+}
+
+func (recorder *resultRecorder) record(event Event) {
+	result := recorder.result
+
+	switch event.Type {
+	case EventOperationStarted:
+		result.Started = event.Time
+
+	case EventFileStarted:
+		recorder.current = &FileResult{Path: event.Path, Size: event.Size}
+		result.Files = append(result.Files, recorder.current)
+		recorder.retries = nil
+
+	case EventFileRetrying:
+		if recorder.retries == nil {
+			recorder.retries = make(map[string]int)
+		}
+		recorder.retries[event.Destination]++
+
+	case EventFileCopied, EventFileSkipped, EventFileFailed:
+		if recorder.current == nil || recorder.current.Path != event.Path {
+			recorder.current = &FileResult{Path: event.Path, Size: event.Size}
+			result.Files = append(result.Files, recorder.current)
+			recorder.retries = nil
+		}
+
+		destResult := DestinationResult{
+			Destination: event.Destination,
+			Reason:      event.Reason,
+			Bytes:       event.Bytes,
+			Duration:    event.Duration,
+			Retries:     recorder.retries[event.Destination],
+		}
+		switch {
+		case event.Type == EventFileFailed:
+			destResult.Outcome = FileFailed
+			if event.Err != nil {
+				destResult.Error = event.Err.Error()
+			}
+		case event.Type == EventFileSkipped:
+			destResult.Outcome = FileSkipped
+		case event.Replaced:
+			destResult.Outcome = FileReplaced
+		default:
+			destResult.Outcome = FileCopied
+		}
+		recorder.current.Destinations = append(recorder.current.Destinations, destResult)
+
+	case EventOperationFinished:
+		result.Finished = event.Time
+		result.Stats = event.Stats
+		result.Outcome = "failed"
+		if event.Stats != nil {
+			result.Outcome = event.Stats.Outcome()
+		}
+	}
+}
+
+// WriteReport writes the results of one or more runs to the file as a JSON list.
+func WriteReport(filename string, results []*Result) error {
+	if results == nil {
+		results = []*Result{}
+	}
+
+	contents, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, append(contents, '\n'), 0644)
+}
@@ -0,0 +1,155 @@
+package copylib
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RestoreSettings describe a restore, which copies the files of an operation from one of its destinations
+// back to its source.
+type RestoreSettings struct {
+	// From is the label or path of the destination to restore from, or any other folder, such as an older
+	// backup from a destination with a {date} placeholder. It defaults to the first destination that is online.
+	From string
+	// To is the folder to restore to; it defaults to the source of the operation.
+	To string
+	// Paths limits the restore to these files and folders, relative to the source.
+	Paths []string
+	// Replace is how files that already exist are handled: never, skip or always. It defaults to skip.
+	Replace string
+	// SafetyFolder is where files are moved to before they are replaced. It defaults to a folder next to the
+	// one being restored to, named after it and the time of the restore.
+	SafetyFolder string
+	// DryRun shows what would be restored, without changing anything.
+	DryRun bool
+}
+
+// NewRestoreRunner creates a runner that copies the files of the operation with the given key in the loaded config
+// file back from one of its destinations, using the same engine as a copy. Each file that is replaced is first moved
+// to the safety folder, so nothing is lost if the backup turns out to be the wrong one. The hooks are not run.
+// Like NewRunner, Lock locks the operation and the folder being restored to, unless it is a dry run.
+func NewRestoreRunner(operationKey string, settings RestoreSettings, options ...Option) (*Runner, error) {
+	config, err := loadConfiguration(operationKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// the runner is created for the operation first, so its options decide how the folder to restore from, and the
+	// name of this machine, are found
+	runner, err := newRunner(operationKey, config, defaultLogger, options...)
+	if err != nil {
+		return nil, err
+	}
+	err = config.checkAppliesToThisMachine(runner.hostname)
+	if err != nil {
+		return nil, err
+	}
+	if runner.source == nil {
+		runner.source = OSFilesystem{}
+	}
+
+	from, err := config.restoreSource(runner.source, settings.From)
+	if err != nil {
+		return nil, err
+	}
+
+	target := config.source
+	if len(settings.To) > 0 {
+		target = settings.To
+	}
+
+	replace := replaceSkipIfSame
+	if len(settings.Replace) > 0 {
+		replace, err = parseReplaceMode(settings.Replace)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	safetyFolder := settings.SafetyFolder
+	if len(safetyFolder) == 0 {
+		cleanTarget := filepath.Clean(target)
+		safetyFolder = filepath.Join(filepath.Dir(cleanTarget),
+			fmt.Sprintf("%s-before-restore-%s", filepath.Base(cleanTarget), time.Now().Format("20060102-150405")))
+	}
+
+	runner.config = &configuration{
+		key:    config.key,
+		name:   fmt.Sprintf("%s (restore)", config.name),
+		source: from.path,
+		destinations: []destination{{
+			path:     target,
+			replace:  replace,
+			enabled:  true,
+			required: true,
+		}},
+		replace: replace,
+		retry:   config.retry,
+	}
+
+	runner.paths = settings.Paths
+	runner.safetyFolder = safetyFolder
+	runner.dryRun = settings.DryRun
+
+	if !settings.DryRun {
+		err = runner.prepareLocks(operationKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return runner, nil
+}
+
+// SafetyFolder returns the folder files are moved to before a restore replaces them, or "" if it is not a restore.
+func (runner *Runner) SafetyFolder() string {
+	return runner.safetyFolder
+}
+
+// restoreSource finds the destination to restore from, by its label or path, or uses the folder it names,
+// looking for them in the given filesystem. Without one, it is the first enabled destination that exists.
+func (config *configuration) restoreSource(filesystem SourceFilesystem, from string) (*destination, error) {
+	if len(from) == 0 {
+		for index := range config.destinations {
+			dest := &config.destinations[index]
+			if _, err := filesystem.Stat(dest.path); dest.enabled && err == nil {
+				return dest, nil
+			}
+		}
+		return nil, fmt.Errorf("none of the destinations are available to restore from")
+	}
+
+	for index := range config.destinations {
+		dest := &config.destinations[index]
+		if strings.EqualFold(dest.label, from) || filepath.Clean(dest.path) == filepath.Clean(from) {
+			return dest, nil
+		}
+	}
+
+	info, err := filesystem.Stat(from)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("\"%s\" is neither a destination of the operation nor a folder to restore from", from)
+	}
+
+	return &destination{path: from}, nil
+}
+
+// moveToSafetyFolder moves the file that is about to be replaced into the safety folder, keeping its path.
+func (fileCopier *fileCopier) moveToSafetyFolder(relativePath string, destFilename string) error {
+	safetyFilename := path.Join(fileCopier.safetyFolder, relativePath)
+
+	err := fileCopier.destination.MkdirAll(path.Dir(safetyFilename), folderPermissions)
+	if err == nil {
+		err = fileCopier.destination.Rename(destFilename, safetyFilename)
+	}
+	if err != nil {
+		return fmt.Errorf("the file it replaces could not be moved to the safety folder %s: %s", fileCopier.safetyFolder, err)
+	}
+
+	fileCopier.logger.debug(fmt.Sprintf("moved the existing %s to %s before replacing it", relativePath, safetyFilename))
+
+	return nil
+}
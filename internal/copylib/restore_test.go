@@ -0,0 +1,53 @@
+package copylib
+
+import (
+	"testing"
+)
+
+func TestRestoreSourceSuccess(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, false)
+	writeTestFile(t, filesystem, testDestinationPaths[1]+"/foobar001.txt", 8600)
+	writeTestFile(t, filesystem, "/archive/foobar/saves/foobar001.txt", 8600)
+
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.destinations[1].label = "usb"
+
+	tests := []struct {
+		from     string
+		expected string
+	}{
+		// the first destination is not in the filesystem, so the first one that is gets used
+		{"", testDestinationPaths[1]},
+		{"USB", testDestinationPaths[1]},
+		{testDestinationPaths[2], testDestinationPaths[2]},
+		{"/archive/foobar/saves", "/archive/foobar/saves"},
+	}
+
+	for _, test := range tests {
+		dest, err := config.restoreSource(filesystem, test.from)
+		if err != nil {
+			t.Errorf("unexpected error finding the folder to restore from \"%s\": %s", test.from, err)
+		} else if dest.path != test.expected {
+			t.Errorf("expected to restore from %s for \"%s\", but got %s", test.expected, test.from, dest.path)
+		}
+	}
+}
+
+func TestRestoreSourceFailure(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceSkipIfSame)
+
+	_, err := config.restoreSource(filesystem, "")
+	if err == nil {
+		t.Errorf("expected an error when none of the destinations are available")
+	}
+
+	_, err = config.restoreSource(filesystem, "/archive/foobar/saves")
+	if err == nil {
+		t.Errorf("expected an error for a folder that does not exist")
+	}
+}
@@ -0,0 +1,178 @@
+package copylib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// The classes of errors a failed copy can be retried for.
+const (
+	errorClassTimeout    = "timeout"
+	errorClassNetwork    = "network"
+	errorClassIO         = "io"
+	errorClassBusy       = "busy"
+	errorClassNoSpace    = "no-space"
+	errorClassPermission = "permission"
+	errorClassNotFound   = "not-found"
+	errorClassOther      = "other"
+	// errorClassAll is only used in the config, to retry every error
+	errorClassAll = "all"
+)
+
+const (
+	defaultRetryCount      = 3
+	defaultRetryBackoff    = time.Second
+	defaultRetryMaxBackoff = time.Minute
+)
+
+// errorClasses are the classes that can be given in the "on" setting of "retry", in the order they are documented.
+var errorClasses = []string{
+	errorClassTimeout, errorClassNetwork, errorClassIO, errorClassBusy, errorClassNoSpace,
+	errorClassPermission, errorClassNotFound, errorClassOther, errorClassAll,
+}
+
+// defaultRetryClasses are the errors that are usually gone a moment later, such as a share or USB hub dropping out.
+var defaultRetryClasses = []string{errorClassTimeout, errorClassNetwork, errorClassIO, errorClassBusy}
+
+// retryPolicy decides which failed copies are tried again, how many times, and how long to wait in between.
+// The wait starts at backoff, and doubles after each retry up to maxBackoff.
+type retryPolicy struct {
+	count      int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	classes    []string
+}
+
+// newRetryPolicy reads the "retry" setting of an operation.
+func newRetryPolicy(setting interface{}) (retryPolicy, error) {
+	policy := retryPolicy{
+		count:      defaultRetryCount,
+		backoff:    defaultRetryBackoff,
+		maxBackoff: defaultRetryMaxBackoff,
+		classes:    defaultRetryClasses,
+	}
+
+	retrySettings, ok := setting.(map[string]interface{})
+	if !ok {
+		return policy, fmt.Errorf("must be a mapping with \"count\", \"backoff\", \"max_backoff\" and \"on\"")
+	}
+	retrySettings = lowerCaseKeys(retrySettings)
+
+	if count, ok := retrySettings["count"]; ok {
+		countValue, ok := count.(int)
+		if !ok || countValue < 0 {
+			return policy, fmt.Errorf("\"count\" must be a whole number that is zero or more")
+		}
+		policy.count = countValue
+	}
+
+	var err error
+	if backoff, ok := retrySettings["backoff"]; ok {
+		policy.backoff, err = parseDuration(backoff)
+		if err != nil {
+			return policy, fmt.Errorf("\"backoff\" %s", err)
+		}
+	}
+
+	if maxBackoff, ok := retrySettings["max_backoff"]; ok {
+		policy.maxBackoff, err = parseDuration(maxBackoff)
+		if err != nil {
+			return policy, fmt.Errorf("\"max_backoff\" %s", err)
+		}
+	}
+	if policy.maxBackoff < policy.backoff {
+		return policy, fmt.Errorf("\"max_backoff\" must not be less than \"backoff\"")
+	}
+
+	if on, ok := retrySettings["on"]; ok {
+		classes, err := getStringList(on)
+		if err != nil {
+			return policy, fmt.Errorf("\"on\" %s", err)
+		}
+
+		policy.classes = make([]string, 0, len(classes))
+		for _, class := range classes {
+			class = strings.ToLower(strings.TrimSpace(class))
+			if !isErrorClass(class) {
+				return policy, fmt.Errorf("\"on\" must only contain %s, not \"%s\"", strings.Join(errorClasses, ", "), class)
+			}
+			policy.classes = append(policy.classes, class)
+		}
+	}
+
+	return policy, nil
+}
+
+// isErrorClass checks if the text is one of the error classes.
+func isErrorClass(class string) bool {
+	for _, errorClass := range errorClasses {
+		if class == errorClass {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shouldRetry checks if a copy that failed with the error, after the given number of attempts, should be tried again.
+func (policy retryPolicy) shouldRetry(err error, attempts int) bool {
+	if attempts > policy.count || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	class := classifyError(err)
+	for _, retryClass := range policy.classes {
+		if retryClass == errorClassAll || retryClass == class {
+			return true
+		}
+	}
+
+	return false
+}
+
+// delay returns how long to wait before the given retry, counting from one.
+func (policy retryPolicy) delay(retry int) time.Duration {
+	delay := policy.backoff
+	for index := 1; index < retry && delay < policy.maxBackoff; index++ {
+		delay *= 2
+	}
+
+	return min(delay, policy.maxBackoff)
+}
+
+// classifyError returns the class of the error, such as "timeout" or "permission".
+func classifyError(err error) string {
+	var timeoutErr interface{ Timeout() bool }
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return errorClassNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return errorClassPermission
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &timeoutErr) && timeoutErr.Timeout():
+		return errorClassTimeout
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errorClassIO
+	}
+
+	return systemErrorClass(err)
+}
+
+// sleep waits for the duration, returning early with an error if the context is cancelled first.
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package copylib
+
+// systemErrorClass cannot tell the errors of this OS apart, so they are all in the "other" class.
+func systemErrorClass(err error) string {
+	return errorClassOther
+}
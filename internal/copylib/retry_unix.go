@@ -0,0 +1,32 @@
+//go:build linux || darwin || freebsd
+
+package copylib
+
+import (
+	"errors"
+	"syscall"
+)
+
+// systemErrorClass returns the class of an error reported by the OS.
+func systemErrorClass(err error) string {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return errorClassOther
+	}
+
+	switch errno {
+	case syscall.ETIMEDOUT:
+		return errorClassTimeout
+	case syscall.ECONNRESET, syscall.ECONNABORTED, syscall.ECONNREFUSED, syscall.ENETDOWN, syscall.ENETUNREACH,
+		syscall.ENETRESET, syscall.EHOSTDOWN, syscall.EHOSTUNREACH, syscall.ESTALE, syscall.EPIPE:
+		return errorClassNetwork
+	case syscall.EIO, syscall.ENXIO, syscall.ENODEV:
+		return errorClassIO
+	case syscall.EBUSY, syscall.EAGAIN, syscall.ETXTBSY, syscall.EINTR:
+		return errorClassBusy
+	case syscall.ENOSPC, syscall.EDQUOT:
+		return errorClassNoSpace
+	}
+
+	return errorClassOther
+}
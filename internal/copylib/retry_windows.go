@@ -0,0 +1,34 @@
+//go:build windows
+
+package copylib
+
+import (
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// systemErrorClass returns the class of an error reported by the OS.
+func systemErrorClass(err error) string {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return errorClassOther
+	}
+
+	switch errno {
+	case windows.ERROR_SEM_TIMEOUT, windows.WAIT_TIMEOUT:
+		return errorClassTimeout
+	case windows.ERROR_NETNAME_DELETED, windows.ERROR_UNEXP_NET_ERR, windows.ERROR_BAD_NETPATH,
+		windows.ERROR_NETWORK_UNREACHABLE, windows.ERROR_DEV_NOT_EXIST, windows.ERROR_CONNECTION_ABORTED:
+		return errorClassNetwork
+	case windows.ERROR_CRC, windows.ERROR_GEN_FAILURE, windows.ERROR_NOT_READY, windows.ERROR_IO_DEVICE:
+		return errorClassIO
+	case windows.ERROR_SHARING_VIOLATION, windows.ERROR_LOCK_VIOLATION:
+		return errorClassBusy
+	case windows.ERROR_DISK_FULL, windows.ERROR_HANDLE_DISK_FULL:
+		return errorClassNoSpace
+	}
+
+	return errorClassOther
+}
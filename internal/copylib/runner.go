@@ -1,51 +1,347 @@
 package copylib
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"sync"
+	"time"
 )
 
 type Runner struct {
-	Waiter     sync.WaitGroup
-	configName string
-	config     *configuration
-	Stats      *stats
+	Waiter        sync.WaitGroup
+	configName    string
+	config        *configuration
+	logger        *logger
+	eventHandlers []EventHandler
+	// logFileEvents logs what happens to each file, from the events of the run; the command line tool
+	// displays the events itself instead
+	logFileEvents bool
+	source        SourceFilesystem
+	destination   Filesystem
+	paths         []string
+	rescan        bool
+	dryRun        bool
+	safetyFolder  string
+	locks         *runLocks
+	lockWait      context.Context
+	hostname      func() (string, error)
+	Stats         *Stats
+	Result        *Result
 }
 
-func NewRunner(configName string) (*Runner, error) {
-	config := getConfiguration(configName)
-	if config == nil {
-		return nil, fmt.Errorf("configuration with name '%s' not found", configName)
+// Option changes how a Runner behaves. Options are passed to the functions that create a Runner.
+type Option func(runner *Runner)
+
+// WithLogMode sets how much the runner logs while it copies.
+func WithLogMode(mode LogMode) Option {
+	return func(runner *Runner) {
+		runner.logger.mode = mode
+	}
+}
+
+// WithOutput sets where the runner writes its log output; use io.Discard to silence it entirely.
+func WithOutput(output io.Writer) Option {
+	return func(runner *Runner) {
+		runner.logger.setOutput(output, runner.logger.format)
+	}
+}
+
+// WithLogFormat sets the format of the runner's log output: LogFormatText, the default, or LogFormatJSON,
+// which writes each message as a line of JSON. An unknown format is ignored.
+func WithLogFormat(format string) Option {
+	return func(runner *Runner) {
+		if checkLogFormat(format) == nil {
+			runner.logger.setOutput(runner.logger.output, format)
+		}
+	}
+}
+
+// WithSourceFilesystem sets the filesystem the runner reads the source files from; it defaults to OSFilesystem.
+func WithSourceFilesystem(source SourceFilesystem) Option {
+	return func(runner *Runner) {
+		runner.source = source
+	}
+}
+
+// WithDestinationFilesystem sets the filesystem the runner writes to every destination; it defaults to OSFilesystem.
+func WithDestinationFilesystem(destination Filesystem) Option {
+	return func(runner *Runner) {
+		runner.destination = destination
+	}
+}
+
+// WithPaths limits the copy to the given files and folders, relative to the source, instead of the whole source.
+// Paths that no longer exist in the source are ignored, so it can be given every path that changed.
+func WithPaths(paths []string) Option {
+	return func(runner *Runner) {
+		runner.paths = paths
+	}
+}
+
+// WithRescan rebuilds the manifest of each destination from the files in it, instead of trusting it, for
+// operations that keep a manifest. It is needed when the files at a destination were changed by something else.
+func WithRescan() Option {
+	return func(runner *Runner) {
+		runner.rescan = true
+	}
+}
+
+// WithDryRun decides what would be copied, and reports it in the stats, events and results as if it had been,
+// without writing anything to the destinations.
+func WithDryRun() Option {
+	return func(runner *Runner) {
+		runner.dryRun = true
+	}
+}
+
+// WithLockWait makes Lock wait for another run using the operation or one of its destinations to finish,
+// until the context is done, instead of failing straight away with ErrLocked.
+func WithLockWait(ctx context.Context) Option {
+	return func(runner *Runner) {
+		runner.lockWait = ctx
+	}
+}
+
+// WithHostname sets how the runner finds the name of this machine, which is used to check the hosts an operation
+// runs on, and for the {host} placeholder in destination paths. It defaults to os.Hostname.
+func WithHostname(hostname func() (string, error)) Option {
+	return func(runner *Runner) {
+		runner.hostname = hostname
+	}
+}
+
+// NewRunner creates a runner for the operation with the given key in the loaded config file.
+// It is used by the command line tool, so it shares the tool's logging mode.
+// Call Lock before Copy, so no other run can use the operation or its destinations until Copy finishes,
+// and Close if the runner is not copied after all.
+func NewRunner(configName string, options ...Option) (*Runner, error) {
+	config, err := loadConfiguration(configName)
+	if err != nil {
+		return nil, err
+	}
+
+	runner, err := newRunner(configName, config, defaultLogger, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the options may say how to find the name of this machine, so the operation is checked against it once they are applied
+	err = config.checkAppliesToThisMachine(runner.hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	err = runner.prepareLocks(configName)
+	if err != nil {
+		return nil, err
+	}
+
+	return runner, nil
+}
+
+// NewAdHocRunner creates a runner for a copy that is defined by the given settings instead of the config file.
+// Like NewRunner, Lock locks the destinations until Copy finishes.
+func NewAdHocRunner(settings OperationSettings, options ...Option) (*Runner, error) {
+	config, err := newConfiguration(settings.toMap())
+	if err != nil {
+		return nil, err
+	}
+
+	runner, err := newRunner(config.name, config, defaultLogger, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = runner.prepareLocks("")
+	if err != nil {
+		return nil, err
+	}
+
+	return runner, nil
+}
+
+// NewRunnerForOperation creates a runner for the operation, without using a config file or any other global state.
+func NewRunnerForOperation(operation Operation, options ...Option) (*Runner, error) {
+	config, err := operation.configuration()
+	if err != nil {
+		return nil, err
+	}
+
+	runner, err := newRunner(config.key, config, newLogger(LogInfo, nil), options...)
+	if err != nil {
+		return nil, err
+	}
+	runner.logFileEvents = true
+
+	applies, reason := config.selector.appliesToThisMachine(runner.hostname)
+	if !applies {
+		return nil, fmt.Errorf("the operation \"%s\" does not apply to this machine, as %s", config.name, reason)
 	}
 
+	return runner, nil
+}
+
+// newRunner finishes preparing the configuration for this run, and creates the runner for it.
+func newRunner(configName string, config *configuration, logger *logger, options ...Option) (*Runner, error) {
 	runner := &Runner{
 		configName: configName,
+		config:     config,
+		logger:     logger.with("operation", configName),
+		hostname:   os.Hostname,
+	}
+
+	for _, option := range options {
+		option(runner)
+	}
+
+	err := config.expandPathTemplates(time.Now(), runner.hostname)
+	if err != nil {
+		return nil, err
 	}
 
-	runner.config = config
 	runner.Waiter.Add(1)
 
 	return runner, nil
 }
 
-func (runner *Runner) Copy() {
+// Copy runs the operation: the pre hooks, the copy itself and then the post hooks, which are run even if a pre hook fails.
+// Cancelling the context stops a running pre hook, or stops the copy between files, or part way through a file, in which
+// case the partial file is removed and Stats is marked as interrupted. The post hooks are still run, so anything stopped
+// by a pre hook is restarted.
+// The results are available in Stats, and what happened to each file in Result, once it returns.
+// The Stats are also sent with EventOperationFinished.
+// It releases the locks taken by Lock when it finishes.
+func (runner *Runner) Copy(ctx context.Context) {
 	defer runner.handleFinish()
 
-	PrintDebug("file copy initiating...")
+	if runner.logger == nil {
+		runner.logger = defaultLogger
+	}
+	if runner.source == nil {
+		runner.source = OSFilesystem{}
+	}
+	if runner.destination == nil {
+		runner.destination = OSFilesystem{}
+	}
+
+	// the result is recorded first, so it is complete before the other handlers see the operation finish
+	recorder := newResultRecorder(runner.configName)
+	runner.Result = recorder.result
+	handlers := []EventHandler{recorder.record}
+	if runner.logFileEvents {
+		handlers = append(handlers, runner.logger.logFileEvent)
+	}
+	events := &eventEmitter{
+		operation: runner.configName,
+		handlers:  append(handlers, runner.eventHandlers...),
+	}
+	events.emit(Event{Type: EventOperationStarted})
+	defer func() {
+		events.emit(Event{Type: EventOperationFinished, Stats: runner.Stats})
+	}()
+
+	if ctx.Err() != nil {
+		runner.logger.warning("the copy was cancelled before it started")
+		runner.Stats = &Stats{StartTime: time.Now(), Interrupted: true}
+		return
+	}
+
+	if len(runner.config.preHooks) > 0 {
+		err := runHooks(ctx, runner.logger, "pre", runner.config.preHooks, hookEnvironment(runner.config, "pre", nil))
+		if err != nil {
+			runner.logger.error(fmt.Sprintf("%s, so the copy was not started", err), "error", err)
+			runner.Stats = &Stats{StartTime: time.Now(), NumberOfErrors: 1, Interrupted: ctx.Err() != nil}
+
+			// the pre hooks that did run may have stopped something, so the post hooks still get to start it again
+			runner.runPostHooks(ctx)
+			return
+		}
+	}
+
+	runner.logger.debug("file copy initiating...")
 
-	fileCopier := &fileCopier{}
-	fileCopier.run(runner.config)
+	fileCopier := &fileCopier{
+		source:       runner.source,
+		destination:  runner.destination,
+		paths:        runner.paths,
+		rescan:       runner.rescan,
+		dryRun:       runner.dryRun,
+		safetyFolder: runner.safetyFolder,
+		logger:       runner.logger,
+		events:       events,
+	}
+	fileCopier.run(ctx, runner.config)
 
 	runner.Stats = &fileCopier.stats
 
-	PrintDebug("file copy complete...")
+	runner.logger.debug("file copy complete...")
+
+	runner.runPostHooks(ctx)
+}
+
+// runPostHooks runs the post hooks, once the copy has finished or a pre hook has failed. They are run even when
+// the copy was interrupted, so anything stopped by a pre hook is restarted; then only their timeouts stop them.
+func (runner *Runner) runPostHooks(ctx context.Context) {
+	if len(runner.config.postHooks) == 0 {
+		return
+	}
+
+	if ctx.Err() != nil {
+		ctx = context.WithoutCancel(ctx)
+	}
+
+	err := runHooks(ctx, runner.logger, "post", runner.config.postHooks, hookEnvironment(runner.config, "post", runner.Stats))
+	if err != nil {
+		runner.logger.error(err.Error(), "error", err)
+		runner.Stats.NumberOfErrors++
+	}
+}
+
+// prepareLocks sets up the locks on the operation, when it has a key, and on its destinations, for Lock to take.
+func (runner *Runner) prepareLocks(operationKey string) error {
+	locks, err := newRunLocks(operationKey, runner.config)
+	if err != nil {
+		return fmt.Errorf("unable to lock the operation: %s", err)
+	}
+	runner.locks = locks
+
+	return nil
+}
+
+// Lock takes the locks of a runner created by NewRunner, NewAdHocRunner or NewRestoreRunner, so no other run
+// can use its operation or destinations until Copy finishes. If another run already has them, it fails with
+// ErrLocked, unless WithLockWait was given. It does nothing for a runner without locks.
+func (runner *Runner) Lock() error {
+	if runner.locks == nil {
+		return nil
+	}
+
+	host, _ := runner.hostname()
+	owner := lockOwner{
+		PID:       os.Getpid(),
+		Host:      host,
+		Operation: runner.configName,
+		Started:   time.Now(),
+	}
+
+	return runner.locks.acquire(owner, runner.lockWait)
+}
+
+// Close releases the locks taken by Lock. Copy releases them when it finishes, so Close is only needed
+// for a runner that is locked but not copied.
+func (runner *Runner) Close() {
+	runner.locks.release()
 }
 
 func (runner *Runner) handleFinish() {
 	recovery := recover()
 	if recovery != nil {
-		PrintError(fmt.Sprintf("panic occurred:\n    %v", recovery))
+		runner.logger.error(fmt.Sprintf("panic occurred:\n    %v", recovery), "error", recovery)
 	}
 
+	runner.Close()
+
 	runner.Waiter.Done()
 }
@@ -0,0 +1,114 @@
+package copylib
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAdHocRunnerSuccess(t *testing.T) {
+	t.Setenv("GO_COPY_STATE_DIR", t.TempDir())
+
+	filesystem := newTestFilesystem(t, true)
+	settings := OperationSettings{
+		Name:         "ad-hoc copy",
+		Source:       testSource,
+		Destinations: testDestinationPaths[:2],
+		Replace:      "skip",
+	}
+
+	runner, err := NewAdHocRunner(settings, WithSourceFilesystem(filesystem), WithDestinationFilesystem(filesystem), WithOutput(io.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error creating the ad-hoc runner: %s", err)
+	}
+
+	runner.Copy(context.Background())
+
+	if runner.Stats.TotalFilesCopied != 12 || runner.Stats.NumberOfErrors != 0 {
+		t.Errorf("expected 12 files to be copied without errors, but %d were copied with %d errors",
+			runner.Stats.TotalFilesCopied, runner.Stats.NumberOfErrors)
+	}
+	for _, destPath := range testDestinationPaths[:2] {
+		checkTestFileCopied(t, filesystem, "subdir001/foobar004.txt", destPath)
+	}
+}
+
+func TestNewAdHocRunnerFailure(t *testing.T) {
+	t.Setenv("GO_COPY_STATE_DIR", t.TempDir())
+
+	tests := []struct {
+		reason   string
+		settings OperationSettings
+	}{
+		{"no source", OperationSettings{Name: "ad-hoc copy", Destinations: testDestinationPaths, Replace: "skip"}},
+		{"no destinations", OperationSettings{Name: "ad-hoc copy", Source: testSource, Replace: "skip"}},
+		{"an unknown replace mode", OperationSettings{Name: "ad-hoc copy", Source: testSource, Destinations: testDestinationPaths, Replace: "sometimes"}},
+	}
+
+	for _, test := range tests {
+		runner, err := NewAdHocRunner(test.settings, WithOutput(io.Discard))
+		if err == nil || runner != nil {
+			t.Errorf("expected an error creating an ad-hoc runner with %s", test.reason)
+		}
+	}
+}
+
+func TestNewRunnerHostnameSuccess(t *testing.T) {
+	loadTestListingConfig(t, time.Now())
+
+	// the operation is checked against the runner's own hostname, rather than the name of the machine the tests run on
+	runner, err := NewRunner("elsewhere", WithOutput(io.Discard), WithHostname(func() (string, error) { return "office-pc", nil }))
+	if err != nil {
+		t.Fatalf("unexpected error creating a runner on the host of the operation: %s", err)
+	}
+	runner.Close()
+
+	_, err = NewRunner("elsewhere", WithOutput(io.Discard), WithHostname(testListingHostname))
+	if err == nil || !strings.Contains(err.Error(), "does not apply to this machine") {
+		t.Errorf("expected an error creating a runner on another host, but got %v", err)
+	}
+}
+
+func TestRunnerLockFailure(t *testing.T) {
+	t.Setenv("GO_COPY_STATE_DIR", t.TempDir())
+
+	settings := OperationSettings{
+		Name:         "ad-hoc copy",
+		Source:       testSource,
+		Destinations: testDestinationPaths[:1],
+		Replace:      "skip",
+	}
+
+	// creating a runner takes no locks, so one that is never copied cannot lock anyone out
+	hostname := func() (string, error) { return "gaming-pc", nil }
+	first, err := NewAdHocRunner(settings, WithOutput(io.Discard), WithHostname(hostname))
+	if err != nil {
+		t.Fatalf("unexpected error creating the first runner: %s", err)
+	}
+	second, err := NewAdHocRunner(settings, WithOutput(io.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error creating the second runner: %s", err)
+	}
+
+	err = first.Lock()
+	if err != nil {
+		t.Fatalf("unexpected error locking the first runner: %s", err)
+	}
+	err = second.Lock()
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected the second runner to be locked out, but got: %v", err)
+	} else if !strings.Contains(err.Error(), "on gaming-pc") {
+		t.Errorf("expected the lock to be owned by the host the runner was given, but got: %s", err)
+	}
+
+	// a runner that is not copied after all gives its locks back with Close
+	first.Close()
+	err = second.Lock()
+	if err != nil {
+		t.Errorf("expected the second runner to get the locks once the first was closed, but got: %s", err)
+	}
+	second.Close()
+}
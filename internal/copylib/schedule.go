@@ -0,0 +1,292 @@
+package copylib
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleSearchLimit is how far ahead Next looks for a time that matches a cron expression.
+const scheduleSearchLimit = 5 * 366 * 24 * time.Hour
+
+// cronDescriptors are the shorthands for common cron expressions.
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes one of the five fields of a cron expression.
+type cronField struct {
+	name     string
+	minimum  int
+	maximum  int
+	aliases  []string
+	aliasMin int
+}
+
+var cronFields = []cronField{
+	{name: "minute", minimum: 0, maximum: 59},
+	{name: "hour", minimum: 0, maximum: 23},
+	{name: "day of month", minimum: 1, maximum: 31},
+	{name: "month", minimum: 1, maximum: 12,
+		aliases: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}, aliasMin: 1},
+	// 7 is also Sunday, as it is in most cron implementations
+	{name: "day of week", minimum: 0, maximum: 7,
+		aliases: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}, aliasMin: 0},
+}
+
+// Schedule says when an operation runs by itself, either at a fixed interval, or at the times matched by a
+// cron expression with the minute, hour, day of month, month and day of week fields.
+type Schedule struct {
+	text     string
+	interval time.Duration
+	// the values matched by each cron field, as bit sets
+	minutes, hours, days, months, weekdays uint64
+	// a day matches either the day of month or day of week when both are restricted, as it does in cron
+	anyDay, anyWeekday bool
+}
+
+// ParseSchedule reads a schedule, which is either an interval, such as "6h" or "@every 30m", a cron expression,
+// such as "30 2 * * mon-fri", or one of the shorthands @hourly, @daily, @weekly, @monthly or @yearly.
+func ParseSchedule(text string) (*Schedule, error) {
+	text = strings.TrimSpace(text)
+	lowerText := strings.ToLower(text)
+	if len(text) == 0 {
+		return nil, fmt.Errorf("must not be empty")
+	}
+
+	if interval, ok := strings.CutPrefix(lowerText, "@every "); ok {
+		duration, err := parseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("has an interval that %s", err)
+		}
+		return &Schedule{text: text, interval: duration}, nil
+	}
+
+	if expression, ok := cronDescriptors[lowerText]; ok {
+		schedule, err := parseCronExpression(expression)
+		if err != nil {
+			return nil, err
+		}
+		schedule.text = text
+		return schedule, nil
+	}
+
+	fields := strings.Fields(lowerText)
+	if len(fields) == 1 {
+		duration, err := parseDuration(text)
+		if err != nil {
+			return nil, fmt.Errorf("must be an interval, such as \"6h\", or a cron expression, such as \"0 3 * * *\"")
+		}
+		return &Schedule{text: text, interval: duration}, nil
+	}
+
+	schedule, err := parseCronExpression(lowerText)
+	if err != nil {
+		return nil, err
+	}
+	schedule.text = text
+
+	return schedule, nil
+}
+
+// newSchedule reads the "schedule" setting of an operation, which can be text, or a number of seconds.
+func newSchedule(setting interface{}) (*Schedule, error) {
+	switch value := setting.(type) {
+	case string:
+		return ParseSchedule(value)
+	case int, float64:
+		interval, err := parseDuration(value)
+		if err != nil {
+			return nil, err
+		}
+		return &Schedule{text: interval.String(), interval: interval}, nil
+	}
+
+	return nil, fmt.Errorf("must be an interval or a cron expression")
+}
+
+// parseCronExpression reads the five fields of a cron expression.
+func parseCronExpression(expression string) (*Schedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("must be an interval, or a cron expression with 5 fields, not \"%s\"", expression)
+	}
+
+	var values [5]uint64
+	for index, field := range fields {
+		var err error
+		values[index], err = cronFields[index].parse(field)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	schedule := &Schedule{
+		minutes:    values[0],
+		hours:      values[1],
+		days:       values[2],
+		months:     values[3],
+		weekdays:   values[4],
+		anyDay:     fields[2] == "*" || strings.HasPrefix(fields[2], "*/"),
+		anyWeekday: fields[4] == "*" || strings.HasPrefix(fields[4], "*/"),
+	}
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("\"%s\" never matches a date", expression)
+	}
+
+	return schedule, nil
+}
+
+// parse returns the values matched by a single field, which is a comma separated list of "*", values,
+// or ranges, each optionally followed by a step, such as "*/15", "1-5" or "mon,wed,fri".
+func (field cronField) parse(text string) (uint64, error) {
+	var values uint64
+
+	for _, part := range strings.Split(text, ",") {
+		rangeText, stepText, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("the %s field has an invalid step \"%s\"", field.name, stepText)
+			}
+		}
+
+		start, end := field.minimum, field.maximum
+		if rangeText != "*" {
+			startText, endText, isRange := strings.Cut(rangeText, "-")
+
+			var err error
+			start, err = field.parseValue(startText)
+			if err != nil {
+				return 0, err
+			}
+			if isRange {
+				end, err = field.parseValue(endText)
+				if err != nil {
+					return 0, err
+				}
+			} else if !hasStep {
+				end = start
+			}
+			if end < start {
+				return 0, fmt.Errorf("the %s field has a range that ends before it starts: \"%s\"", field.name, rangeText)
+			}
+		}
+
+		for value := start; value <= end; value += step {
+			values |= 1 << value
+		}
+	}
+
+	return values, nil
+}
+
+// parseValue reads a single value of the field, which is a number or, for months and days of the week, a name.
+func (field cronField) parseValue(text string) (int, error) {
+	for index, alias := range field.aliases {
+		if text == alias {
+			return index + field.aliasMin, nil
+		}
+	}
+
+	value, err := strconv.Atoi(text)
+	if err != nil || value < field.minimum || value > field.maximum {
+		return 0, fmt.Errorf("the %s field must be between %d and %d, not \"%s\"", field.name, field.minimum, field.maximum, text)
+	}
+
+	return value, nil
+}
+
+// String returns the schedule as it was written.
+func (schedule *Schedule) String() string {
+	return schedule.text
+}
+
+// Interval returns how often an interval schedule runs, or zero for a cron expression.
+func (schedule *Schedule) Interval() time.Duration {
+	return schedule.interval
+}
+
+// Next returns the first time the schedule runs after the given time, or the zero time if it never does.
+// An interval schedule runs once the interval has passed since the given time.
+func (schedule *Schedule) Next(after time.Time) time.Time {
+	if schedule.interval > 0 {
+		return after.Add(schedule.interval)
+	}
+
+	location := after.Location()
+	next := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(scheduleSearchLimit)
+
+	for next.Before(limit) {
+		year, month, day := next.Date()
+		hour, minute := next.Hour(), next.Minute()
+
+		switch {
+		case schedule.months&(1<<uint(month)) == 0:
+			next = time.Date(year, month+1, 1, 0, 0, 0, 0, location)
+		case !schedule.matchesDay(next):
+			next = time.Date(year, month, day+1, 0, 0, 0, 0, location)
+		case schedule.hours&(1<<uint(hour)) == 0:
+			next = time.Date(year, month, day, hour+1, 0, 0, 0, location)
+		case schedule.minutes&(1<<uint(minute)) == 0:
+			// jump straight to the next minute that matches in this hour, if there is one
+			later := schedule.minutes >> uint(minute+1)
+			if later == 0 {
+				next = time.Date(year, month, day, hour+1, 0, 0, 0, location)
+			} else {
+				next = next.Add(time.Duration(bits.TrailingZeros64(later)+1) * time.Minute)
+			}
+		default:
+			return next
+		}
+	}
+
+	return time.Time{}
+}
+
+// firstRun returns when the schedule first runs, once go-copy starts running it at the given time.
+// An interval schedule that has not run for that long, or has never run, runs straight away.
+func (schedule *Schedule) firstRun(now time.Time, lastRun time.Time, hasRun bool) time.Time {
+	if schedule.interval == 0 {
+		return schedule.Next(now)
+	}
+
+	if hasRun && lastRun.Add(schedule.interval).After(now) {
+		return lastRun.Add(schedule.interval)
+	}
+
+	return now
+}
+
+// matchesDay checks if the day of month or day of week of the time are in the schedule.
+func (schedule *Schedule) matchesDay(when time.Time) bool {
+	dayMatches := schedule.days&(1<<uint(when.Day())) != 0
+	weekdayMatches := schedule.weekdays&(1<<uint(when.Weekday())) != 0
+
+	switch {
+	case schedule.anyDay && schedule.anyWeekday:
+		return true
+	case schedule.anyDay:
+		return weekdayMatches
+	case schedule.anyWeekday:
+		return dayMatches
+	}
+
+	return dayMatches || weekdayMatches
+}
@@ -0,0 +1,127 @@
+package copylib
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseScheduleSuccess(t *testing.T) {
+	t.Parallel()
+
+	after := time.Date(2026, time.March, 6, 14, 20, 30, 0, time.UTC) // a Friday
+	tests := []struct {
+		text string
+		next time.Time
+	}{
+		{"6h", after.Add(6 * time.Hour)},
+		{"@every 90s", after.Add(90 * time.Second)},
+		{"*/15 * * * *", time.Date(2026, time.March, 6, 14, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, time.March, 7, 3, 0, 0, 0, time.UTC)},
+		{"30 2 * * mon-fri", time.Date(2026, time.March, 9, 2, 30, 0, 0, time.UTC)},
+		{"0 0 1 jan,jul *", time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 10 * 5", time.Date(2026, time.March, 10, 12, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2026, time.March, 8, 9, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"@Weekly", time.Date(2026, time.March, 8, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.text)
+		if err != nil {
+			t.Errorf("unexpected error parsing \"%s\": %s", test.text, err)
+			continue
+		}
+
+		next := schedule.Next(after)
+		if !next.Equal(test.next) {
+			t.Errorf("expected \"%s\" to run next at %s, but got %s", test.text, test.next, next)
+		}
+		if schedule.String() != test.text {
+			t.Errorf("expected the schedule to be shown as \"%s\", but got \"%s\"", test.text, schedule)
+		}
+	}
+}
+
+func TestParseScheduleFailure(t *testing.T) {
+	t.Parallel()
+
+	for _, text := range []string{"", "soon", "-5m", "* * * *", "60 * * * *", "0 0 * * someday", "5-1 * * * *", "*/0 * * * *", "0 0 30 2 *"} {
+		_, err := ParseSchedule(text)
+		if err == nil {
+			t.Errorf("expected \"%s\" to be an invalid schedule", text)
+		}
+	}
+}
+
+func TestSchedulerFirstRunSuccess(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.March, 6, 14, 20, 30, 0, time.UTC)
+	scheduler := NewScheduler(func(ctx context.Context, key string) {})
+	scheduler.now = func() time.Time { return now }
+	scheduler.lastRun = func(key string) (time.Time, bool) {
+		switch key {
+		case "recent":
+			return now.Add(-time.Hour), true
+		case "stale":
+			return now.Add(-time.Hour * 24), true
+		}
+		return time.Time{}, false
+	}
+
+	interval, _ := ParseSchedule("6h")
+	nightly, _ := ParseSchedule("0 3 * * *")
+	scheduler.SetSchedules(map[string]*Schedule{"recent": interval, "stale": interval, "never": interval, "nightly": nightly})
+
+	nextRuns := scheduler.NextRuns()
+	if !nextRuns["recent"].Equal(now.Add(5 * time.Hour)) {
+		t.Errorf("expected an interval to continue from the last run, but it runs next at %s", nextRuns["recent"])
+	}
+	if !nextRuns["stale"].Equal(now) || !nextRuns["never"].Equal(now) {
+		t.Errorf("expected overdue intervals to run straight away, but got %s and %s", nextRuns["stale"], nextRuns["never"])
+	}
+	if !nextRuns["nightly"].Equal(time.Date(2026, time.March, 7, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected a cron schedule to wait for its next time, but it runs next at %s", nextRuns["nightly"])
+	}
+}
+
+func TestSchedulerNoOverlapSuccess(t *testing.T) {
+	t.Parallel()
+
+	var mutex sync.Mutex
+	var running, runs int
+	overlapped := false
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	scheduler := NewScheduler(func(ctx context.Context, key string) {
+		mutex.Lock()
+		running++
+		runs++
+		overlapped = overlapped || running > 1
+		mutex.Unlock()
+
+		// each run takes longer than the interval, so some of the runs that come due must be skipped
+		time.Sleep(50 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+	})
+	scheduler.lastRun = func(key string) (time.Time, bool) { return time.Time{}, false }
+	scheduler.SetSchedules(map[string]*Schedule{"saves": {text: "10ms", interval: 10 * time.Millisecond}})
+
+	scheduler.Run(ctx)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if overlapped {
+		t.Errorf("expected the runs of an operation never to overlap")
+	}
+	if runs < 2 || runs > 7 {
+		t.Errorf("expected between 2 and 7 runs of 50ms in 300ms, but there were %d", runs)
+	}
+}
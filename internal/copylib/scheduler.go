@@ -0,0 +1,236 @@
+package copylib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Scheduler runs operations when their schedules say, until its context is cancelled.
+// Operations are run one at a time, in the order they come due, so their output never overlaps.
+// A run that comes due while the same operation is still running, or waiting to run, is skipped.
+type Scheduler struct {
+	run     func(ctx context.Context, key string)
+	now     func() time.Time
+	lastRun func(key string) (time.Time, bool)
+
+	mutex     sync.Mutex
+	schedules map[string]*Schedule
+	nextRuns  map[string]time.Time
+	// queue holds the operations waiting to run, and pending has those, along with the one that is running
+	queue   []string
+	pending map[string]bool
+	// changed wakes the scheduler when the schedules change, and ready wakes the worker when a run is queued
+	changed chan struct{}
+	ready   chan struct{}
+}
+
+// NewScheduler creates a scheduler that calls run for each operation that comes due.
+func NewScheduler(run func(ctx context.Context, key string)) *Scheduler {
+	return &Scheduler{
+		run:       run,
+		now:       time.Now,
+		lastRun:   lastRunStarted,
+		schedules: make(map[string]*Schedule),
+		nextRuns:  make(map[string]time.Time),
+		pending:   make(map[string]bool),
+		changed:   make(chan struct{}, 1),
+		ready:     make(chan struct{}, 1),
+	}
+}
+
+// OperationSchedules returns the schedules of the operations in the config that apply to the machine named by hostname,
+// which is usually os.Hostname. The operations that are not valid are left out, and described by the error.
+func OperationSchedules(hostname func() (string, error)) (map[string]*Schedule, error) {
+	var errs []error
+	schedules := make(map[string]*Schedule)
+
+	err := checkLogSection(viper.Get(logSettingsKey))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, key := range ApplicableOperations(hostname) {
+		config, err := getConfiguration(key, hostname)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("operation \"%s\" is not valid: %s", key, err))
+		} else if config.schedule != nil {
+			schedules[key] = config.schedule
+		}
+	}
+
+	return schedules, errors.Join(errs...)
+}
+
+// SetSchedules replaces the schedules of the operations. The next run of an operation whose schedule has not
+// changed stays the same, while an operation with an interval that has not run for that long runs straight away.
+func (scheduler *Scheduler) SetSchedules(schedules map[string]*Schedule) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	now := scheduler.now()
+	nextRuns := make(map[string]time.Time, len(schedules))
+	for key, schedule := range schedules {
+		existing, ok := scheduler.schedules[key]
+		if ok && existing.String() == schedule.String() {
+			nextRuns[key] = scheduler.nextRuns[key]
+			continue
+		}
+
+		lastRun, hasRun := scheduler.lastRun(key)
+		nextRuns[key] = schedule.firstRun(now, lastRun, hasRun)
+	}
+
+	scheduler.schedules = schedules
+	scheduler.nextRuns = nextRuns
+
+	// operations that are no longer scheduled are not run, even when they were already waiting to
+	queue := scheduler.queue[:0]
+	for _, key := range scheduler.queue {
+		if _, ok := schedules[key]; ok {
+			queue = append(queue, key)
+		} else {
+			delete(scheduler.pending, key)
+		}
+	}
+	scheduler.queue = queue
+
+	select {
+	case scheduler.changed <- struct{}{}:
+	default:
+	}
+}
+
+// NextRuns returns when each scheduled operation runs next.
+func (scheduler *Scheduler) NextRuns() map[string]time.Time {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	nextRuns := make(map[string]time.Time, len(scheduler.nextRuns))
+	for key, next := range scheduler.nextRuns {
+		nextRuns[key] = next
+	}
+
+	return nextRuns
+}
+
+// Run runs the operations on their schedules until the context is cancelled, and the run in progress has stopped.
+func (scheduler *Scheduler) Run(ctx context.Context) {
+	var worker sync.WaitGroup
+
+	worker.Add(1)
+	go func() {
+		defer worker.Done()
+		scheduler.runQueued(ctx)
+	}()
+
+	for {
+		wake := scheduler.queueDueRuns()
+
+		// with nothing scheduled, only a change of schedules or the context can wake the scheduler
+		var timer *time.Timer
+		var timerFired <-chan time.Time
+		if !wake.IsZero() {
+			timer = time.NewTimer(wake.Sub(scheduler.now()))
+			timerFired = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-scheduler.changed:
+		case <-timerFired:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			worker.Wait()
+			return
+		}
+	}
+}
+
+// queueDueRuns queues the operations that have come due, and returns when the next one is due.
+func (scheduler *Scheduler) queueDueRuns() time.Time {
+	var wake time.Time
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	keys := make([]string, 0, len(scheduler.nextRuns))
+	for key := range scheduler.nextRuns {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	now := scheduler.now()
+	for _, key := range keys {
+		next := scheduler.nextRuns[key]
+		if !next.After(now) {
+			if scheduler.pending[key] {
+				PrintWarning(fmt.Sprintf("operation \"%s\" is still running from its last scheduled run, so this run was skipped", key))
+			} else {
+				scheduler.pending[key] = true
+				scheduler.queue = append(scheduler.queue, key)
+				select {
+				case scheduler.ready <- struct{}{}:
+				default:
+				}
+			}
+
+			next = scheduler.schedules[key].Next(now)
+			scheduler.nextRuns[key] = next
+		}
+
+		if !next.IsZero() && (wake.IsZero() || next.Before(wake)) {
+			wake = next
+		}
+	}
+
+	return wake
+}
+
+// runQueued runs the queued operations, one at a time, until the context is cancelled.
+func (scheduler *Scheduler) runQueued(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-scheduler.ready:
+		}
+
+		for ctx.Err() == nil {
+			key, ok := scheduler.nextQueued()
+			if !ok {
+				break
+			}
+
+			scheduler.run(ctx, key)
+
+			scheduler.mutex.Lock()
+			delete(scheduler.pending, key)
+			scheduler.mutex.Unlock()
+		}
+	}
+}
+
+// nextQueued takes the first operation off the queue.
+func (scheduler *Scheduler) nextQueued() (string, bool) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	if len(scheduler.queue) == 0 {
+		return "", false
+	}
+
+	key := scheduler.queue[0]
+	scheduler.queue = scheduler.queue[1:]
+
+	return key, true
+}
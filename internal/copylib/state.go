@@ -0,0 +1,32 @@
+package copylib
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// stateDirectory returns the folder where go-copy keeps what it remembers between runs.
+// GO_COPY_STATE_DIR overrides the default, which follows the conventions of the OS.
+func stateDirectory() (string, error) {
+	if stateDir := os.Getenv("GO_COPY_STATE_DIR"); len(stateDir) > 0 {
+		return stateDir, nil
+	}
+
+	if runtime.GOOS == "windows" {
+		if localAppData := os.Getenv("LOCALAPPDATA"); len(localAppData) > 0 {
+			return filepath.Join(localAppData, "go-copy"), nil
+		}
+	}
+
+	if stateHome := os.Getenv("XDG_STATE_HOME"); len(stateHome) > 0 {
+		return filepath.Join(stateHome, "go-copy"), nil
+	}
+
+	homeFolder, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeFolder, ".local", "state", "go-copy"), nil
+}
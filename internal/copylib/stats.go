@@ -0,0 +1,106 @@
+package copylib
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Stats are the counts and timings of a run. The totals count each file once for every destination it was
+// meant for, while the source file counts count each file once, however many destinations there are.
+type Stats struct {
+	// NumberOfSourceFiles is how many source files were copied or skipped at every destination.
+	NumberOfSourceFiles int `json:"source_files"`
+	// NumberOfFailedFiles is how many source files could not be copied to at least one destination.
+	NumberOfFailedFiles int `json:"failed_files"`
+	// NumberOfDestinations is how many destinations were online for the run.
+	NumberOfDestinations int           `json:"destinations"`
+	TotalFilesSkipped    int           `json:"files_skipped"`
+	TotalFilesCopied     int           `json:"files_copied"`
+	TotalFilesFailed     int           `json:"files_failed"`
+	TotalRetries         int           `json:"retries"`
+	BytesCopied          int64         `json:"bytes_copied"`
+	StartTime            time.Time     `json:"start_time"`
+	TimeToCopy           time.Duration `json:"time_to_copy_ns"`
+	NumberOfWarnings     int           `json:"warnings"`
+	NumberOfErrors       int           `json:"errors"`
+	Interrupted          bool          `json:"interrupted"`
+	// Destinations has the counts for each enabled destination, in the order of the config.
+	Destinations []DestinationStats `json:"per_destination"`
+}
+
+// DestinationStats are the counts for a single destination of a run.
+type DestinationStats struct {
+	// Destination is the label of the destination, or its path if it does not have a label.
+	Destination  string `json:"destination"`
+	Path         string `json:"path"`
+	Online       bool   `json:"online"`
+	FilesCopied  int    `json:"files_copied"`
+	FilesSkipped int    `json:"files_skipped"`
+	FilesFailed  int    `json:"files_failed"`
+	Retries      int    `json:"retries"`
+	BytesCopied  int64  `json:"bytes_copied"`
+}
+
+// Outcome summarises the run as "success", "partial" when some files were handled despite errors, "failed",
+// or "interrupted" when it was cancelled before it finished.
+func (stats *Stats) Outcome() string {
+	if stats.Interrupted {
+		return "interrupted"
+	} else if stats.NumberOfErrors == 0 {
+		return "success"
+	} else if stats.TotalFilesCopied > 0 || stats.TotalFilesSkipped > 0 {
+		return "partial"
+	}
+
+	return "failed"
+}
+
+// LogValue gives the outcome, the totals and the stats of each destination as slog attributes, so they read as well
+// in a text log as in JSON.
+func (stats *Stats) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("result", stats.Outcome()),
+		slog.Int("source_files", stats.NumberOfSourceFiles),
+		slog.Int("failed_files", stats.NumberOfFailedFiles),
+		slog.Int("destinations", stats.NumberOfDestinations),
+		slog.Int("files_copied", stats.TotalFilesCopied),
+		slog.Int("files_skipped", stats.TotalFilesSkipped),
+		slog.Int("files_failed", stats.TotalFilesFailed),
+		slog.Int("retries", stats.TotalRetries),
+		slog.Int64("bytes_copied", stats.BytesCopied),
+		slog.Duration("time_to_copy", stats.TimeToCopy),
+		slog.Int("warnings", stats.NumberOfWarnings),
+		slog.Int("errors", stats.NumberOfErrors),
+		slog.Bool("interrupted", stats.Interrupted),
+		slog.Any("per_destination", stats.Destinations),
+	)
+}
+
+// destinationStats returns the stats of the destination.
+func (fileCopier *fileCopier) destinationStats(dest *destination) *DestinationStats {
+	return &fileCopier.stats.Destinations[fileCopier.destinationIndex[dest]]
+}
+
+func (fileCopier *fileCopier) countCopied(dest *destination, bytesCopied int64) {
+	fileCopier.stats.TotalFilesCopied++
+	fileCopier.stats.BytesCopied += bytesCopied
+
+	destStats := fileCopier.destinationStats(dest)
+	destStats.FilesCopied++
+	destStats.BytesCopied += bytesCopied
+}
+
+func (fileCopier *fileCopier) countSkipped(dest *destination) {
+	fileCopier.stats.TotalFilesSkipped++
+	fileCopier.destinationStats(dest).FilesSkipped++
+}
+
+func (fileCopier *fileCopier) countFailed(dest *destination) {
+	fileCopier.stats.TotalFilesFailed++
+	fileCopier.destinationStats(dest).FilesFailed++
+}
+
+func (fileCopier *fileCopier) countRetry(dest *destination) {
+	fileCopier.stats.TotalRetries++
+	fileCopier.destinationStats(dest).Retries++
+}
@@ -0,0 +1,178 @@
+package copylib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Status is how far behind each destination of an operation is: what the next copy would do, without doing it.
+type Status struct {
+	Operation   string `json:"operation"`
+	SourceFiles int    `json:"source_files"`
+	SourceBytes int64  `json:"source_bytes"`
+	Interrupted bool   `json:"interrupted"`
+	// Destinations has the status of each enabled destination, in the order of the config.
+	Destinations []DestinationStatus `json:"destinations"`
+}
+
+// DestinationStatus counts the files the next copy would copy, replace or skip at a destination.
+type DestinationStatus struct {
+	Destination string `json:"destination"`
+	Path        string `json:"path"`
+	// Online is false for an optional destination the next copy would skip, as neither it nor its parent folder exist.
+	Online         bool  `json:"online"`
+	FilesToCopy    int   `json:"files_to_copy"`
+	BytesToCopy    int64 `json:"bytes_to_copy"`
+	FilesToReplace int   `json:"files_to_replace"`
+	BytesToReplace int64 `json:"bytes_to_replace"`
+	FilesToSkip    int   `json:"files_to_skip"`
+	FilesExcluded  int   `json:"files_excluded"`
+	// Files are the files that would be copied or replaced, by their path relative to the source.
+	Files []PendingFile `json:"files"`
+}
+
+// PendingFile is a file the next copy would copy to a destination, or replace there when Replace is set.
+type PendingFile struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Replace bool   `json:"replace"`
+}
+
+// Status works out what the next copy of the operation would do at each of its destinations, using the same replace
+// rules as a copy, but looking at the files themselves rather than at any manifests.
+func (snapshot *OperationSnapshot) Status(ctx context.Context) (*Status, error) {
+	return configurationStatus(ctx, snapshot.key, snapshot.config, OSFilesystem{})
+}
+
+// configurationStatus works out what the next copy of the configuration would do at each enabled destination.
+func configurationStatus(ctx context.Context, operationKey string, config *configuration, filesystem SourceFilesystem) (*Status, error) {
+	status := &Status{Operation: operationKey}
+
+	sourceFiles, err := listFiles(ctx, filesystem, config.source)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the source %s: %s", config.source, err)
+	}
+	status.SourceFiles = len(sourceFiles)
+
+	sourcePaths := make([]string, 0, len(sourceFiles))
+	for relativePath, info := range sourceFiles {
+		sourcePaths = append(sourcePaths, relativePath)
+		status.SourceBytes += info.Size()
+	}
+	sort.Strings(sourcePaths)
+
+	for index := range config.destinations {
+		dest := &config.destinations[index]
+		if !dest.enabled {
+			continue
+		}
+		destStatus := DestinationStatus{Destination: dest.displayName(), Path: dest.path, Files: []PendingFile{}}
+
+		destFiles, err := listFiles(ctx, filesystem, dest.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			// the copy creates a destination that does not exist yet, unless it is optional and its parent is missing too
+			_, err = filesystem.Stat(filepath.Dir(dest.path))
+			if !dest.required && err != nil {
+				status.Destinations = append(status.Destinations, destStatus)
+				continue
+			}
+			destFiles = map[string]fs.FileInfo{}
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read destination %s: %s", dest.displayName(), err)
+		}
+		destStatus.Online = true
+
+		for _, relativePath := range sourcePaths {
+			if ctx.Err() != nil {
+				break
+			} else if dest.isExcluded(relativePath) {
+				destStatus.FilesExcluded++
+				continue
+			}
+
+			sourceInfo := sourceFiles[relativePath]
+			destInfo, exists := destFiles[relativePath]
+			switch {
+			case !exists:
+				destStatus.FilesToCopy++
+				destStatus.BytesToCopy += sourceInfo.Size()
+			case len(skipReason(dest.replace, sourceInfo, destInfo)) > 0:
+				destStatus.FilesToSkip++
+				continue
+			default:
+				destStatus.FilesToReplace++
+				destStatus.BytesToReplace += sourceInfo.Size()
+			}
+			destStatus.Files = append(destStatus.Files, PendingFile{Path: relativePath, Size: sourceInfo.Size(), Replace: exists})
+		}
+
+		status.Destinations = append(status.Destinations, destStatus)
+	}
+
+	status.Interrupted = ctx.Err() != nil
+
+	return status, nil
+}
+
+// Print displays a table with what the next copy would do at each destination, optionally followed by the files it
+// would copy or replace, or writes the whole status to stdout as JSON.
+func (status *Status) Print(format string, listPendingFiles bool) error {
+	switch format {
+	case ListFormatTable:
+	case ListFormatJSON:
+		contents, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, string(contents))
+		return nil
+	default:
+		return fmt.Errorf("unknown status format \"%s\"; expected table or json", format)
+	}
+
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "DESTINATION\tONLINE\tCOPY\tREPLACE\tSKIP\tEXCLUDED\tBYTES")
+	for index := range status.Destinations {
+		destStatus := &status.Destinations[index]
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%d\t%d\t%s\n", destStatus.Destination, yesNo(destStatus.Online),
+			destStatus.FilesToCopy, destStatus.FilesToReplace, destStatus.FilesToSkip, destStatus.FilesExcluded,
+			formatBytes(uint64(destStatus.BytesToCopy+destStatus.BytesToReplace)))
+	}
+	writer.Flush()
+
+	PrintKeyValue("Operation: ", status.Operation)
+	PrintKeyValue("  Source Files: ", fmt.Sprintf("%d (%s)", status.SourceFiles, formatBytes(uint64(status.SourceBytes))))
+	lines := strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n")
+	PrintKeyValueArray("  Destinations: ", lines)
+
+	if listPendingFiles {
+		for index := range status.Destinations {
+			destStatus := &status.Destinations[index]
+			if len(destStatus.Files) == 0 {
+				continue
+			}
+
+			lines := make([]string, 0, len(destStatus.Files))
+			for _, file := range destStatus.Files {
+				action := "copy   "
+				if file.Replace {
+					action = "replace"
+				}
+				lines = append(lines, fmt.Sprintf("%s  %s (%s)", action, file.Path, formatBytes(uint64(file.Size))))
+			}
+			PrintKeyValueArray(fmt.Sprintf("  %s: ", destStatus.Destination), lines)
+		}
+	}
+
+	return nil
+}
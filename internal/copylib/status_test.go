@@ -0,0 +1,61 @@
+package copylib
+
+import (
+	"context"
+	"path"
+	"testing"
+)
+
+func TestOperationStatusSuccess(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, true)
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.destinations[1].replace = replaceNever
+	config.destinations[2].exclude = []string{"subdir001/*"}
+	newTestRunner(config, filesystem).Copy(context.Background())
+
+	writeTestFile(t, filesystem, path.Join(testSource, "foobar002.txt"), 100)
+	writeTestFile(t, filesystem, path.Join(testSource, "subdir001", "foobar007.txt"), 50)
+	config.destinations = append(config.destinations, newTestDestinations([]string{"/backups/j/foobar/saves"}, replaceAlways)...)
+	config.destinations = append(config.destinations, newTestDestinations([]string{"/offline/k/saves"}, replaceAlways)...)
+	config.destinations[4].required = false
+
+	status, err := configurationStatus(context.Background(), "foo", config, filesystem)
+	if err != nil {
+		t.Fatalf("unexpected error getting the status: %s", err)
+	}
+	if status.SourceFiles != 7 || len(status.Destinations) != 5 {
+		t.Fatalf("expected 7 source files and 5 destinations, but got %d and %d", status.SourceFiles, len(status.Destinations))
+	}
+
+	tests := []struct {
+		online    bool
+		copied    int
+		replaced  int
+		skipped   int
+		excluded  int
+		bytes     int64
+		firstFile PendingFile
+	}{
+		{true, 1, 1, 5, 0, 150, PendingFile{Path: "foobar002.txt", Size: 100, Replace: true}},
+		{true, 1, 0, 6, 0, 50, PendingFile{Path: "subdir001/foobar007.txt", Size: 50}},
+		{true, 0, 1, 2, 4, 100, PendingFile{Path: "foobar002.txt", Size: 100, Replace: true}},
+		{true, 7, 0, 0, 0, 198790, PendingFile{Path: "foobar001.txt", Size: 8600}},
+		{false, 0, 0, 0, 0, 0, PendingFile{}},
+	}
+
+	for index, test := range tests {
+		destStatus := status.Destinations[index]
+		if destStatus.Online != test.online || destStatus.FilesToCopy != test.copied || destStatus.FilesToReplace != test.replaced ||
+			destStatus.FilesToSkip != test.skipped || destStatus.FilesExcluded != test.excluded ||
+			destStatus.BytesToCopy+destStatus.BytesToReplace != test.bytes {
+			t.Errorf("unexpected status for destination %s: %+v", destStatus.Destination, destStatus)
+		}
+		if len(destStatus.Files) != test.copied+test.replaced {
+			t.Errorf("expected %d pending files for destination %s, but got %d", test.copied+test.replaced, destStatus.Destination, len(destStatus.Files))
+		} else if len(destStatus.Files) > 0 && destStatus.Files[0] != test.firstFile {
+			t.Errorf("expected the first pending file for destination %s to be %+v, but got %+v", destStatus.Destination, test.firstFile, destStatus.Files[0])
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package copylib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const defaultDateLayout = "2006-01-02"
+
+// placeholderPattern finds the placeholders, such as {host} or {date:2006-01-02}, in a path. A placeholder is a name,
+// optionally followed by a colon and a layout, so other text in braces, such as the GUID folders on Windows, is left as it is.
+var placeholderPattern = regexp.MustCompile(`\{([A-Za-z][A-Za-z0-9_]*(?::[^{}]*)?)\}`)
+
+// templateValues are what the placeholders in a path are replaced with.
+type templateValues struct {
+	now       time.Time
+	host      string
+	operation string
+}
+
+// validatePathTemplate checks that every placeholder in the path is one that can be expanded.
+func validatePathTemplate(pathTemplate string) error {
+	for _, match := range placeholderPattern.FindAllStringSubmatch(pathTemplate, -1) {
+		name, layout, hasLayout := strings.Cut(match[1], ":")
+		switch name {
+		case "date":
+			if hasLayout && len(layout) == 0 {
+				return fmt.Errorf("the placeholder %s needs a time layout after the colon, such as {date:%s}", match[0], defaultDateLayout)
+			}
+		case "host", "operation":
+			if hasLayout {
+				return fmt.Errorf("the placeholder %s does not take a layout", match[0])
+			}
+		default:
+			return fmt.Errorf("unknown placeholder %s; expected {date}, {date:<layout>}, {host} or {operation}", match[0])
+		}
+	}
+
+	return nil
+}
+
+// expandPathTemplate replaces the placeholders in the path with their values.
+// Dates are formatted with Go time layouts, and default to the 2006-01-02 layout.
+func expandPathTemplate(pathTemplate string, values templateValues) string {
+	return placeholderPattern.ReplaceAllStringFunc(pathTemplate, func(placeholder string) string {
+		name, layout, hasLayout := strings.Cut(placeholder[1:len(placeholder)-1], ":")
+		switch name {
+		case "date":
+			if !hasLayout {
+				layout = defaultDateLayout
+			}
+			return values.now.Format(layout)
+		case "host":
+			return values.host
+		case "operation":
+			return values.operation
+		}
+
+		return placeholder
+	})
+}
+
+// expandPathTemplates replaces the placeholders in every destination path, using the same time for all of them,
+// so a single run always copies into the same dated folders. The hostname function returns the name of this machine.
+func (config *configuration) expandPathTemplates(now time.Time, hostname func() (string, error)) error {
+	values := templateValues{
+		now:       now,
+		operation: config.key,
+	}
+	if len(values.operation) == 0 {
+		values.operation = config.name
+	}
+
+	for index := range config.destinations {
+		dest := &config.destinations[index]
+		if !placeholderPattern.MatchString(dest.path) {
+			continue
+		}
+
+		if len(values.host) == 0 {
+			host, err := hostname()
+			if err != nil {
+				return fmt.Errorf("the name of this host could not be found: %s", err)
+			}
+			values.host = host
+		}
+
+		dest.path = expandPathTemplate(dest.path, values)
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package copylib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Verification is what verify found when it compared each destination of an operation to its source.
+type Verification struct {
+	Operation string `json:"operation"`
+	// SourceFiles is how many files are in the source.
+	SourceFiles int  `json:"source_files"`
+	Checksum    bool `json:"checksum"`
+	Interrupted bool `json:"interrupted"`
+	// Destinations has what was found at each enabled destination, in the order of the config.
+	Destinations []DestinationVerification `json:"destinations"`
+}
+
+// DestinationVerification lists the files at a destination that do not match the source, by their path relative to it.
+type DestinationVerification struct {
+	Destination string `json:"destination"`
+	Path        string `json:"path"`
+	Online      bool   `json:"online"`
+	Required    bool   `json:"required"`
+	// Checked is how many source files were compared with their copy at the destination.
+	Checked int `json:"checked"`
+	// Missing are source files that are not at the destination, while Extra are files at the destination that are
+	// not in the source, which is expected for files deleted from the source, as go-copy never deletes anything.
+	Missing []string `json:"missing"`
+	Extra   []string `json:"extra"`
+	// SizeDiffers, ModTimeDiffers and ContentDiffers are files whose copy has a different size, modified time, or,
+	// when checksums are compared, contents. A file is only listed under the first difference found.
+	SizeDiffers    []string `json:"size_differs"`
+	ModTimeDiffers []string `json:"mtime_differs"`
+	ContentDiffers []string `json:"content_differs"`
+	// Errors are why the destination, or some of the files in it, could not be verified.
+	Errors []string `json:"errors"`
+}
+
+// Verify compares every destination of the operation to its source, without copying anything. With checksum, files
+// that match in size and modified time have their contents compared as well, which reads every file in full.
+func (snapshot *OperationSnapshot) Verify(ctx context.Context, checksum bool) (*Verification, error) {
+	return verifyConfiguration(ctx, snapshot.key, snapshot.config, OSFilesystem{}, checksum)
+}
+
+// verifyConfiguration compares each enabled destination of the configuration to its source.
+func verifyConfiguration(ctx context.Context, operationKey string, config *configuration, filesystem SourceFilesystem, checksum bool) (*Verification, error) {
+	verification := &Verification{Operation: operationKey, Checksum: checksum}
+
+	sourceFiles, err := listFiles(ctx, filesystem, config.source)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the source %s: %s", config.source, err)
+	}
+	verification.SourceFiles = len(sourceFiles)
+
+	sourcePaths := make([]string, 0, len(sourceFiles))
+	for relativePath := range sourceFiles {
+		sourcePaths = append(sourcePaths, relativePath)
+	}
+	sort.Strings(sourcePaths)
+
+	// the hash of each source file is only worked out once, however many destinations there are
+	sourceHashes := make(map[string]string)
+
+	for index := range config.destinations {
+		dest := &config.destinations[index]
+		if !dest.enabled {
+			continue
+		}
+		destVerification := DestinationVerification{
+			Destination:    dest.displayName(),
+			Path:           dest.path,
+			Required:       dest.required,
+			Missing:        []string{},
+			Extra:          []string{},
+			SizeDiffers:    []string{},
+			ModTimeDiffers: []string{},
+			ContentDiffers: []string{},
+			Errors:         []string{},
+		}
+
+		destFiles, err := listFiles(ctx, filesystem, dest.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			verification.Destinations = append(verification.Destinations, destVerification)
+			continue
+		}
+		destVerification.Online = true
+		if err != nil {
+			// the other destinations are still verified, so one that cannot be read does not hide what they have
+			destVerification.Errors = append(destVerification.Errors, fmt.Sprintf("unable to read the destination: %s", err))
+			verification.Destinations = append(verification.Destinations, destVerification)
+			continue
+		}
+
+		for _, relativePath := range sourcePaths {
+			if ctx.Err() != nil {
+				break
+			} else if dest.isExcluded(relativePath) {
+				continue
+			}
+
+			destVerification.Checked++
+			sourceInfo := sourceFiles[relativePath]
+			destInfo, ok := destFiles[relativePath]
+			switch {
+			case !ok:
+				destVerification.Missing = append(destVerification.Missing, relativePath)
+			case destInfo.Size() != sourceInfo.Size():
+				destVerification.SizeDiffers = append(destVerification.SizeDiffers, relativePath)
+			case !destInfo.ModTime().Equal(sourceInfo.ModTime()):
+				destVerification.ModTimeDiffers = append(destVerification.ModTimeDiffers, relativePath)
+			case checksum:
+				same, err := sameContents(filesystem, config.source, dest.path, relativePath, sourceHashes)
+				if err != nil {
+					destVerification.Errors = append(destVerification.Errors, err.Error())
+				} else if !same {
+					destVerification.ContentDiffers = append(destVerification.ContentDiffers, relativePath)
+				}
+			}
+		}
+
+		for relativePath := range destFiles {
+			if _, ok := sourceFiles[relativePath]; !ok {
+				destVerification.Extra = append(destVerification.Extra, relativePath)
+			}
+		}
+		sort.Strings(destVerification.Extra)
+
+		verification.Destinations = append(verification.Destinations, destVerification)
+	}
+
+	verification.Interrupted = ctx.Err() != nil
+
+	return verification, nil
+}
+
+// listFiles returns every regular file in the folder and the folders inside it, keyed by its path relative to
+// the folder. The manifest, and partial files left by a copy that was stopped, are not included.
+func listFiles(ctx context.Context, filesystem SourceFilesystem, folder string) (map[string]fs.FileInfo, error) {
+	files := make(map[string]fs.FileInfo)
+
+	_, err := filesystem.Stat(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	var listFolder func(relativeFolder string) error
+	listFolder = func(relativeFolder string) error {
+		entries, err := filesystem.ReadDir(path.Join(folder, relativeFolder))
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			relativePath := path.Join(relativeFolder, entry.Name())
+			if entry.IsDir() {
+				err = listFolder(relativePath)
+				if err != nil {
+					return err
+				}
+			} else if entry.Type().IsRegular() && !isManifestFile(relativePath) && !strings.HasSuffix(relativePath, partialFileSuffix) {
+				info, err := entry.Info()
+				if err != nil {
+					return err
+				}
+				files[relativePath] = info
+			}
+		}
+
+		return nil
+	}
+
+	return files, listFolder("")
+}
+
+// sameContents compares the SHA-256 of a source file and its copy at the destination.
+func sameContents(filesystem SourceFilesystem, source string, destPath string, relativePath string, sourceHashes map[string]string) (bool, error) {
+	sourceHash, ok := sourceHashes[relativePath]
+	if !ok {
+		var err error
+		sourceHash, err = hashFile(filesystem, path.Join(source, relativePath))
+		if err != nil {
+			return false, fmt.Errorf("unable to read the source file %s: %s", relativePath, err)
+		}
+		sourceHashes[relativePath] = sourceHash
+	}
+
+	destHash, err := hashFile(filesystem, path.Join(destPath, relativePath))
+	if err != nil {
+		return false, fmt.Errorf("unable to read %s at %s: %s", relativePath, destPath, err)
+	}
+
+	return sourceHash == destHash, nil
+}
+
+// HasDrift checks if the destination is missing files, or has copies that differ from the source.
+// Extra files are not drift, and neither is an optional destination that is offline.
+func (destVerification *DestinationVerification) HasDrift() bool {
+	if !destVerification.Online {
+		return destVerification.Required
+	}
+
+	return len(destVerification.Missing)+len(destVerification.SizeDiffers)+len(destVerification.ModTimeDiffers)+
+		len(destVerification.ContentDiffers) > 0
+}
+
+// HasErrors checks if any of the destinations, or any of the files in them, could not be verified.
+func (verification *Verification) HasErrors() bool {
+	for index := range verification.Destinations {
+		if len(verification.Destinations[index].Errors) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasDrift checks if any of the destinations have drifted from the source.
+func (verification *Verification) HasDrift() bool {
+	for index := range verification.Destinations {
+		if verification.Destinations[index].HasDrift() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Print displays a table with the differences found at each destination, followed by the files that differ,
+// or writes the whole verification to stdout as JSON. In the table, extra files are only listed at the debug
+// level, as there are usually many of them.
+func (verification *Verification) Print(format string) error {
+	switch format {
+	case ListFormatTable:
+	case ListFormatJSON:
+		contents, err := json.MarshalIndent(verification, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, string(contents))
+		return nil
+	default:
+		return fmt.Errorf("unknown verify format \"%s\"; expected table or json", format)
+	}
+
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "DESTINATION\tONLINE\tCHECKED\tMISSING\tSIZE\tMTIME\tCONTENT\tEXTRA\tERRORS\tDRIFT")
+	for index := range verification.Destinations {
+		destVerification := &verification.Destinations[index]
+		content := "-"
+		if verification.Checksum {
+			content = fmt.Sprintf("%d", len(destVerification.ContentDiffers))
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t%d\t%d\t%s\n", destVerification.Destination, yesNo(destVerification.Online),
+			destVerification.Checked, len(destVerification.Missing), len(destVerification.SizeDiffers),
+			len(destVerification.ModTimeDiffers), content, len(destVerification.Extra), len(destVerification.Errors),
+			yesNo(destVerification.HasDrift()))
+	}
+	writer.Flush()
+
+	PrintKeyValue("Operation: ", verification.Operation)
+	PrintKeyValue("  Source Files: ", fmt.Sprintf("%d", verification.SourceFiles))
+	lines := strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n")
+	PrintKeyValueArray("  Destinations: ", lines)
+
+	for index := range verification.Destinations {
+		destVerification := &verification.Destinations[index]
+		for _, difference := range []struct {
+			description string
+			paths       []string
+		}{
+			{"missing", destVerification.Missing},
+			{"different size", destVerification.SizeDiffers},
+			{"different modified time", destVerification.ModTimeDiffers},
+			{"different contents", destVerification.ContentDiffers},
+		} {
+			for _, relativePath := range difference.paths {
+				PrintInfo(fmt.Sprintf("%s at %s: %s", difference.description, destVerification.Destination, relativePath))
+			}
+		}
+		for _, relativePath := range destVerification.Extra {
+			PrintDebug(fmt.Sprintf("extra at %s: %s", destVerification.Destination, relativePath))
+		}
+		for _, verifyError := range destVerification.Errors {
+			PrintError(fmt.Sprintf("unable to verify at %s: %s", destVerification.Destination, verifyError))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package copylib
+
+import (
+	"context"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySuccess(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, true)
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.manifest = manifestSettings{enabled: true}
+	config.destinations[2].exclude = []string{"subdir001/*"}
+	newTestRunner(config, filesystem).Copy(context.Background())
+
+	verification, err := verifyConfiguration(context.Background(), "foo", config, filesystem, true)
+	if err != nil {
+		t.Fatalf("unexpected error verifying: %s", err)
+	}
+	if verification.HasDrift() || verification.SourceFiles != 6 || len(verification.Destinations) != 3 {
+		t.Fatalf("expected no drift across 3 destinations for 6 files, but got %+v", verification)
+	}
+	if checked := verification.Destinations[2].Checked; checked != 3 {
+		t.Errorf("expected the excluded files not to be checked, but %d were", checked)
+	}
+
+	// drift each destination in a different way
+	modTime := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	mustSucceed := func(err error) {
+		if err != nil {
+			t.Fatalf("error changing a destination: %s", err)
+		}
+	}
+	mustSucceed(filesystem.Remove(path.Join(testDestinationPaths[0], "foobar001.txt")))
+	mustSucceed(filesystem.Chtimes(path.Join(testDestinationPaths[0], "foobar003.txt"), modTime, modTime.Add(time.Hour)))
+	writeTestFile(t, filesystem, path.Join(testDestinationPaths[1], "subdir001", "foobar005.txt"), 10)
+	changedFilename := path.Join(testDestinationPaths[1], "foobar002.txt")
+	mustSucceed(filesystem.WriteFile(changedFilename, []byte(strings.Repeat("y", 8640)), 0644))
+	mustSucceed(filesystem.Chtimes(changedFilename, modTime, modTime))
+	writeTestFile(t, filesystem, path.Join(testDestinationPaths[2], "deleted.txt"), 10)
+	writeTestFile(t, filesystem, path.Join(testDestinationPaths[2], "foobar001.txt"+partialFileSuffix), 10)
+
+	verification, err = verifyConfiguration(context.Background(), "foo", config, filesystem, false)
+	if err != nil {
+		t.Fatalf("unexpected error verifying: %s", err)
+	}
+
+	first := verification.Destinations[0]
+	if strings.Join(first.Missing, ",") != "foobar001.txt" || strings.Join(first.ModTimeDiffers, ",") != "foobar003.txt" {
+		t.Errorf("expected a missing file and a changed modified time at the first destination, but got %+v", first)
+	}
+	second := verification.Destinations[1]
+	if strings.Join(second.SizeDiffers, ",") != "subdir001/foobar005.txt" || len(second.ContentDiffers) != 0 {
+		t.Errorf("expected only the size difference at the second destination without checksums, but got %+v", second)
+	}
+	third := verification.Destinations[2]
+	if third.HasDrift() || strings.Join(third.Extra, ",") != "deleted.txt" {
+		t.Errorf("expected only the deleted file to be extra at the third destination, but got %+v", third)
+	}
+	if !verification.HasDrift() {
+		t.Errorf("expected the verification to have drift")
+	}
+
+	verification, err = verifyConfiguration(context.Background(), "foo", config, filesystem, true)
+	if err != nil {
+		t.Fatalf("unexpected error verifying: %s", err)
+	}
+	if contentDiffers := verification.Destinations[1].ContentDiffers; strings.Join(contentDiffers, ",") != "foobar002.txt" {
+		t.Errorf("expected the changed contents to be found with checksums, but got %v", contentDiffers)
+	}
+}
+
+func TestVerifyFailure(t *testing.T) {
+	t.Parallel()
+
+	filesystem := newTestFilesystem(t, false)
+	config := newTestConfiguration(replaceSkipIfSame)
+	config.destinations[1].required = false
+
+	verification, err := verifyConfiguration(context.Background(), "foo", config, filesystem, false)
+	if err != nil {
+		t.Fatalf("unexpected error verifying: %s", err)
+	}
+	if verification.Destinations[0].Online || !verification.Destinations[0].HasDrift() {
+		t.Errorf("expected a required destination that is offline to be drift")
+	}
+	if verification.Destinations[1].HasDrift() {
+		t.Errorf("expected an optional destination that is offline not to be drift")
+	}
+
+	// a destination that cannot be read, or files that cannot be hashed, are recorded, and the others are still verified
+	newTestRunner(newTestConfiguration(replaceSkipIfSame), filesystem).Copy(context.Background())
+	config = newTestConfiguration(replaceSkipIfSame)
+	mustSucceed := func(err error) {
+		if err != nil {
+			t.Fatalf("error changing a destination: %s", err)
+		}
+	}
+	mustSucceed(filesystem.Rename(testDestinationPaths[0], "/backups/moved"))
+	mustSucceed(filesystem.WriteFile(testDestinationPaths[0], []byte("not a folder"), 0644))
+	verification, err = verifyConfiguration(context.Background(), "foo", config, filesystem, false)
+	if err != nil {
+		t.Fatalf("unexpected error verifying with an unreadable destination: %s", err)
+	}
+	if len(verification.Destinations[0].Errors) != 1 || verification.Destinations[1].Checked != 3 || !verification.HasErrors() {
+		t.Errorf("expected the unreadable destination to be recorded and the others verified, but got %+v", verification.Destinations)
+	}
+
+	unreadable := &failingFilesystem{MemoryFilesystem: filesystem, failOpen: true}
+	verification, err = verifyConfiguration(context.Background(), "foo", config, unreadable, true)
+	if err != nil {
+		t.Fatalf("unexpected error verifying files that cannot be read: %s", err)
+	}
+	if errs := verification.Destinations[2].Errors; len(errs) != 3 || verification.Destinations[2].Checked != 3 {
+		t.Errorf("expected an error for each file that could not be hashed, but got %v", errs)
+	}
+
+	config.source = "/games/missing"
+	_, err = verifyConfiguration(context.Background(), "foo", config, filesystem, false)
+	if err == nil {
+		t.Errorf("expected an error verifying a source that does not exist")
+	}
+}
@@ -0,0 +1,177 @@
+package copylib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// SourceWatcher watches a source folder, and every folder inside it, for files that change.
+// The changes are collected until they stop for a while, so a burst of writes is copied once, as a single batch.
+// Watching needs notifications from the OS, so unlike the copy itself it always uses the filesystem of the OS.
+type SourceWatcher struct {
+	source   string
+	delay    time.Duration
+	maxDelay time.Duration
+	watcher  *fsnotify.Watcher
+	// changed holds the paths that changed since the last batch, relative to the source
+	changed map[string]bool
+	// firstChange is when the oldest change in the batch was seen
+	firstChange time.Time
+}
+
+// NewSourceWatcher starts watching the source folder. A batch of changes is handed over once there have been no
+// more changes for delay, or once maxDelay has passed since the first change, even if the files are still changing.
+func NewSourceWatcher(source string, delay time.Duration, maxDelay time.Duration) (*SourceWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	sourceWatcher := &SourceWatcher{
+		source:   filepath.Clean(source),
+		delay:    delay,
+		maxDelay: max(delay, maxDelay),
+		watcher:  watcher,
+		changed:  make(map[string]bool),
+	}
+
+	err = sourceWatcher.addFolder(sourceWatcher.source)
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	return sourceWatcher, nil
+}
+
+// OperationSource returns the source folder of the operation with the given key in the loaded config file, if it applies
+// to the machine named by hostname, which is usually os.Hostname.
+func OperationSource(key string, hostname func() (string, error)) (string, error) {
+	config, err := getConfiguration(key, hostname)
+	if err != nil {
+		return "", err
+	}
+
+	return config.source, nil
+}
+
+// Close stops watching the source.
+func (sourceWatcher *SourceWatcher) Close() error {
+	return sourceWatcher.watcher.Close()
+}
+
+// Run calls copyChanges with each batch of changed paths, relative to the source and sorted, until the context
+// is cancelled. Changes seen while copyChanges runs are collected into the next batch.
+func (sourceWatcher *SourceWatcher) Run(ctx context.Context, copyChanges func(ctx context.Context, paths []string)) error {
+	batchTimer := time.NewTimer(sourceWatcher.delay)
+	batchTimer.Stop()
+	defer batchTimer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-sourceWatcher.watcher.Events:
+			if !ok {
+				return nil
+			}
+			if sourceWatcher.recordChange(event) {
+				batchTimer.Reset(sourceWatcher.batchDelay())
+			}
+
+		case err, ok := <-sourceWatcher.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// changes were lost, so copy the whole source to be sure none of them are missed
+				PrintWarning("too many changes happened at once to follow them all, so the whole source will be copied")
+				sourceWatcher.markChanged(".")
+				batchTimer.Reset(sourceWatcher.batchDelay())
+			} else {
+				PrintWarning(fmt.Sprintf("error watching %s: %s", sourceWatcher.source, err))
+			}
+
+		case <-batchTimer.C:
+			paths := sourceWatcher.takeChanges()
+			if len(paths) > 0 {
+				copyChanges(ctx, paths)
+			}
+		}
+	}
+}
+
+// recordChange adds the path of the event to the batch, and starts watching any folder that was created.
+// It returns false for changes that do not need copying.
+func (sourceWatcher *SourceWatcher) recordChange(event fsnotify.Event) bool {
+	name := filepath.Clean(event.Name)
+	if strings.HasSuffix(name, partialFileSuffix) {
+		return false
+	}
+
+	if event.Has(fsnotify.Create) {
+		// a new folder is watched, and copied as a whole, as files may have been written to it before it was watched
+		err := sourceWatcher.addFolder(name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			PrintWarning(fmt.Sprintf("unable to watch %s: %s", name, err))
+		}
+	}
+
+	relativePath, err := filepath.Rel(sourceWatcher.source, name)
+	if err != nil || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return false
+	}
+	sourceWatcher.markChanged(filepath.ToSlash(relativePath))
+
+	return true
+}
+
+// markChanged adds the path to the batch, noting when the batch started.
+func (sourceWatcher *SourceWatcher) markChanged(relativePath string) {
+	if len(sourceWatcher.changed) == 0 {
+		sourceWatcher.firstChange = time.Now()
+	}
+	sourceWatcher.changed[relativePath] = true
+}
+
+// batchDelay returns how long to wait for more changes before handing over the batch.
+func (sourceWatcher *SourceWatcher) batchDelay() time.Duration {
+	remaining := sourceWatcher.maxDelay - time.Since(sourceWatcher.firstChange)
+	return max(0, min(sourceWatcher.delay, remaining))
+}
+
+// takeChanges returns the paths in the batch, sorted, and starts a new batch.
+func (sourceWatcher *SourceWatcher) takeChanges() []string {
+	paths := make([]string, 0, len(sourceWatcher.changed))
+	for relativePath := range sourceWatcher.changed {
+		paths = append(paths, relativePath)
+	}
+	sort.Strings(paths)
+
+	sourceWatcher.changed = make(map[string]bool)
+
+	return paths
+}
+
+// addFolder watches the folder, and every folder inside it. Nothing happens if the path is not a folder.
+func (sourceWatcher *SourceWatcher) addFolder(folder string) error {
+	return filepath.WalkDir(folder, func(walkPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+
+		return sourceWatcher.watcher.Add(walkPath)
+	})
+}
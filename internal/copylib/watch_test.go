@@ -0,0 +1,61 @@
+package copylib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSourceWatcherSuccess(t *testing.T) {
+	t.Parallel()
+
+	source := t.TempDir()
+	err := os.WriteFile(filepath.Join(source, "profile.sav"), []byte("profile"), 0644)
+	if err != nil {
+		t.Fatalf("error writing the test file: %s", err)
+	}
+
+	watcher, err := NewSourceWatcher(source, 100*time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error watching the source: %s", err)
+	}
+	defer watcher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var batches [][]string
+	go func() {
+		// a burst of writes, including to a new folder, is copied as a single batch
+		for index := 0; index < 5; index++ {
+			os.WriteFile(filepath.Join(source, "profile.sav"), []byte("profile"), 0644)
+			time.Sleep(10 * time.Millisecond)
+		}
+		os.MkdirAll(filepath.Join(source, "slot1"), 0755)
+		os.WriteFile(filepath.Join(source, "slot1", "save.sav"), []byte("save"), 0644)
+		os.WriteFile(filepath.Join(source, "save.sav"+partialFileSuffix), []byte("partial"), 0644)
+	}()
+
+	err = watcher.Run(ctx, func(ctx context.Context, paths []string) {
+		batches = append(batches, paths)
+		cancel()
+	})
+	if err != nil {
+		t.Fatalf("unexpected error running the watcher: %s", err)
+	}
+
+	if len(batches) != 1 {
+		t.Fatalf("expected a single batch of changes, but got %v", batches)
+	}
+	// the file in the new folder may be seen before or after the folder is watched, but the folder is always copied
+	changed := batches[0]
+	if len(changed) == 3 && changed[2] == "slot1/save.sav" {
+		changed = changed[:2]
+	}
+	if !reflect.DeepEqual(changed, []string{"profile.sav", "slot1"}) {
+		t.Errorf("expected profile.sav and the slot1 folder to change, but got %v", batches[0])
+	}
+}
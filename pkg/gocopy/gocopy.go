@@ -0,0 +1,193 @@
+// Package gocopy copies files from a source folder to one or more destinations,
+// using the same engine as the go-copy command line tool.
+//
+// An Operation can be built directly, or read from a go-copy config file with LoadConfig,
+// and is then run with a Runner:
+//
+//	runner, err := gocopy.New(operation, gocopy.WithLogMode(gocopy.LogWarning))
+//	if err != nil {
+//		return err
+//	}
+//	runner.Copy(ctx)
+//	fmt.Println(runner.Stats.Outcome(), runner.Stats.TotalFilesCopied)
+//
+// Progress can be followed by passing WithEvents, which sends an Event as each folder and file is copied.
+//
+// Nothing in this package depends on global state, so several runners can be used side by side.
+// Even the name of the machine, used for the Hosts of an operation, can be set with WithHostname.
+package gocopy
+
+import (
+	"io"
+
+	"github.com/andrewlader/go-copy/internal/copylib"
+)
+
+type (
+	// Config holds the operations read from a go-copy config file.
+	Config = copylib.Config
+	// Operation describes a copy from a source folder to one or more destinations.
+	Operation = copylib.Operation
+	// Destination is a single place an Operation copies to.
+	Destination = copylib.Destination
+	// Hook is a command run before or after an operation copies its files.
+	Hook = copylib.Hook
+	// Retry decides which files that fail to copy to a destination are tried again, and when.
+	Retry = copylib.Retry
+	// Manifest decides if each destination keeps a list of the files in it, to skip files without looking them up.
+	Manifest = copylib.Manifest
+	// Schedule says when an operation runs by itself, at an interval or the times of a cron expression.
+	Schedule = copylib.Schedule
+	// ReplaceMode decides what happens when a file already exists at a destination.
+	ReplaceMode = copylib.ReplaceMode
+	// Runner runs an Operation.
+	Runner = copylib.Runner
+	// Stats are the counts and timings of a run.
+	Stats = copylib.Stats
+	// DestinationStats are the counts for a single destination of a run.
+	DestinationStats = copylib.DestinationStats
+	// Option changes how a Runner behaves.
+	Option = copylib.Option
+	// LogMode sets how much a Runner logs.
+	LogMode = copylib.LogMode
+	// Event describes something that happened while a Runner copied an operation.
+	Event = copylib.Event
+	// EventType says what happened in an Event.
+	EventType = copylib.EventType
+	// EventHandler is called with each Event of a run.
+	EventHandler = copylib.EventHandler
+	// Filesystem is what a Runner writes its destination files to.
+	Filesystem = copylib.Filesystem
+	// SourceFilesystem is what a Runner reads its source files from.
+	SourceFilesystem = copylib.SourceFilesystem
+	// File is an open file on a Filesystem.
+	File = copylib.File
+	// OSFilesystem is the filesystem of the operating system, and is used unless a Runner is given another.
+	OSFilesystem = copylib.OSFilesystem
+	// MemoryFilesystem is a Filesystem held entirely in memory.
+	MemoryFilesystem = copylib.MemoryFilesystem
+	// Result lists every file of a run, and what happened to it at each destination.
+	Result = copylib.Result
+	// FileResult is what happened to a single source file.
+	FileResult = copylib.FileResult
+	// DestinationResult is what happened to a file at a single destination.
+	DestinationResult = copylib.DestinationResult
+	// FileOutcome is what happened to a file at a single destination.
+	FileOutcome = copylib.FileOutcome
+)
+
+const (
+	ReplaceNever  = copylib.ReplaceNever
+	ReplaceSkip   = copylib.ReplaceSkip
+	ReplaceAlways = copylib.ReplaceAlways
+)
+
+const (
+	LogSilent  = copylib.LogSilent
+	LogSimple  = copylib.LogSimple
+	LogWarning = copylib.LogWarning
+	LogInfo    = copylib.LogInfo
+	LogDebug   = copylib.LogDebug
+	LogVerbose = copylib.LogVerbose
+)
+
+const (
+	LogFormatText = copylib.LogFormatText
+	LogFormatJSON = copylib.LogFormatJSON
+)
+
+const (
+	FileCopied   = copylib.FileCopied
+	FileReplaced = copylib.FileReplaced
+	FileSkipped  = copylib.FileSkipped
+	FileFailed   = copylib.FileFailed
+)
+
+const (
+	EventOperationStarted  = copylib.EventOperationStarted
+	EventDirectoryEntered  = copylib.EventDirectoryEntered
+	EventFileStarted       = copylib.EventFileStarted
+	EventBytesProgress     = copylib.EventBytesProgress
+	EventFileCopied        = copylib.EventFileCopied
+	EventFileSkipped       = copylib.EventFileSkipped
+	EventFileFailed        = copylib.EventFileFailed
+	EventOperationFinished = copylib.EventOperationFinished
+	EventFileRetrying      = copylib.EventFileRetrying
+)
+
+// New creates a Runner for the operation. By default it logs at LogInfo to stdout.
+func New(operation Operation, options ...Option) (*Runner, error) {
+	return copylib.NewRunnerForOperation(operation, options...)
+}
+
+// NewMemoryFilesystem creates an empty MemoryFilesystem.
+func NewMemoryFilesystem() *MemoryFilesystem {
+	return copylib.NewMemoryFilesystem()
+}
+
+// WriteReport writes the results of one or more runs to the file as a JSON list.
+func WriteReport(filename string, results []*Result) error {
+	return copylib.WriteReport(filename, results)
+}
+
+// ParseSchedule reads a schedule, which is an interval, such as "6h", or a cron expression, such as "0 3 * * *".
+func ParseSchedule(text string) (*Schedule, error) {
+	return copylib.ParseSchedule(text)
+}
+
+// LoadConfig reads and validates a go-copy config file.
+func LoadConfig(filename string) (*Config, error) {
+	return copylib.LoadConfig(filename)
+}
+
+// WithLogMode sets how much the runner logs while it copies.
+func WithLogMode(mode LogMode) Option {
+	return copylib.WithLogMode(mode)
+}
+
+// WithLogFormat sets the format of the runner's log output: LogFormatText, the default, or LogFormatJSON.
+func WithLogFormat(format string) Option {
+	return copylib.WithLogFormat(format)
+}
+
+// WithOutput sets where the runner writes its log output; use io.Discard to silence it entirely.
+func WithOutput(output io.Writer) Option {
+	return copylib.WithOutput(output)
+}
+
+// WithEvents calls the handler with every Event of the run, on the goroutine running the copy.
+// To receive the events on a channel, use a handler that sends them to it.
+func WithEvents(handler EventHandler) Option {
+	return copylib.WithEvents(handler)
+}
+
+// WithPaths limits the copy to the given files and folders, relative to the source, instead of the whole source.
+func WithPaths(paths []string) Option {
+	return copylib.WithPaths(paths)
+}
+
+// WithRescan rebuilds the manifest of each destination from the files in it, instead of trusting it.
+func WithRescan() Option {
+	return copylib.WithRescan()
+}
+
+// WithDryRun reports what would be copied, in the stats, events and results, without writing anything.
+func WithDryRun() Option {
+	return copylib.WithDryRun()
+}
+
+// WithHostname sets how the runner finds the name of this machine, for the Hosts of the operation and the {host}
+// placeholder in destination paths. It defaults to os.Hostname.
+func WithHostname(hostname func() (string, error)) Option {
+	return copylib.WithHostname(hostname)
+}
+
+// WithSourceFilesystem sets the filesystem the runner reads the source files from.
+func WithSourceFilesystem(source SourceFilesystem) Option {
+	return copylib.WithSourceFilesystem(source)
+}
+
+// WithDestinationFilesystem sets the filesystem the runner writes to every destination.
+func WithDestinationFilesystem(destination Filesystem) Option {
+	return copylib.WithDestinationFilesystem(destination)
+}
@@ -0,0 +1,215 @@
+package gocopy_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrewlader/go-copy/pkg/gocopy"
+)
+
+func writeTestFile(t *testing.T, filename string, contents string) {
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		t.Fatalf("error creating folder for %s: %s", filename, err)
+	}
+
+	err = os.WriteFile(filename, []byte(contents), 0644)
+	if err != nil {
+		t.Fatalf("error writing %s: %s", filename, err)
+	}
+}
+
+func TestNewAndCopySuccess(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	writeTestFile(t, filepath.Join(source, "save001.sav"), "first save")
+	writeTestFile(t, filepath.Join(source, "profiles", "profile.sav"), "profile")
+
+	operation := gocopy.Operation{
+		Key:    "saves",
+		Source: source,
+		Destinations: []gocopy.Destination{
+			{Path: filepath.Join(root, "backup", "{operation}")},
+			{Path: filepath.Join(root, "usb"), Optional: true, Exclude: []string{"profiles/*"}},
+			{Path: filepath.Join(root, "old"), Disabled: true},
+		},
+		Replace: gocopy.ReplaceAlways,
+	}
+	err := os.Mkdir(filepath.Join(root, "usb"), 0755)
+	if err != nil {
+		t.Fatalf("error creating usb folder: %s", err)
+	}
+
+	runner, err := gocopy.New(operation, gocopy.WithLogMode(gocopy.LogVerbose), gocopy.WithOutput(io.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error creating the runner: %s", err)
+	}
+
+	runner.Copy(context.Background())
+
+	if runner.Stats.NumberOfErrors != 0 {
+		t.Errorf("expected no errors, but there were %d", runner.Stats.NumberOfErrors)
+	}
+	if runner.Stats.TotalFilesCopied != 3 {
+		t.Errorf("expected 3 files to be copied, but %d were copied", runner.Stats.TotalFilesCopied)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(root, "backup", "saves", "profiles", "profile.sav"))
+	if err != nil || string(contents) != "profile" {
+		t.Errorf("the profile was not copied to the backup: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "usb", "profiles", "profile.sav")); err == nil {
+		t.Errorf("the excluded profile was copied to the usb destination")
+	}
+	if _, err := os.Stat(filepath.Join(root, "old")); err == nil {
+		t.Errorf("the disabled destination was created")
+	}
+}
+
+func TestCopyEventsSuccess(t *testing.T) {
+	var events []gocopy.Event
+
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	writeTestFile(t, filepath.Join(source, "save001.sav"), "first save")
+	writeTestFile(t, filepath.Join(source, "profiles", "profile.sav"), "profile")
+
+	operation := gocopy.Operation{
+		Key:    "saves",
+		Source: source,
+		Destinations: []gocopy.Destination{
+			{Path: filepath.Join(root, "backup")},
+			{Path: filepath.Join(root, "usb"), Exclude: []string{"profiles/*"}},
+		},
+	}
+
+	runner, err := gocopy.New(operation, gocopy.WithOutput(io.Discard), gocopy.WithEvents(func(event gocopy.Event) {
+		events = append(events, event)
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error creating the runner: %s", err)
+	}
+
+	runner.Copy(context.Background())
+
+	counts := make(map[gocopy.EventType]int)
+	for _, event := range events {
+		counts[event.Type]++
+		if event.Operation != "saves" {
+			t.Errorf("expected every event to be for operation \"saves\", but got \"%s\"", event.Operation)
+		}
+	}
+
+	if len(events) == 0 || events[0].Type != gocopy.EventOperationStarted {
+		t.Fatalf("expected the first event to be %s", gocopy.EventOperationStarted)
+	}
+	last := events[len(events)-1]
+	if last.Type != gocopy.EventOperationFinished || last.Stats != runner.Stats {
+		t.Errorf("expected the last event to be %s with the stats of the run", gocopy.EventOperationFinished)
+	}
+	if counts[gocopy.EventDirectoryEntered] != 2 {
+		t.Errorf("expected 2 folders to be entered, but got %d", counts[gocopy.EventDirectoryEntered])
+	}
+	if counts[gocopy.EventFileStarted] != 2 {
+		t.Errorf("expected 2 files to be started, but got %d", counts[gocopy.EventFileStarted])
+	}
+	if counts[gocopy.EventFileCopied] != 3 {
+		t.Errorf("expected 3 files to be copied, but got %d", counts[gocopy.EventFileCopied])
+	}
+	if counts[gocopy.EventFileSkipped] != 1 {
+		t.Errorf("expected the excluded file to be skipped once, but got %d", counts[gocopy.EventFileSkipped])
+	}
+	if counts[gocopy.EventFileFailed] != 0 {
+		t.Errorf("expected no files to fail, but got %d", counts[gocopy.EventFileFailed])
+	}
+}
+
+func TestNewInvalidOperationFailure(t *testing.T) {
+	operation := gocopy.Operation{
+		Key:          "saves",
+		Source:       "/games/saves",
+		Destinations: []gocopy.Destination{{Path: "/backups/{user}"}},
+	}
+
+	_, err := gocopy.New(operation)
+	if err == nil {
+		t.Errorf("expected an error for an unknown placeholder in a destination")
+	}
+}
+
+func TestLoadConfigSuccess(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "go-copy-config.yaml")
+	writeTestFile(t, configFile, `
+Saves:
+  name: Game Saves
+  source: /games/saves
+  destinations:
+    - /backups/one
+    - path: /backups/usb
+      required: false
+  replace: never
+  hook_timeout: 2m
+  post:
+    - echo done
+log:
+  file: /var/log/go-copy.log
+  level: warning
+`)
+
+	config, err := gocopy.LoadConfig(configFile)
+	if err != nil {
+		t.Fatalf("unexpected error loading the config: %s", err)
+	}
+
+	operation, ok := config.Operation("SAVES")
+	if !ok {
+		t.Fatalf("the operation was not found; the keys are %v", config.Keys())
+	}
+	if len(config.Keys()) != 1 {
+		t.Errorf("expected the log settings not to be loaded as an operation, but the keys are %v", config.Keys())
+	}
+
+	if operation.Name != "Game Saves" || operation.Replace != gocopy.ReplaceNever || len(operation.Destinations) != 2 {
+		t.Errorf("the operation was not loaded correctly: %+v", operation)
+	}
+	if !operation.Destinations[1].Optional || operation.Destinations[1].Replace != gocopy.ReplaceNever {
+		t.Errorf("the usb destination was not loaded correctly: %+v", operation.Destinations[1])
+	}
+	if operation.HookTimeout != 2*time.Minute || len(operation.Post) != 1 {
+		t.Errorf("the hooks were not loaded correctly: %v %+v", operation.HookTimeout, operation.Post)
+	}
+}
+
+func TestWithHostnameSuccess(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	writeTestFile(t, filepath.Join(source, "save001.sav"), "first save")
+
+	operation := gocopy.Operation{
+		Key:          "saves",
+		Source:       source,
+		Destinations: []gocopy.Destination{{Path: filepath.Join(root, "backup", "{host}")}},
+		Hosts:        []string{"gaming-*"},
+	}
+
+	_, err := gocopy.New(operation, gocopy.WithOutput(io.Discard), gocopy.WithHostname(func() (string, error) { return "laptop", nil }))
+	if err == nil {
+		t.Errorf("expected an error creating a runner for an operation that does not apply to this host")
+	}
+
+	runner, err := gocopy.New(operation, gocopy.WithOutput(io.Discard), gocopy.WithHostname(func() (string, error) { return "gaming-pc", nil }))
+	if err != nil {
+		t.Fatalf("unexpected error creating the runner: %s", err)
+	}
+
+	runner.Copy(context.Background())
+
+	contents, err := os.ReadFile(filepath.Join(root, "backup", "gaming-pc", "save001.sav"))
+	if err != nil || string(contents) != "first save" {
+		t.Errorf("the save was not copied to the folder of the host: %v", err)
+	}
+}